@@ -0,0 +1,113 @@
+// Package apikey issues and verifies API keys, the non-interactive credential used by
+// scripts and SOAR playbooks.
+//
+// A key looks like aug_1a2b3c4d_<43 random characters>. The first part (the prefix)
+// identifies the key in listings; only a SHA-256 hash of the whole key is stored, so a
+// leaked database does not leak usable keys. Keys belong to an owner, who is recorded as
+// the user of every lookup made with the key, carry one role and a list of route scopes,
+// and expire.
+package apikey
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/0x-Singularity/Augury/identity"
+	"github.com/0x-Singularity/Augury/models"
+)
+
+// Prefix starts every key
+const Prefix = "aug_"
+
+// Method is the identity.Identity method of callers using a key
+const Method = "api_key"
+
+// DefaultTTL is how long a key lives when it is created without an expiry
+const DefaultTTL = 90 * 24 * time.Hour
+
+// ErrInvalidKey is returned for unknown, revoked and expired keys alike
+var ErrInvalidKey = errors.New("invalid api key")
+
+// Generate returns a new key, its display prefix and the hash to store
+func Generate() (key, prefix, hash string, err error) {
+	id := make([]byte, 4)
+	secret := make([]byte, 32)
+	if _, err := rand.Read(id); err != nil {
+		return "", "", "", err
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", "", err
+	}
+	prefix = Prefix + hex.EncodeToString(id)
+	key = prefix + "_" + base64.RawURLEncoding.EncodeToString(secret)
+	return key, prefix, Hash(key), nil
+}
+
+// Hash returns the stored form of key
+func Hash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Store finds active keys; the default store is Postgres
+type Store interface {
+	// UseAPIKey returns the active key with hash, recording its use, or nil
+	UseAPIKey(ctx context.Context, hash string) (*models.APIKey, error)
+}
+
+type dbStore struct{}
+
+func (dbStore) UseAPIKey(ctx context.Context, hash string) (*models.APIKey, error) {
+	return models.UseAPIKey(ctx, hash)
+}
+
+// Verifier turns a presented key into the identity of its owner
+type Verifier struct {
+	store Store
+}
+
+// NewVerifier returns a Verifier backed by store, or by Postgres when store is nil
+func NewVerifier(store Store) *Verifier {
+	if store == nil {
+		store = dbStore{}
+	}
+	return &Verifier{store: store}
+}
+
+// Verify returns the identity of key's owner, with the key's role and scopes
+func (v *Verifier) Verify(ctx context.Context, key string) (identity.Identity, error) {
+	if !strings.HasPrefix(key, Prefix) {
+		return identity.Identity{}, ErrInvalidKey
+	}
+	k, err := v.store.UseAPIKey(ctx, Hash(key))
+	if err != nil {
+		return identity.Identity{}, err
+	}
+	if k == nil {
+		return identity.Identity{}, ErrInvalidKey
+	}
+
+	scopes := k.Scopes
+	if scopes == nil {
+		scopes = []string{} // a key without scopes may call nothing, not everything
+	}
+	return identity.Identity{
+		Subject: "apikey:" + k.Prefix,
+		Name:    k.Owner,
+		Roles:   []string{k.Role},
+		Scopes:  scopes,
+		Method:  Method,
+	}, nil
+}
+
+// ValidScope reports whether s is a scope a key can be given: "*" (every route), an API
+// route such as /ioc/extract, or a route prefix such as /ioc/*
+func ValidScope(s string) bool {
+	return s == "*" || (strings.HasPrefix(s, "/") && !strings.ContainsAny(s, " ?#"))
+}
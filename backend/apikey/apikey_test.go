@@ -0,0 +1,74 @@
+package apikey
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/0x-Singularity/Augury/models"
+)
+
+type fakeStore map[string]*models.APIKey
+
+func (s fakeStore) UseAPIKey(_ context.Context, hash string) (*models.APIKey, error) {
+	return s[hash], nil
+}
+
+func TestGenerate(t *testing.T) {
+	key, prefix, hash, err := Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(key, prefix+"_") || !strings.HasPrefix(prefix, Prefix) || len(prefix) != len(Prefix)+8 {
+		t.Errorf("unexpected key %q with prefix %q", key, prefix)
+	}
+	if strings.Contains(key, ".") {
+		t.Errorf("keys must not look like JWTs: %q", key)
+	}
+	if hash != Hash(key) || len(hash) != 64 || strings.Contains(hash, key) {
+		t.Errorf("unexpected hash %q", hash)
+	}
+	if other, _, _, _ := Generate(); other == key {
+		t.Error("expected distinct keys")
+	}
+}
+
+func TestVerifier(t *testing.T) {
+	key, prefix, hash, _ := Generate()
+	unscoped, _, unscopedHash, _ := Generate()
+	v := NewVerifier(fakeStore{
+		hash:         {Prefix: prefix, Owner: "soar-bot", Role: "analyst", Scopes: []string{"/ioc/*"}},
+		unscopedHash: {Prefix: "aug_00000000", Owner: "old-bot", Role: "viewer"},
+	})
+
+	id, err := v.Verify(context.Background(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id.Name != "soar-bot" || id.Method != Method || id.Subject != "apikey:"+prefix ||
+		len(id.Roles) != 1 || id.Roles[0] != "analyst" || len(id.Scopes) != 1 {
+		t.Errorf("unexpected identity %+v", id)
+	}
+
+	if id, _ := v.Verify(context.Background(), unscoped); id.Scopes == nil {
+		t.Error("a key without scopes must not be unrestricted")
+	}
+
+	for _, bad := range []string{"", "aug_unknown", "not-a-key", strings.TrimPrefix(key, Prefix)} {
+		if _, err := v.Verify(context.Background(), bad); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("%q: expected ErrInvalidKey, got %v", bad, err)
+		}
+	}
+}
+
+func TestValidScope(t *testing.T) {
+	for s, want := range map[string]bool{
+		"*": true, "/ioc/extract": true, "/ioc/*": true,
+		"": false, "ioc/extract": false, "/ioc/pdns?ioc=x": false,
+	} {
+		if got := ValidScope(s); got != want {
+			t.Errorf("ValidScope(%q) = %v, want %v", s, got, want)
+		}
+	}
+}
@@ -0,0 +1,288 @@
+// Package audit records every API action in a tamper-evident log: who called which
+// route, for which IOCs, which sources returned data, from where, and a SHA-256 of the
+// exact response they received.
+//
+// Records form a hash chain. Each record's hash covers its own fields and the hash of
+// the record before it, so editing, deleting or reordering any record breaks every hash
+// after it, which Verify reports. The table also refuses UPDATE, DELETE and TRUNCATE.
+// Dropping records from the end can only be caught by comparing the latest hash with a
+// copy kept elsewhere, which is why Verify returns it.
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/0x-Singularity/Augury/identity"
+	"github.com/0x-Singularity/Augury/models"
+	"github.com/0x-Singularity/Augury/response"
+)
+
+// Store keeps the chain; the default store is Postgres
+type Store interface {
+	// Append sets rec.PrevHash to the latest record's hash, calls seal to set rec.Hash
+	// and stores rec, atomically with respect to other appends
+	Append(ctx context.Context, rec *models.AuditRecord, seal func(*models.AuditRecord)) error
+	// Records returns up to limit records with an id above afterID, oldest first
+	Records(ctx context.Context, afterID int64, limit int) ([]models.AuditRecord, error)
+}
+
+type dbStore struct{}
+
+func (dbStore) Append(ctx context.Context, rec *models.AuditRecord, seal func(*models.AuditRecord)) error {
+	return models.AppendAudit(ctx, rec, seal)
+}
+
+func (dbStore) Records(ctx context.Context, afterID int64, limit int) ([]models.AuditRecord, error) {
+	return models.AuditRecords(ctx, afterID, limit)
+}
+
+// DBStore returns the Postgres store
+func DBStore() Store {
+	return dbStore{}
+}
+
+// Hash returns the chain hash of rec: SHA-256 over the previous hash and a canonical
+// JSON encoding of every recorded field. The record's id is not covered; its position
+// in the chain is.
+func Hash(rec models.AuditRecord) string {
+	canonical := struct {
+		PrevHash       string   `json:"prev_hash"`
+		CreatedAt      string   `json:"created_at"`
+		Actor          string   `json:"actor"`
+		AuthMethod     string   `json:"auth_method"`
+		Method         string   `json:"method"`
+		Route          string   `json:"route"`
+		Status         int      `json:"status"`
+		IOCs           []string `json:"iocs"`
+		Sources        []string `json:"sources"`
+		ClientIP       string   `json:"client_ip"`
+		ResponseSHA256 string   `json:"response_sha256"`
+	}{
+		PrevHash:       rec.PrevHash,
+		CreatedAt:      rec.CreatedAt.UTC().Format(time.RFC3339Nano),
+		Actor:          rec.Actor,
+		AuthMethod:     rec.AuthMethod,
+		Method:         rec.Method,
+		Route:          rec.Route,
+		Status:         rec.Status,
+		IOCs:           nonNil(rec.IOCs),
+		Sources:        nonNil(rec.Sources),
+		ClientIP:       rec.ClientIP,
+		ResponseSHA256: rec.ResponseSHA256,
+	}
+	b, _ := json.Marshal(canonical)
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
+
+// Append adds rec to the chain in store
+func Append(ctx context.Context, store Store, rec *models.AuditRecord) error {
+	// Postgres keeps microseconds; hash what will be read back
+	rec.CreatedAt = rec.CreatedAt.UTC().Truncate(time.Microsecond)
+	rec.IOCs = nonNil(rec.IOCs)
+	rec.Sources = nonNil(rec.Sources)
+	return store.Append(ctx, rec, func(r *models.AuditRecord) { r.Hash = Hash(*r) })
+}
+
+//--------------------Request annotations------------------------------------------------------------------
+
+// entry collects what handlers report about the request being audited
+type entry struct {
+	mu         sync.Mutex
+	iocs       []string
+	sources    map[string]bool
+	id         identity.Identity
+	identified bool
+}
+
+type contextKey struct{}
+
+// SetIOCs records the IOCs the request is about. Without it the ioc query parameter is used.
+func SetIOCs(ctx context.Context, iocs ...string) {
+	if e, ok := ctx.Value(contextKey{}).(*entry); ok {
+		e.mu.Lock()
+		e.iocs = append([]string(nil), iocs...)
+		e.mu.Unlock()
+	}
+}
+
+// AddSources records enrichment sources that returned data to the caller
+func AddSources(ctx context.Context, sources ...string) {
+	if e, ok := ctx.Value(contextKey{}).(*entry); ok {
+		e.mu.Lock()
+		for _, s := range sources {
+			e.sources[s] = true
+		}
+		e.mu.Unlock()
+	}
+}
+
+// Identify tells the audit middleware, which runs before authentication, who the
+// authenticated caller is. Register it right after the authentication middleware.
+func Identify(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if e, ok := r.Context().Value(contextKey{}).(*entry); ok {
+			if id, ok := identity.FromContext(r.Context()); ok {
+				e.mu.Lock()
+				e.id, e.identified = id, true
+				e.mu.Unlock()
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// caller returns the identity Identify recorded, falling back to the one in ctx
+func (e *entry) caller(ctx context.Context) identity.Identity {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.identified {
+		return e.id
+	}
+	id, _ := identity.FromContext(ctx)
+	return id
+}
+
+func (e *entry) snapshot() (iocs, sources []string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for s := range e.sources {
+		sources = append(sources, s)
+	}
+	sort.Strings(sources)
+	return e.iocs, sources
+}
+
+//--------------------Middleware---------------------------------------------------------------------------
+
+// Middleware appends one record per API request to store once the handler has finished;
+// a nil store records nothing. It runs before authentication so requests refused there
+// are recorded too, under the anonymous actor; Identify, after authentication, names the
+// caller of the others. Failing to write a record is logged; the response has already
+// been sent by then. trustProxy is passed to ClientIP.
+func Middleware(store Store, trustProxy bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return middleware(store, trustProxy, next)
+	}
+}
+
+func middleware(store Store, trustProxy bool, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if store == nil || r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		e := &entry{sources: make(map[string]bool)}
+		body := sha256.New()
+		rw := response.NewRecorder(w)
+		rw.Body = body
+		started := time.Now()
+		next.ServeHTTP(rw, r.WithContext(context.WithValue(r.Context(), contextKey{}, e)))
+
+		iocs, sources := e.snapshot()
+		if iocs == nil && r.URL.Query().Get("ioc") != "" {
+			iocs = []string{r.URL.Query().Get("ioc")}
+		}
+		id := e.caller(r.Context())
+		rec := &models.AuditRecord{
+			CreatedAt:      started,
+			Actor:          identity.UserName(identity.WithIdentity(r.Context(), id)),
+			AuthMethod:     id.Method,
+			Method:         r.Method,
+			Route:          r.URL.Path,
+			Status:         rw.Status,
+			IOCs:           iocs,
+			Sources:        sources,
+			ClientIP:       ClientIP(r, trustProxy),
+			ResponseSHA256: hex.EncodeToString(body.Sum(nil)),
+		}
+		// The client may be gone, but the record must still be written
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := Append(ctx, store, rec); err != nil {
+			slog.ErrorContext(r.Context(), "AUDIT FAILURE: could not record request", "method", r.Method, "path", r.URL.Path, "err", err)
+		}
+	})
+}
+
+// ClientIP returns the caller's address. X-Forwarded-For is only believed with
+// trustProxy, i.e. when Augury runs behind a proxy that sets it.
+func ClientIP(r *http.Request, trustProxy bool) string {
+	if trustProxy {
+		if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+			first, _, _ := strings.Cut(fwd, ",")
+			return strings.TrimSpace(first)
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+//--------------------Verification-------------------------------------------------------------------------
+
+// Result is the outcome of Verify
+type Result struct {
+	Valid    bool   `json:"valid"`
+	Records  int64  `json:"records"`             // records checked
+	LastID   int64  `json:"last_id,omitempty"`   // id of the last valid record
+	LastHash string `json:"last_hash,omitempty"` // keep a copy elsewhere to detect truncation
+	BrokenAt int64  `json:"broken_at,omitempty"` // first record that fails
+	Reason   string `json:"reason,omitempty"`
+}
+
+// verifyBatch is how many records Verify reads at a time
+const verifyBatch = 1000
+
+// Verify walks the whole chain in store, recomputing every hash
+func Verify(ctx context.Context, store Store) (Result, error) {
+	var res Result
+	prev := ""
+	var afterID int64
+	for {
+		batch, err := store.Records(ctx, afterID, verifyBatch)
+		if err != nil {
+			return res, err
+		}
+		for _, rec := range batch {
+			switch {
+			case rec.PrevHash != prev:
+				res.BrokenAt, res.Reason = rec.ID, fmt.Sprintf("record %d does not link to the record before it", rec.ID)
+			case Hash(rec) != rec.Hash:
+				res.BrokenAt, res.Reason = rec.ID, fmt.Sprintf("record %d does not match its hash", rec.ID)
+			}
+			if res.BrokenAt != 0 {
+				return res, nil
+			}
+			res.Records++
+			res.LastID, res.LastHash = rec.ID, rec.Hash
+			prev = rec.Hash
+		}
+		if len(batch) < verifyBatch {
+			res.Valid = true
+			return res, nil
+		}
+		afterID = batch[len(batch)-1].ID
+	}
+}
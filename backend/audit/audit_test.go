@@ -0,0 +1,186 @@
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/0x-Singularity/Augury/identity"
+	"github.com/0x-Singularity/Augury/models"
+)
+
+// memoryStore is an in-memory Store
+type memoryStore struct {
+	mu      sync.Mutex
+	records []models.AuditRecord
+}
+
+func (m *memoryStore) Append(_ context.Context, rec *models.AuditRecord, seal func(*models.AuditRecord)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	rec.PrevHash = ""
+	if n := len(m.records); n > 0 {
+		rec.PrevHash = m.records[n-1].Hash
+	}
+	seal(rec)
+	rec.ID = int64(len(m.records) + 1)
+	m.records = append(m.records, *rec)
+	return nil
+}
+
+func (m *memoryStore) Records(_ context.Context, afterID int64, limit int) ([]models.AuditRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []models.AuditRecord
+	for _, r := range m.records {
+		if r.ID > afterID && len(out) < limit {
+			out = append(out, r)
+		}
+	}
+	return out, nil
+}
+
+func appendN(t *testing.T, store Store, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		err := Append(context.Background(), store, &models.AuditRecord{
+			CreatedAt: time.Now(), Actor: "alice", Method: "GET", Route: "/api/ioc/ldap",
+			Status: 200, IOCs: []string{"abob"}, Sources: []string{"ldap"}, ClientIP: "10.0.0.1",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	store := &memoryStore{}
+	if res, _ := Verify(context.Background(), store); !res.Valid || res.Records != 0 {
+		t.Errorf("expected an empty chain to be valid, got %+v", res)
+	}
+
+	appendN(t, store, 5)
+	res, err := Verify(context.Background(), store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Valid || res.Records != 5 || res.LastHash != store.records[4].Hash {
+		t.Fatalf("expected a valid chain of 5, got %+v", res)
+	}
+	if store.records[0].PrevHash != "" || store.records[1].PrevHash != store.records[0].Hash {
+		t.Error("records are not linked")
+	}
+
+	tests := map[string]func(records []models.AuditRecord){
+		"edited field":   func(r []models.AuditRecord) { r[2].Actor = "mallory" },
+		"edited sources": func(r []models.AuditRecord) { r[2].Sources = nil },
+		"rehashed edit": func(r []models.AuditRecord) {
+			r[2].IOCs = []string{"someone-else"}
+			r[2].Hash = Hash(r[2])
+		},
+		"deleted record": func(r []models.AuditRecord) { copy(r[2:], r[3:]) },
+	}
+	for name, tamper := range tests {
+		tampered := &memoryStore{records: append([]models.AuditRecord(nil), store.records...)}
+		tamper(tampered.records)
+		res, _ := Verify(context.Background(), tampered)
+		if res.Valid || res.BrokenAt == 0 || res.Reason == "" {
+			t.Errorf("%s: expected a broken chain, got %+v", name, res)
+		}
+	}
+}
+
+func TestVerify_Batches(t *testing.T) {
+	store := &memoryStore{}
+	appendN(t, store, verifyBatch+3)
+	if res, _ := Verify(context.Background(), store); !res.Valid || res.Records != verifyBatch+3 {
+		t.Errorf("unexpected result %+v", res)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	store := &memoryStore{}
+	audited := Middleware(store, false)
+
+	h := audited(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		SetIOCs(r.Context(), "evil.com", "8.8.8.8")
+		AddSources(r.Context(), "pdns", "geo", "pdns")
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte(`{"data":{}}`))
+		w.(http.Flusher).Flush()
+	}))
+	req := httptest.NewRequest(http.MethodPost, "/api/ioc/extract", nil)
+	req.RemoteAddr = "10.1.2.3:5555"
+	req = req.WithContext(identity.WithIdentity(req.Context(), identity.Identity{Name: "alice", Method: "jwt"}))
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	if len(store.records) != 1 {
+		t.Fatalf("expected one record, got %d", len(store.records))
+	}
+	rec := store.records[0]
+	body := sha256.Sum256([]byte(`{"data":{}}`))
+	if rec.Actor != "alice" || rec.AuthMethod != "jwt" || rec.Route != "/api/ioc/extract" || rec.Status != http.StatusAccepted ||
+		rec.ClientIP != "10.1.2.3" || len(rec.IOCs) != 2 || rec.ResponseSHA256 != hex.EncodeToString(body[:]) {
+		t.Errorf("unexpected record %+v", rec)
+	}
+	if len(rec.Sources) != 2 || rec.Sources[0] != "geo" || rec.Sources[1] != "pdns" {
+		t.Errorf("expected sorted, distinct sources, got %v", rec.Sources)
+	}
+
+	// Without annotations the ioc parameter is recorded
+	h = audited(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/ioc/pdns?ioc=evil.com", nil))
+	if rec := store.records[1]; len(rec.IOCs) != 1 || rec.IOCs[0] != "evil.com" || rec.Actor != identity.Anonymous {
+		t.Errorf("unexpected record %+v", rec)
+	}
+}
+
+func TestMiddleware_BeforeAuthentication(t *testing.T) {
+	store := &memoryStore{}
+	// authn stands in for the authentication middleware: it refuses requests without a
+	// user and otherwise stores the identity in the context
+	authn := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user := r.Header.Get("X-User")
+			if user == "" {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(identity.WithIdentity(r.Context(), identity.Identity{Name: user, Method: "header"})))
+		})
+	}
+	h := Middleware(store, false)(authn(Identify(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))))
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/ioc/pdns?ioc=evil.com", nil))
+	req := httptest.NewRequest(http.MethodGet, "/api/ioc/pdns?ioc=evil.com", nil)
+	req.Header.Set("X-User", "alice")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	if len(store.records) != 2 {
+		t.Fatalf("expected both requests recorded, got %d", len(store.records))
+	}
+	if rec := store.records[0]; rec.Status != http.StatusUnauthorized || rec.Actor != identity.Anonymous || rec.AuthMethod != "" {
+		t.Errorf("expected the failed attempt recorded anonymously, got %+v", rec)
+	}
+	if rec := store.records[1]; rec.Status != http.StatusOK || rec.Actor != "alice" || rec.AuthMethod != "header" {
+		t.Errorf("expected the authenticated caller recorded, got %+v", rec)
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "10.0.0.9:1234"
+	req.Header.Set("X-Forwarded-For", "203.0.113.7, 10.0.0.1")
+
+	if ip := ClientIP(req, false); ip != "10.0.0.9" {
+		t.Errorf("expected the socket address, got %s", ip)
+	}
+	if ip := ClientIP(req, true); ip != "203.0.113.7" {
+		t.Errorf("expected the forwarded address, got %s", ip)
+	}
+}
@@ -0,0 +1,327 @@
+// Package auth authenticates API requests and stores the caller's identity in the
+// request context (see package identity).
+//
+// In the default "jwt" mode every request needs an OIDC/JWT bearer token. Tokens are
+// checked against the provider's signing keys (JWKS, found through OIDC discovery or
+// configured directly) or a locally configured public key, plus issuer, audience and expiry.
+//
+// API keys (see package apikey) are accepted in both modes, in the X-API-Key header or
+// as a bearer token.
+//
+// The "header" mode trusts the X-User-Name (and X-User-Roles) headers the way Augury used to. Anyone can
+// set that header, so it exists for local development only and must be chosen explicitly.
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/0x-Singularity/Augury/config"
+	"github.com/0x-Singularity/Augury/identity"
+	"github.com/0x-Singularity/Augury/rbac"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Authentication modes
+const (
+	ModeJWT    = "jwt"
+	ModeHeader = "header"
+)
+
+// Headers read in header mode; RolesHeader is a comma separated list
+const (
+	UserHeader  = "X-User-Name"
+	RolesHeader = "X-User-Roles"
+)
+
+// APIKeyHeader carries an API key
+const APIKeyHeader = "X-API-Key"
+
+// APIKeyVerifier resolves an API key to its owner's identity
+type APIKeyVerifier interface {
+	Verify(ctx context.Context, key string) (identity.Identity, error)
+}
+
+// Config configures an Authenticator
+type Config struct {
+	Mode    string         // ModeJWT (default) or ModeHeader
+	APIKeys APIKeyVerifier // accepts API keys when set
+	// DefaultRole is added to identities that carry no recognised role; empty adds none
+	DefaultRole rbac.Role
+
+	// JWT mode
+	Keys       KeySource     // verification keys
+	Issuer     string        // required "iss", when set
+	Audience   string        // required "aud", when set
+	UserClaim  string        // claim used as the user name; default preferred_username, then email, then sub
+	RolesClaim string        // claim holding the user's roles, may be dotted (realm_access.roles); default "roles"
+	Leeway     time.Duration // clock skew allowed on exp/nbf/iat
+}
+
+// Authenticator validates requests
+type Authenticator struct {
+	cfg    Config
+	parser *jwt.Parser
+}
+
+// ErrUnauthenticated is returned when a request has no usable credentials
+var ErrUnauthenticated = errors.New("authentication required")
+
+// New builds an Authenticator from cfg
+func New(cfg Config) (*Authenticator, error) {
+	if cfg.Mode == "" {
+		cfg.Mode = ModeJWT
+	}
+	if cfg.RolesClaim == "" {
+		cfg.RolesClaim = "roles"
+	}
+
+	switch cfg.Mode {
+	case ModeHeader:
+		return &Authenticator{cfg: cfg}, nil
+	case ModeJWT:
+		if cfg.Keys == nil {
+			return nil, errors.New("auth: jwt mode needs a key source (JWKS URL, issuer or public key)")
+		}
+	default:
+		return nil, fmt.Errorf("auth: unknown mode %q", cfg.Mode)
+	}
+
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(cfg.Leeway),
+	}
+	if cfg.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(cfg.Issuer))
+	}
+	if cfg.Audience != "" {
+		opts = append(opts, jwt.WithAudience(cfg.Audience))
+	}
+	return &Authenticator{cfg: cfg, parser: jwt.NewParser(opts...)}, nil
+}
+
+// NewFromConfig builds an Authenticator from the auth settings, accepting API keys through
+// keys when it is not nil. Without an explicit JWKS URL or public key the JWKS is found through
+// OIDC discovery on the issuer.
+func NewFromConfig(settings config.Auth, keys APIKeyVerifier) (*Authenticator, error) {
+	defaultRole, _ := rbac.Parse(settings.DefaultRole)
+	cfg := Config{
+		Mode:        strings.ToLower(settings.Mode),
+		Issuer:      settings.Issuer,
+		Audience:    settings.Audience,
+		UserClaim:   settings.UserClaim,
+		RolesClaim:  settings.RolesClaim,
+		DefaultRole: defaultRole,
+		Leeway:      30 * time.Second,
+		APIKeys:     keys,
+	}
+	if cfg.Mode == ModeHeader {
+		slog.Warn("Auth mode \"header\" trusts the X-User-Name header. Use it for local development only.")
+		return New(cfg)
+	}
+
+	switch {
+	case settings.PublicKeyFile != "":
+		key, err := LoadPublicKeyPEM(settings.PublicKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("auth: %w", err)
+		}
+		cfg.Keys = StaticKey{PublicKey: key}
+	case settings.JWKSURL != "":
+		cfg.Keys = NewJWKS(settings.JWKSURL)
+	case cfg.Issuer != "":
+		ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+		defer cancel()
+		url, err := discoverJWKS(ctx, cfg.Issuer)
+		if err != nil {
+			return nil, fmt.Errorf("auth: %w", err)
+		}
+		cfg.Keys = NewJWKS(url)
+	}
+	return New(cfg)
+}
+
+// Mode returns the authentication mode in use
+func (a *Authenticator) Mode() string {
+	return a.cfg.Mode
+}
+
+// Middleware rejects unauthenticated requests with 401 and stores the identity of
+// authenticated ones in the request context. CORS preflight requests pass through.
+func (a *Authenticator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		id, err := a.Authenticate(r)
+		if err != nil {
+			slog.InfoContext(r.Context(), "Rejected unauthenticated request", "method", r.Method, "path", r.URL.Path, "err", err)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="augury"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(identity.WithIdentity(r.Context(), id)))
+	})
+}
+
+// Authenticate returns the identity of the caller of r
+func (a *Authenticator) Authenticate(r *http.Request) (identity.Identity, error) {
+	id, err := a.authenticate(r)
+	if err != nil {
+		return id, err
+	}
+	if _, ok := rbac.Highest(id.Roles); !ok && a.cfg.DefaultRole != "" {
+		id.Roles = append(id.Roles, string(a.cfg.DefaultRole))
+	}
+	return id, nil
+}
+
+func (a *Authenticator) authenticate(r *http.Request) (identity.Identity, error) {
+	if key, ok := a.apiKey(r); ok {
+		return a.cfg.APIKeys.Verify(r.Context(), key)
+	}
+	if a.cfg.Mode == ModeHeader {
+		name := strings.TrimSpace(r.Header.Get(UserHeader))
+		if name == "" {
+			name = identity.Anonymous
+		}
+		var roles []string
+		for _, role := range strings.Split(r.Header.Get(RolesHeader), ",") {
+			if role = strings.TrimSpace(role); role != "" {
+				roles = append(roles, role)
+			}
+		}
+		return identity.Identity{Subject: name, Name: name, Roles: roles, Method: ModeHeader}, nil
+	}
+
+	raw, ok := bearerToken(r)
+	if !ok {
+		return identity.Identity{}, ErrUnauthenticated
+	}
+	return a.Verify(r.Context(), raw)
+}
+
+// Verify validates a raw JWT and returns the identity it asserts
+func (a *Authenticator) Verify(ctx context.Context, raw string) (identity.Identity, error) {
+	if a.parser == nil {
+		return identity.Identity{}, errors.New("auth: token verification is not enabled")
+	}
+
+	claims := jwt.MapClaims{}
+	_, err := a.parser.ParseWithClaims(raw, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		key, err := a.cfg.Keys.Key(ctx, kid)
+		if err != nil {
+			return nil, err
+		}
+		if !keyMatchesMethod(key, t.Method) {
+			return nil, fmt.Errorf("key type does not match algorithm %s", t.Method.Alg())
+		}
+		return key, nil
+	})
+	if err != nil {
+		return identity.Identity{}, fmt.Errorf("invalid token: %w", err)
+	}
+
+	id := identity.Identity{
+		Subject: claimString(claims, "sub"),
+		Email:   claimString(claims, "email"),
+		Roles:   claimStrings(claims, a.cfg.RolesClaim),
+		Method:  ModeJWT,
+	}
+	if a.cfg.UserClaim != "" {
+		id.Name = claimString(claims, a.cfg.UserClaim)
+	}
+	for _, fallback := range []string{claimString(claims, "preferred_username"), id.Email, id.Subject} {
+		if id.Name == "" {
+			id.Name = fallback
+		}
+	}
+	if id.Name == "" {
+		return identity.Identity{}, errors.New("invalid token: no user identity claim")
+	}
+	return id, nil
+}
+
+// apiKey returns the API key presented with r, if API keys are enabled. A bearer token
+// without dots can't be a JWT, so it is taken as a key.
+func (a *Authenticator) apiKey(r *http.Request) (string, bool) {
+	if a.cfg.APIKeys == nil {
+		return "", false
+	}
+	if key := strings.TrimSpace(r.Header.Get(APIKeyHeader)); key != "" {
+		return key, true
+	}
+	if token, ok := bearerToken(r); ok && !strings.Contains(token, ".") {
+		return token, true
+	}
+	return "", false
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	h := r.Header.Get("Authorization")
+	if len(h) < 7 || !strings.EqualFold(h[:7], "Bearer ") {
+		return "", false
+	}
+	token := strings.TrimSpace(h[7:])
+	return token, token != ""
+}
+
+func keyMatchesMethod(key crypto.PublicKey, method jwt.SigningMethod) bool {
+	switch method.(type) {
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		_, ok := key.(*rsa.PublicKey)
+		return ok
+	case *jwt.SigningMethodECDSA:
+		_, ok := key.(*ecdsa.PublicKey)
+		return ok
+	}
+	return false
+}
+
+// claimValue looks up a possibly dotted claim path such as realm_access.roles
+func claimValue(claims jwt.MapClaims, path string) interface{} {
+	var cur interface{} = map[string]interface{}(claims)
+	for _, part := range strings.Split(path, ".") {
+		m, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		cur = m[part]
+	}
+	return cur
+}
+
+func claimString(claims jwt.MapClaims, path string) string {
+	s, _ := claimValue(claims, path).(string)
+	return s
+}
+
+// claimStrings accepts a JSON array of strings or a space separated string
+func claimStrings(claims jwt.MapClaims, path string) []string {
+	switch v := claimValue(claims, path).(type) {
+	case []interface{}:
+		out := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok && s != "" {
+				out = append(out, s)
+			}
+		}
+		return out
+	case string:
+		return strings.Fields(v)
+	}
+	return nil
+}
@@ -0,0 +1,366 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/0x-Singularity/Augury/identity"
+	"github.com/0x-Singularity/Augury/rbac"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testIssuer   = "https://idp.example.com"
+	testAudience = "augury"
+)
+
+var testKey, _ = rsa.GenerateKey(rand.Reader, 2048)
+
+// sign issues a token signed with testKey; extra claims override the defaults
+func sign(t *testing.T, extra jwt.MapClaims) string {
+	t.Helper()
+	claims := jwt.MapClaims{
+		"iss":                testIssuer,
+		"aud":                testAudience,
+		"sub":                "00u123",
+		"preferred_username": "alice",
+		"email":              "alice@example.com",
+		"iat":                time.Now().Unix(),
+		"exp":                time.Now().Add(time.Hour).Unix(),
+	}
+	for k, v := range extra {
+		if v == nil {
+			delete(claims, k)
+		} else {
+			claims[k] = v
+		}
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "test"
+	s, err := token.SignedString(testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func newTestAuth(t *testing.T) *Authenticator {
+	t.Helper()
+	a, err := New(Config{
+		Keys:     StaticKey{PublicKey: &testKey.PublicKey},
+		Issuer:   testIssuer,
+		Audience: testAudience,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+// serve runs a request through the middleware and returns the status and the identity the handler saw
+func serve(a *Authenticator, header http.Header) (int, identity.Identity) {
+	var seen identity.Identity
+	h := a.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen, _ = identity.FromContext(r.Context())
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/api/ioc/pdns", nil)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	return rr.Code, seen
+}
+
+func bearer(token string) http.Header {
+	return http.Header{"Authorization": {"Bearer " + token}}
+}
+
+func TestMiddleware_ValidToken(t *testing.T) {
+	a := newTestAuth(t)
+	code, id := serve(a, bearer(sign(t, jwt.MapClaims{"roles": []string{"analyst"}})))
+	if code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	if id.Name != "alice" || id.Subject != "00u123" || id.Method != ModeJWT {
+		t.Errorf("unexpected identity %+v", id)
+	}
+	if len(id.Roles) != 1 || id.Roles[0] != "analyst" {
+		t.Errorf("unexpected roles %v", id.Roles)
+	}
+}
+
+func TestMiddleware_Rejects(t *testing.T) {
+	a := newTestAuth(t)
+	otherKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	forged, _ := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss": testIssuer, "aud": testAudience, "sub": "mallory", "exp": time.Now().Add(time.Hour).Unix(),
+	}).SignedString(otherKey)
+	hmac, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"iss": testIssuer, "aud": testAudience, "sub": "mallory", "exp": time.Now().Add(time.Hour).Unix(),
+	}).SignedString([]byte("secret"))
+
+	tests := map[string]http.Header{
+		"no credentials":       {},
+		"spoofed header":       {"X-User-Name": {"alice"}},
+		"not bearer":           {"Authorization": {"Basic YWxpY2U6cGFzcw=="}},
+		"garbage":              bearer("not.a.jwt"),
+		"expired":              bearer(sign(t, jwt.MapClaims{"exp": time.Now().Add(-time.Hour).Unix()})),
+		"no expiry":            bearer(sign(t, jwt.MapClaims{"exp": nil})),
+		"wrong issuer":         bearer(sign(t, jwt.MapClaims{"iss": "https://evil.example.com"})),
+		"wrong audience":       bearer(sign(t, jwt.MapClaims{"aud": "someone-else"})),
+		"wrong key":            bearer(forged),
+		"hmac with public key": bearer(hmac),
+	}
+	for name, header := range tests {
+		if code, _ := serve(a, header); code != http.StatusUnauthorized {
+			t.Errorf("%s: expected 401, got %d", name, code)
+		}
+	}
+}
+
+func TestMiddleware_Preflight(t *testing.T) {
+	a := newTestAuth(t)
+	called := false
+	h := a.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { called = true }))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodOptions, "/api/ioc/extract", nil))
+	if !called {
+		t.Error("expected OPTIONS to pass through without credentials")
+	}
+}
+
+func TestMiddleware_HeaderMode(t *testing.T) {
+	a, err := New(Config{Mode: ModeHeader})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code, id := serve(a, http.Header{"X-User-Name": {"bob"}}); code != http.StatusOK || id.Name != "bob" || id.Method != ModeHeader {
+		t.Errorf("unexpected result %d %+v", code, id)
+	}
+	if _, id := serve(a, http.Header{"X-User-Name": {"bob"}, "X-User-Roles": {"analyst, admin"}}); len(id.Roles) != 2 || id.Roles[1] != "admin" {
+		t.Errorf("expected roles from the header, got %+v", id)
+	}
+	if _, id := serve(a, http.Header{}); id.Name != identity.Anonymous {
+		t.Errorf("expected anonymous user, got %+v", id)
+	}
+}
+
+func TestAuthenticate_DefaultRole(t *testing.T) {
+	a, err := New(Config{Mode: ModeHeader, DefaultRole: rbac.Analyst})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, id := serve(a, http.Header{"X-User-Name": {"bob"}, "X-User-Roles": {"auditor"}}); len(id.Roles) != 2 || id.Roles[1] != "analyst" {
+		t.Errorf("expected the default role to be added, got %v", id.Roles)
+	}
+	if _, id := serve(a, http.Header{"X-User-Name": {"bob"}, "X-User-Roles": {"viewer"}}); len(id.Roles) != 1 {
+		t.Errorf("expected a recognised role to be kept as is, got %v", id.Roles)
+	}
+}
+
+// keyVerifier accepts one API key
+type keyVerifier string
+
+func (k keyVerifier) Verify(_ context.Context, key string) (identity.Identity, error) {
+	if key != string(k) {
+		return identity.Identity{}, errors.New("invalid api key")
+	}
+	return identity.Identity{Name: "soar-bot", Method: "api_key", Scopes: []string{"/ioc/*"}}, nil
+}
+
+func TestMiddleware_APIKey(t *testing.T) {
+	a, err := New(Config{Keys: StaticKey{PublicKey: &testKey.PublicKey}, APIKeys: keyVerifier("aug_1234abcd_secret")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, header := range []http.Header{
+		{"X-Api-Key": {"aug_1234abcd_secret"}},
+		bearer("aug_1234abcd_secret"),
+	} {
+		if code, id := serve(a, header); code != http.StatusOK || id.Name != "soar-bot" {
+			t.Errorf("%v: unexpected result %d %+v", header, code, id)
+		}
+	}
+	if code, _ := serve(a, http.Header{"X-Api-Key": {"aug_1234abcd_wrong"}}); code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for a wrong key, got %d", code)
+	}
+	if code, id := serve(a, bearer(sign(t, nil))); code != http.StatusOK || id.Method != ModeJWT {
+		t.Errorf("expected JWTs to keep working, got %d %+v", code, id)
+	}
+}
+
+func TestNew_RequiresKeysInJWTMode(t *testing.T) {
+	if _, err := New(Config{}); err == nil {
+		t.Error("expected an error without a key source")
+	}
+	if _, err := New(Config{Mode: "magic"}); err == nil {
+		t.Error("expected an error for an unknown mode")
+	}
+}
+
+func TestVerify_ClaimOptions(t *testing.T) {
+	a, _ := New(Config{
+		Keys:       StaticKey{PublicKey: &testKey.PublicKey},
+		UserClaim:  "email",
+		RolesClaim: "realm_access.roles",
+	})
+	id, err := a.Verify(context.Background(), sign(t, jwt.MapClaims{
+		"realm_access": map[string]interface{}{"roles": []string{"admin", "viewer"}},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id.Name != "alice@example.com" || len(id.Roles) != 2 || id.Roles[0] != "admin" {
+		t.Errorf("unexpected identity %+v", id)
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	b64 := func(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+
+	var fetches int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{
+			{"kid": "test", "kty": "RSA", "use": "sig",
+				"n": b64(testKey.N.Bytes()), "e": b64(big.NewInt(int64(testKey.E)).Bytes())},
+			{"kid": "ec", "kty": "EC", "crv": "P-256", "x": b64(ecKey.X.Bytes()), "y": b64(ecKey.Y.Bytes())},
+		}})
+	}))
+	defer srv.Close()
+
+	a, _ := New(Config{Keys: NewJWKS(srv.URL), Issuer: testIssuer})
+	if _, err := a.Verify(context.Background(), sign(t, nil)); err != nil {
+		t.Fatalf("rsa token: %v", err)
+	}
+
+	ecToken := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+		"iss": testIssuer, "sub": "carol", "exp": time.Now().Add(time.Hour).Unix(),
+	})
+	ecToken.Header["kid"] = "ec"
+	raw, _ := ecToken.SignedString(ecKey)
+	if id, err := a.Verify(context.Background(), raw); err != nil || id.Name != "carol" {
+		t.Fatalf("ec token: %v %+v", err, id)
+	}
+
+	// An unknown kid triggers at most one refetch per MinRefresh
+	unknown := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{"sub": "x", "exp": time.Now().Add(time.Hour).Unix()})
+	unknown.Header["kid"] = "rotated"
+	rawUnknown, _ := unknown.SignedString(testKey)
+	for i := 0; i < 3; i++ {
+		a.Verify(context.Background(), rawUnknown)
+	}
+	if fetches != 1 {
+		t.Errorf("expected the JWKS to be fetched once, got %d", fetches)
+	}
+}
+
+func TestJWKS_NoKid(t *testing.T) {
+	b64 := func(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{
+			{"kty": "RSA", "n": b64(testKey.N.Bytes()), "e": b64(big.NewInt(int64(testKey.E)).Bytes())},
+		}})
+	}))
+	defer srv.Close()
+
+	a, _ := New(Config{Keys: NewJWKS(srv.URL), Issuer: testIssuer})
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss": testIssuer, "sub": "dave", "exp": time.Now().Add(time.Hour).Unix(),
+	})
+	raw, _ := token.SignedString(testKey)
+	// The second token finds the keys loaded and must still match the lone key
+	for i := 0; i < 2; i++ {
+		if _, err := a.Verify(context.Background(), raw); err != nil {
+			t.Fatalf("token %d without kid: %v", i+1, err)
+		}
+	}
+}
+
+func TestJWKS_SlowRefreshDoesNotBlockKnownKeys(t *testing.T) {
+	b64 := func(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+	release := make(chan struct{})
+	var fetches atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fetches.Add(1) > 1 {
+			<-release
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{
+			{"kid": "test", "kty": "RSA", "n": b64(testKey.N.Bytes()), "e": b64(big.NewInt(int64(testKey.E)).Bytes())},
+		}})
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	keys := NewJWKS(srv.URL)
+	keys.MinRefresh = 0
+	if _, err := keys.Key(context.Background(), "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	// A token with an unknown kid starts a refetch that hangs...
+	go keys.Key(context.Background(), "rotated")
+	for fetches.Load() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	// ...while tokens with a cached kid are still verified
+	done := make(chan error, 1)
+	go func() {
+		_, err := keys.Key(context.Background(), "test")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("a known key waited for the refetch")
+	}
+}
+
+func TestJWKS_FailedFetchIsRetried(t *testing.T) {
+	b64 := func(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+	var fetches atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fetches.Add(1) == 1 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{
+			{"kid": "test", "kty": "RSA", "n": b64(testKey.N.Bytes()), "e": b64(big.NewInt(int64(testKey.E)).Bytes())},
+		}})
+	}))
+	defer srv.Close()
+
+	keys := NewJWKS(srv.URL)
+	keys.RetryFailed = 20 * time.Millisecond
+	if _, err := keys.Key(context.Background(), "test"); err == nil {
+		t.Fatal("expected the failed fetch to be reported")
+	}
+	if _, err := keys.Key(context.Background(), "test"); err == nil || fetches.Load() != 1 {
+		t.Fatalf("expected the failure to be remembered without refetching, got %v after %d fetches", err, fetches.Load())
+	}
+
+	// The failure doesn't hold off the next fetch for MinRefresh, and a caller that has
+	// already gone away still gets the set loaded
+	time.Sleep(30 * time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := keys.Key(ctx, "test"); err != nil {
+		t.Fatalf("expected the key after the provider recovered, got %v", err)
+	}
+}
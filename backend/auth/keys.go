@@ -0,0 +1,274 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// KeySource finds the key that verifies a token signed with key ID kid
+type KeySource interface {
+	Key(ctx context.Context, kid string) (crypto.PublicKey, error)
+}
+
+// StaticKey verifies every token with one key, whatever its kid. It is meant for a
+// locally configured signing key and for tests.
+type StaticKey struct {
+	PublicKey crypto.PublicKey
+}
+
+// Key implements KeySource
+func (s StaticKey) Key(context.Context, string) (crypto.PublicKey, error) {
+	return s.PublicKey, nil
+}
+
+// LoadPublicKeyPEM reads an RSA or ECDSA public key (PKIX "PUBLIC KEY" or a certificate) from a PEM file
+func LoadPublicKeyPEM(path string) (crypto.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data", path)
+	}
+	switch block.Type {
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return cert.PublicKey, nil
+	default:
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return key, nil
+	}
+}
+
+// JWKS fetches signing keys from an OIDC provider's JSON Web Key Set. Keys are cached
+// and the set is refetched when a token names a kid we have not seen, at most once per
+// MinRefresh so a flood of bogus tokens can't hammer the provider. A failed refetch is
+// retried after RetryFailed instead. Tokens with a cached kid never wait for a refetch.
+type JWKS struct {
+	URL         string
+	Client      *http.Client
+	MinRefresh  time.Duration
+	RetryFailed time.Duration
+
+	refreshMu sync.Mutex   // held for the whole refetch, so only one runs at a time
+	mu        sync.RWMutex // guards the fields below
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time // last successful fetch
+	failedAt  time.Time // last failed fetch, if failure is set
+	failure   error
+}
+
+// NewJWKS returns a key source for the JWKS at url
+func NewJWKS(url string) *JWKS {
+	return &JWKS{URL: url, Client: &http.Client{Timeout: 10 * time.Second}, MinRefresh: time.Minute, RetryFailed: 5 * time.Second}
+}
+
+// Key implements KeySource
+func (j *JWKS) Key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	if key, ok := j.cached(kid); ok {
+		return key, nil
+	}
+
+	j.refreshMu.Lock()
+	defer j.refreshMu.Unlock()
+	// Another request may have refetched the set while this one waited
+	if key, ok := j.cached(kid); ok {
+		return key, nil
+	}
+	j.mu.RLock()
+	recent := time.Since(j.fetchedAt) < j.MinRefresh
+	failure := j.failure
+	failing := failure != nil && time.Since(j.failedAt) < j.RetryFailed
+	j.mu.RUnlock()
+	if failing {
+		return nil, failure
+	}
+	if recent {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+	if err := j.refresh(ctx); err != nil {
+		return nil, err
+	}
+	if key, ok := j.cached(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown key id %q", kid)
+}
+
+// cached returns the key for kid from the last fetched set
+func (j *JWKS) cached(kid string) (crypto.PublicKey, bool) {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	if key, ok := j.keys[kid]; ok {
+		return key, true
+	}
+	// Providers with a single key often leave kid out of the token
+	if kid == "" && len(j.keys) == 1 {
+		for _, key := range j.keys {
+			return key, true
+		}
+	}
+	return nil, false
+}
+
+// jsonWebKey holds the JWK fields we understand
+type jsonWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// refresh refetches the set; the caller holds refreshMu. Only a successful fetch counts
+// towards MinRefresh; a failed one is remembered for RetryFailed.
+func (j *JWKS) refresh(ctx context.Context) error {
+	// The set serves every request, so the one that triggered the fetch going away must not
+	// cancel it; the client's timeout bounds it instead
+	keys, err := j.fetch(context.WithoutCancel(ctx))
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if err != nil {
+		j.failedAt, j.failure = time.Now(), err
+		return err
+	}
+	j.keys, j.fetchedAt, j.failure = keys, time.Now(), nil
+	return nil
+}
+
+// fetch downloads the set and returns its signing keys by kid
+func (j *JWKS) fetch(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, j.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := j.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetch jwks: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch jwks: status %d", resp.StatusCode)
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, fmt.Errorf("decode jwks: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			continue // skip key types we don't support rather than failing the whole set
+		}
+		keys[k.Kid] = key
+	}
+	return keys, nil
+}
+
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := b64Int(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := b64Int(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := b64Int(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := b64Int(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+func b64Int(s string) (*big.Int, error) {
+	if s == "" {
+		return nil, errors.New("missing key component")
+	}
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// discoverJWKS reads jwks_uri from the issuer's OpenID configuration
+func discoverJWKS(ctx context.Context, issuer string) (string, error) {
+	url := strings.TrimSuffix(issuer, "/") + "/.well-known/openid-configuration"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := (&http.Client{Timeout: 10 * time.Second}).Do(req)
+	if err != nil {
+		return "", fmt.Errorf("oidc discovery: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("oidc discovery: status %d", resp.StatusCode)
+	}
+	var doc struct {
+		JWKSURI string `json:"jwks_uri"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return "", fmt.Errorf("oidc discovery: %w", err)
+	}
+	if doc.JWKSURI == "" {
+		return "", errors.New("oidc discovery: no jwks_uri")
+	}
+	return doc.JWKSURI, nil
+}
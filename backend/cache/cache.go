@@ -0,0 +1,190 @@
+// Package cache is a small in-memory cache with a size limit, per-entry TTL and
+// hit/miss statistics. It is safe for concurrent use.
+//
+// Entries are evicted least recently used first once the cache is full, and expired
+// entries are dropped the next time they are looked up or when room is needed.
+package cache
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// Options configures a Cache. Zero values fall back to the defaults.
+type Options struct {
+	// MaxEntries bounds the number of entries kept
+	MaxEntries int
+	// TTL is how long an entry stays valid after it is stored
+	TTL time.Duration
+}
+
+// Defaults used when Options leaves a field unset
+const (
+	DefaultMaxEntries = 1024
+	DefaultTTL        = 5 * time.Minute
+)
+
+// Stats is a snapshot of a cache's counters
+type Stats struct {
+	Hits      uint64 `json:"hits"`
+	Misses    uint64 `json:"misses"`
+	Evictions uint64 `json:"evictions"`
+	Entries   int    `json:"entries"`
+}
+
+// HitRatio is hits over lookups, 0 when there were none
+func (s Stats) HitRatio() float64 {
+	total := s.Hits + s.Misses
+	if total == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(total)
+}
+
+// Cache maps string keys to values of type V
+type Cache[V any] struct {
+	mu         sync.Mutex
+	maxEntries int
+	ttl        time.Duration
+	ll         *list.List // front is most recently used
+	items      map[string]*list.Element
+	stats      Stats
+
+	now func() time.Time // swapped out in tests
+}
+
+type entry[V any] struct {
+	key     string
+	value   V
+	expires time.Time
+}
+
+// New returns an empty cache
+func New[V any](opts Options) *Cache[V] {
+	if opts.MaxEntries <= 0 {
+		opts.MaxEntries = DefaultMaxEntries
+	}
+	if opts.TTL <= 0 {
+		opts.TTL = DefaultTTL
+	}
+	return &Cache[V]{
+		maxEntries: opts.MaxEntries,
+		ttl:        opts.TTL,
+		ll:         list.New(),
+		items:      make(map[string]*list.Element),
+		now:        time.Now,
+	}
+}
+
+// Get returns the value stored under key, if it is present and has not expired
+func (c *Cache[V]) Get(key string) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		e := el.Value.(*entry[V])
+		if c.now().Before(e.expires) {
+			c.ll.MoveToFront(el)
+			c.stats.Hits++
+			return e.value, true
+		}
+		c.remove(el)
+	}
+	c.stats.Misses++
+	var zero V
+	return zero, false
+}
+
+// Set stores value under key, replacing any previous value and resetting its TTL
+func (c *Cache[V]) Set(key string, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expires := c.now().Add(c.ttl)
+	if el, ok := c.items[key]; ok {
+		e := el.Value.(*entry[V])
+		e.value, e.expires = value, expires
+		c.ll.MoveToFront(el)
+		return
+	}
+
+	c.items[key] = c.ll.PushFront(&entry[V]{key: key, value: value, expires: expires})
+	if c.ll.Len() > c.maxEntries {
+		c.evict()
+	}
+}
+
+// Delete drops key from the cache
+func (c *Cache[V]) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok {
+		c.remove(el)
+	}
+}
+
+// Purge empties the cache, keeping its statistics
+func (c *Cache[V]) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ll.Init()
+	c.items = make(map[string]*list.Element)
+}
+
+// Len returns the number of entries, including expired ones not yet dropped
+func (c *Cache[V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
+
+// Keys returns the current keys, most recently used first
+func (c *Cache[V]) Keys() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	keys := make([]string, 0, c.ll.Len())
+	for el := c.ll.Front(); el != nil; el = el.Next() {
+		keys = append(keys, el.Value.(*entry[V]).key)
+	}
+	return keys
+}
+
+// Stats returns a snapshot of the cache's counters
+func (c *Cache[V]) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.stats
+	s.Entries = c.ll.Len()
+	return s
+}
+
+// evict makes room for one entry: expired entries go first, then the least recently used one
+func (c *Cache[V]) evict() {
+	now := c.now()
+	for el := c.ll.Back(); el != nil; {
+		prev := el.Prev()
+		if !now.Before(el.Value.(*entry[V]).expires) {
+			c.remove(el)
+			c.stats.Evictions++
+		}
+		el = prev
+	}
+	for c.ll.Len() > c.maxEntries {
+		c.remove(c.ll.Back())
+		c.stats.Evictions++
+	}
+}
+
+func (c *Cache[V]) remove(el *list.Element) {
+	c.ll.Remove(el)
+	delete(c.items, el.Value.(*entry[V]).key)
+}
+
+// Key hashes arbitrary bytes (usually a marshalled payload) into a fixed size cache key
+func Key(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
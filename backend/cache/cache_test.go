@@ -0,0 +1,129 @@
+package cache
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock lets tests move time forward
+type fakeClock struct{ t time.Time }
+
+func (f *fakeClock) now() time.Time          { return f.t }
+func (f *fakeClock) advance(d time.Duration) { f.t = f.t.Add(d) }
+
+func newTestCache(max int, ttl time.Duration) (*Cache[int], *fakeClock) {
+	clock := &fakeClock{t: time.Unix(0, 0)}
+	c := New[int](Options{MaxEntries: max, TTL: ttl})
+	c.now = clock.now
+	return c, clock
+}
+
+func TestCache_GetSet(t *testing.T) {
+	c, _ := newTestCache(10, time.Minute)
+
+	if _, ok := c.Get("a"); ok {
+		t.Fatal("expected miss on empty cache")
+	}
+	c.Set("a", 1)
+	if v, ok := c.Get("a"); !ok || v != 1 {
+		t.Fatalf("expected hit with 1, got %v %v", v, ok)
+	}
+	c.Set("a", 2)
+	if v, _ := c.Get("a"); v != 2 {
+		t.Fatalf("expected overwrite to 2, got %v", v)
+	}
+
+	s := c.Stats()
+	if s.Hits != 2 || s.Misses != 1 || s.Entries != 1 {
+		t.Errorf("unexpected stats %+v", s)
+	}
+	if r := s.HitRatio(); r < 0.66 || r > 0.67 {
+		t.Errorf("expected hit ratio 2/3, got %v", r)
+	}
+}
+
+func TestCache_TTL(t *testing.T) {
+	c, clock := newTestCache(10, time.Minute)
+	c.Set("a", 1)
+
+	clock.advance(59 * time.Second)
+	if _, ok := c.Get("a"); !ok {
+		t.Fatal("expected entry to still be valid")
+	}
+	clock.advance(time.Second)
+	if _, ok := c.Get("a"); ok {
+		t.Fatal("expected entry to have expired")
+	}
+	if c.Len() != 0 {
+		t.Errorf("expected expired entry to be dropped, len %d", c.Len())
+	}
+}
+
+func TestCache_EvictsLeastRecentlyUsed(t *testing.T) {
+	c, _ := newTestCache(2, time.Minute)
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Get("a") // b is now the least recently used
+	c.Set("c", 3)
+
+	if _, ok := c.Get("b"); ok {
+		t.Error("expected b to be evicted")
+	}
+	for _, k := range []string{"a", "c"} {
+		if _, ok := c.Get(k); !ok {
+			t.Errorf("expected %s to be kept", k)
+		}
+	}
+	if s := c.Stats(); s.Evictions != 1 || s.Entries != 2 {
+		t.Errorf("unexpected stats %+v", s)
+	}
+}
+
+func TestCache_EvictsExpiredFirst(t *testing.T) {
+	c, clock := newTestCache(2, time.Minute)
+	c.Set("old", 1)
+	clock.advance(30 * time.Second)
+	c.Set("new", 2)
+	c.Get("old") // most recently used, but expires first
+	clock.advance(31 * time.Second)
+	c.Set("newer", 3)
+
+	if _, ok := c.Get("new"); !ok {
+		t.Error("expected unexpired entry to be kept")
+	}
+	if c.Len() != 2 {
+		t.Errorf("expected 2 entries, got %d", c.Len())
+	}
+}
+
+func TestCache_Concurrent(t *testing.T) {
+	c := New[int](Options{MaxEntries: 50})
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				key := fmt.Sprintf("k%d", (g*i)%80)
+				c.Set(key, i)
+				c.Get(key)
+			}
+		}(g)
+	}
+	wg.Wait()
+	if c.Len() > 50 {
+		t.Errorf("cache grew past its limit: %d", c.Len())
+	}
+}
+
+func TestKey(t *testing.T) {
+	a, b := Key([]byte(`{"data":[]}`)), Key([]byte(`{"data":[1]}`))
+	if len(a) != 64 || a == b {
+		t.Errorf("unexpected keys %q %q", a, b)
+	}
+	if a != Key([]byte(`{"data":[]}`)) {
+		t.Error("expected Key to be deterministic")
+	}
+}
@@ -0,0 +1,721 @@
+// Package config loads Augury's settings once at startup: defaults, then an optional
+// YAML file (AUGURY_CONFIG), then environment variables, which win. Load validates the
+// result and reports every problem at once, so a bad deployment fails before it serves.
+//
+// The environment variables are the ones Augury has always read (DB_HOST, FAKEULA_API_URL,
+// AUGURY_RATE_LIMIT, ...), so existing .env files keep working. See config.example.yaml
+// for the file format.
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/0x-Singularity/Augury/cache"
+	"github.com/0x-Singularity/Augury/cors"
+	"github.com/0x-Singularity/Augury/extractor"
+	"github.com/0x-Singularity/Augury/fakeula"
+	"github.com/0x-Singularity/Augury/ratelimit"
+	"github.com/0x-Singularity/Augury/rbac"
+	"gopkg.in/yaml.v3"
+)
+
+// PathEnv names the environment variable holding the config file path
+const PathEnv = "AUGURY_CONFIG"
+
+// Config is every setting Augury reads at startup
+type Config struct {
+	Server     Server     `yaml:"server"`
+	Database   Database   `yaml:"database"`
+	Fakeula    Fakeula    `yaml:"fakeula"`
+	Enrichment Enrichment `yaml:"enrichment"`
+	Cache      Cache      `yaml:"cache"`
+	Auth       Auth       `yaml:"auth"`
+	Tracing    Tracing    `yaml:"tracing"`
+	Logging    Logging    `yaml:"logging"`
+	CORS       CORS       `yaml:"cors"`
+}
+
+// Server configures the HTTP listener and per-caller limits
+type Server struct {
+	Port       int    `yaml:"port"`        // PORT
+	TrustProxy bool   `yaml:"trust_proxy"` // AUGURY_TRUST_PROXY: believe X-Forwarded-For
+	RateLimit  string `yaml:"rate_limit"`  // AUGURY_RATE_LIMIT: per API caller, RATE/UNIT[:BURST] or "off"
+
+	// Connection timeouts (see http.Server). WriteTimeout bounds a whole response, so it
+	// must cover the slowest extraction; streamed extractions are exempt.
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout"` // AUGURY_READ_HEADER_TIMEOUT
+	ReadTimeout       time.Duration `yaml:"read_timeout"`        // AUGURY_READ_TIMEOUT
+	WriteTimeout      time.Duration `yaml:"write_timeout"`       // AUGURY_WRITE_TIMEOUT
+	IdleTimeout       time.Duration `yaml:"idle_timeout"`        // AUGURY_IDLE_TIMEOUT
+	// ShutdownTimeout (AUGURY_SHUTDOWN_TIMEOUT) is how long in-flight requests get to
+	// finish after SIGTERM or SIGINT before their connections are closed
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+}
+
+// Database configures the Postgres connection pool
+type Database struct {
+	// Disabled (AUGURY_SKIP_DB) runs without Postgres: lookups are not logged, cached or
+	// audited, and the history endpoints are unavailable. For tests and demos only.
+	Disabled bool `yaml:"disabled"`
+
+	Host     string `yaml:"host"`     // DB_HOST
+	Port     int    `yaml:"port"`     // DB_PORT
+	User     string `yaml:"user"`     // DB_USER
+	Password string `yaml:"password"` // DB_PASS
+	Name     string `yaml:"name"`     // DB_NAME
+	SSLMode  string `yaml:"sslmode"`  // DB_SSLMODE
+
+	MaxOpenConns    int           `yaml:"max_open_conns"`     // DB_MAX_OPEN_CONNS
+	MaxIdleConns    int           `yaml:"max_idle_conns"`     // DB_MAX_IDLE_CONNS
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time"` // DB_CONN_MAX_IDLE_TIME
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime"`  // DB_CONN_MAX_LIFETIME
+
+	// AutoMigrate (AUGURY_AUTO_MIGRATE) applies pending migrations on startup;
+	// otherwise the schema version is only checked
+	AutoMigrate bool `yaml:"auto_migrate"`
+}
+
+// Fakeula configures the upstream client
+type Fakeula struct {
+	URL        string        `yaml:"url"`         // FAKEULA_API_URL
+	User       string        `yaml:"user"`        // FAKEULA_USER
+	Password   string        `yaml:"password"`    // FAKEULA_PASS
+	Timeout    time.Duration `yaml:"timeout"`     // FAKEULA_TIMEOUT, per attempt
+	MaxRetries int           `yaml:"max_retries"` // FAKEULA_MAX_RETRIES
+
+	// RateLimit (FAKEULA_RATE_LIMIT) limits every source; SourceRateLimits
+	// (FAKEULA_RATE_LIMIT_<SOURCE>) override it per source. See fakeula.NewLimits.
+	RateLimit        string            `yaml:"rate_limit"`
+	SourceRateLimits map[string]string `yaml:"source_rate_limits"`
+	// MaxWait (FAKEULA_RATE_LIMIT_MAX_WAIT) is the longest a call waits for a token
+	MaxWait time.Duration `yaml:"max_wait"`
+	// Required (FAKEULA_REQUIRED) makes FAKEula a hard dependency: /readyz fails while it is
+	// unreachable. Otherwise it is reported but the instance stays in rotation.
+	Required bool `yaml:"required"`
+}
+
+// Enrichment configures extraction and the worker pools of /api/ioc/extract
+type Enrichment struct {
+	IOCWorkers    int    `yaml:"ioc_workers"`    // AUGURY_IOC_WORKERS: IOCs enriched at once
+	SourceWorkers int    `yaml:"source_workers"` // AUGURY_SOURCE_WORKERS: sources queried at once per IOC
+	Extractor     string `yaml:"extractor"`      // AUGURY_EXTRACTOR: native or fakeula
+	// InternalHostPrefixes (AUGURY_INTERNAL_HOST_PREFIXES, comma separated) marks tokens
+	// such as desk1234 as hostnames. Nil keeps the extractor's defaults.
+	InternalHostPrefixes []string `yaml:"internal_host_prefixes"`
+}
+
+// Cache configures the parsed-result cache and the upstream response cache
+type Cache struct {
+	ParseSize int           `yaml:"parse_size"` // AUGURY_PARSE_CACHE_SIZE, entries
+	ParseTTL  time.Duration `yaml:"parse_ttl"`  // AUGURY_PARSE_CACHE_TTL
+
+	// ResponseTTL (AUGURY_CACHE_TTL) applies to sources without a lifetime of their own;
+	// SourceTTLs (AUGURY_CACHE_TTL_<SOURCE>) override the built-in per-source lifetimes.
+	// 0 turns caching off.
+	ResponseTTL time.Duration            `yaml:"response_ttl"`
+	SourceTTLs  map[string]time.Duration `yaml:"source_ttls"`
+	// PurgeInterval (AUGURY_CACHE_PURGE_INTERVAL) is how often responses past their
+	// lifetime are deleted from the database
+	PurgeInterval time.Duration `yaml:"purge_interval"`
+}
+
+// Auth configures API authentication
+type Auth struct {
+	Mode          string `yaml:"mode"`            // AUGURY_AUTH_MODE: jwt or header (development only)
+	Issuer        string `yaml:"issuer"`          // AUGURY_OIDC_ISSUER, also used for JWKS discovery
+	Audience      string `yaml:"audience"`        // AUGURY_OIDC_AUDIENCE
+	JWKSURL       string `yaml:"jwks_url"`        // AUGURY_OIDC_JWKS_URL, overrides discovery
+	PublicKeyFile string `yaml:"public_key_file"` // AUGURY_JWT_PUBLIC_KEY_FILE, instead of a JWKS
+	UserClaim     string `yaml:"user_claim"`      // AUGURY_JWT_USER_CLAIM
+	RolesClaim    string `yaml:"roles_claim"`     // AUGURY_JWT_ROLES_CLAIM
+	// DefaultRole (AUGURY_DEFAULT_ROLE) is given to callers without a recognised role
+	DefaultRole string `yaml:"default_role"`
+}
+
+// Tracing configures OpenTelemetry tracing
+type Tracing struct {
+	// Exporter (AUGURY_TRACING_EXPORTER) is otlp, stdout or none. Left empty, spans go to
+	// the OTLP endpoint when one is set and to stdout otherwise.
+	Exporter string `yaml:"exporter"`
+	// Endpoint (OTEL_EXPORTER_OTLP_ENDPOINT) is the collector's OTLP/HTTP base URL;
+	// spans are sent to its /v1/traces
+	Endpoint    string `yaml:"endpoint"`
+	ServiceName string `yaml:"service_name"` // OTEL_SERVICE_NAME
+	// SampleRatio (AUGURY_TRACING_SAMPLE_RATIO) is the share of new traces recorded;
+	// requests arriving with a sampled trace context are always recorded
+	SampleRatio float64 `yaml:"sample_ratio"`
+}
+
+// Tracing exporters
+const (
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+	ExporterNone   = "none"
+)
+
+// Logging configures the log output
+type Logging struct {
+	Level  string `yaml:"level"`  // AUGURY_LOG_LEVEL: debug, info, warn or error
+	Format string `yaml:"format"` // AUGURY_LOG_FORMAT: json, or text for local development
+}
+
+// Log formats
+const (
+	LogFormatJSON = "json"
+	LogFormatText = "text"
+)
+
+// CORS configures which web pages may call the API from a browser (see package cors).
+// The lists are comma separated in the environment.
+type CORS struct {
+	// AllowedOrigins (AUGURY_CORS_ALLOWED_ORIGINS) are exact origins or patterns such as
+	// https://*.example.com. Empty allows same-origin pages only.
+	AllowedOrigins   []string      `yaml:"allowed_origins"`
+	AllowedMethods   []string      `yaml:"allowed_methods"`   // AUGURY_CORS_ALLOWED_METHODS
+	AllowedHeaders   []string      `yaml:"allowed_headers"`   // AUGURY_CORS_ALLOWED_HEADERS
+	ExposedHeaders   []string      `yaml:"exposed_headers"`   // AUGURY_CORS_EXPOSED_HEADERS: readable by the page
+	AllowCredentials bool          `yaml:"allow_credentials"` // AUGURY_CORS_ALLOW_CREDENTIALS: cookies and client certificates
+	MaxAge           time.Duration `yaml:"max_age"`           // AUGURY_CORS_MAX_AGE: preflight answers are cached this long
+}
+
+// Default returns the settings used when neither the file nor the environment sets them
+func Default() *Config {
+	return &Config{
+		Server: Server{
+			Port:              8080,
+			RateLimit:         ratelimit.DefaultAPILimit,
+			ReadHeaderTimeout: 10 * time.Second,
+			ReadTimeout:       30 * time.Second,
+			WriteTimeout:      2 * time.Minute,
+			IdleTimeout:       2 * time.Minute,
+			ShutdownTimeout:   30 * time.Second,
+		},
+		Database: Database{
+			Port:            5432,
+			SSLMode:         "disable",
+			MaxOpenConns:    20,
+			MaxIdleConns:    10,
+			ConnMaxIdleTime: 30 * time.Minute,
+			ConnMaxLifetime: 2 * time.Hour,
+			AutoMigrate:     true,
+		},
+		Fakeula: Fakeula{
+			Timeout:    fakeula.DefaultTimeout,
+			MaxRetries: fakeula.DefaultMaxRetries,
+			RateLimit:  fakeula.DefaultRateLimit,
+			MaxWait:    fakeula.DefaultMaxWait,
+		},
+		Enrichment: Enrichment{IOCWorkers: 8, SourceWorkers: 4, Extractor: extractor.BackendNative},
+		Cache:      Cache{ParseSize: cache.DefaultMaxEntries, ParseTTL: cache.DefaultTTL, ResponseTTL: 15 * time.Minute, PurgeInterval: time.Hour},
+		Auth:       Auth{Mode: "jwt", DefaultRole: string(rbac.Viewer)},
+		Tracing:    Tracing{ServiceName: "augury", SampleRatio: 1},
+		Logging:    Logging{Level: "info", Format: LogFormatJSON},
+		CORS: CORS{
+			AllowedOrigins: []string{"http://localhost:3000"}, // the development frontend
+			AllowedMethods: []string{"GET", "POST", "DELETE", "OPTIONS"},
+			AllowedHeaders: []string{"Content-Type", "Authorization", "X-User-Name", "X-User-Roles", "X-API-Key", "X-Request-ID"},
+			ExposedHeaders: []string{"Retry-After", "X-Request-ID"},
+			MaxAge:         10 * time.Minute,
+		},
+	}
+}
+
+// Load reads the file at path (skipped when path is empty), applies environment
+// overrides and validates the result
+func Load(path string) (*Config, error) {
+	return load(path, (*Config).Validate)
+}
+
+// LoadDatabase is Load for the migrate subcommand: only the database and logging
+// settings are validated, so migrations run without FAKEula credentials or auth settings
+func LoadDatabase(path string) (*Config, error) {
+	return load(path, (*Config).ValidateDatabase)
+}
+
+func load(path string, validate func(*Config) error) (*Config, error) {
+	cfg := Default()
+	if path != "" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("config: %w", err)
+		}
+		defer f.Close()
+		if err := cfg.decode(f); err != nil {
+			return nil, fmt.Errorf("config: %s: %w", path, err)
+		}
+	}
+	if err := cfg.applyEnv(os.Environ()); err != nil {
+		return nil, fmt.Errorf("config: %w", err)
+	}
+	if err := validate(cfg); err != nil {
+		return nil, fmt.Errorf("config: %w", err)
+	}
+	return cfg, nil
+}
+
+// decode reads YAML over the current settings. Unknown keys are errors, so a typo
+// doesn't silently leave a default in place.
+func (c *Config) decode(r io.Reader) error {
+	dec := yaml.NewDecoder(r)
+	dec.KnownFields(true)
+	if err := dec.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	return nil
+}
+
+//--------------------Environment overrides----------------------------------------------------------------
+
+// envReader reads overrides from a snapshot of the environment, collecting every invalid value
+type envReader struct {
+	vars map[string]string
+	errs []error
+}
+
+func (e *envReader) lookup(key string) (string, bool) {
+	v, ok := e.vars[key]
+	return v, ok
+}
+
+func (e *envReader) str(key string, dst *string) {
+	if v, ok := e.lookup(key); ok && v != "" {
+		*dst = v
+	}
+}
+
+func (e *envReader) int(key string, dst *int) {
+	if v, ok := e.lookup(key); ok && v != "" {
+		n, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil {
+			e.errs = append(e.errs, fmt.Errorf("%s: %q is not a whole number", key, v))
+			return
+		}
+		*dst = n
+	}
+}
+
+func (e *envReader) bool(key string, dst *bool) {
+	if v, ok := e.lookup(key); ok && v != "" {
+		b, err := strconv.ParseBool(strings.TrimSpace(v))
+		if err != nil {
+			e.errs = append(e.errs, fmt.Errorf("%s: %q is not 1/0 or true/false", key, v))
+			return
+		}
+		*dst = b
+	}
+}
+
+func (e *envReader) float(key string, dst *float64) {
+	if v, ok := e.lookup(key); ok && v != "" {
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil {
+			e.errs = append(e.errs, fmt.Errorf("%s: %q is not a number", key, v))
+			return
+		}
+		*dst = f
+	}
+}
+
+func (e *envReader) duration(key string, dst *time.Duration) {
+	if v, ok := e.lookup(key); ok && v != "" {
+		d, err := time.ParseDuration(strings.TrimSpace(v))
+		if err != nil {
+			e.errs = append(e.errs, fmt.Errorf("%s: %q is not a duration such as 30s or 2h", key, v))
+			return
+		}
+		*dst = d
+	}
+}
+
+// list reads a comma separated list. Set but empty means an empty list.
+func (e *envReader) list(key string, dst *[]string) {
+	if raw, ok := e.lookup(key); ok {
+		*dst = []string{}
+		for _, v := range strings.Split(raw, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				*dst = append(*dst, v)
+			}
+		}
+	}
+}
+
+// suffixed returns the variables named prefix+SUFFIX, keyed by lowercased suffix
+func (e *envReader) suffixed(prefix string) map[string]string {
+	out := make(map[string]string)
+	for key, v := range e.vars {
+		if suffix, ok := strings.CutPrefix(key, prefix); ok && suffix != "" && v != "" {
+			out[strings.ToLower(suffix)] = v
+		}
+	}
+	return out
+}
+
+// applyEnv overrides settings with the environment variables in environ (KEY=value)
+func (c *Config) applyEnv(environ []string) error {
+	e := &envReader{vars: make(map[string]string, len(environ))}
+	for _, kv := range environ {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			e.vars[k] = v
+		}
+	}
+
+	e.int("PORT", &c.Server.Port)
+	e.bool("AUGURY_TRUST_PROXY", &c.Server.TrustProxy)
+	e.str("AUGURY_RATE_LIMIT", &c.Server.RateLimit)
+	e.duration("AUGURY_READ_HEADER_TIMEOUT", &c.Server.ReadHeaderTimeout)
+	e.duration("AUGURY_READ_TIMEOUT", &c.Server.ReadTimeout)
+	e.duration("AUGURY_WRITE_TIMEOUT", &c.Server.WriteTimeout)
+	e.duration("AUGURY_IDLE_TIMEOUT", &c.Server.IdleTimeout)
+	e.duration("AUGURY_SHUTDOWN_TIMEOUT", &c.Server.ShutdownTimeout)
+
+	e.bool("AUGURY_SKIP_DB", &c.Database.Disabled)
+	e.str("DB_HOST", &c.Database.Host)
+	e.int("DB_PORT", &c.Database.Port)
+	e.str("DB_USER", &c.Database.User)
+	e.str("DB_PASS", &c.Database.Password)
+	e.str("DB_NAME", &c.Database.Name)
+	e.str("DB_SSLMODE", &c.Database.SSLMode)
+	e.int("DB_MAX_OPEN_CONNS", &c.Database.MaxOpenConns)
+	e.int("DB_MAX_IDLE_CONNS", &c.Database.MaxIdleConns)
+	e.duration("DB_CONN_MAX_IDLE_TIME", &c.Database.ConnMaxIdleTime)
+	e.duration("DB_CONN_MAX_LIFETIME", &c.Database.ConnMaxLifetime)
+	e.bool("AUGURY_AUTO_MIGRATE", &c.Database.AutoMigrate)
+
+	e.str("FAKEULA_API_URL", &c.Fakeula.URL)
+	e.str("FAKEULA_USER", &c.Fakeula.User)
+	e.str("FAKEULA_PASS", &c.Fakeula.Password)
+	e.duration("FAKEULA_TIMEOUT", &c.Fakeula.Timeout)
+	e.int("FAKEULA_MAX_RETRIES", &c.Fakeula.MaxRetries)
+	e.str("FAKEULA_RATE_LIMIT", &c.Fakeula.RateLimit)
+	e.duration("FAKEULA_RATE_LIMIT_MAX_WAIT", &c.Fakeula.MaxWait)
+	e.bool("FAKEULA_REQUIRED", &c.Fakeula.Required)
+	for source, spec := range e.suffixed("FAKEULA_RATE_LIMIT_") {
+		if source == "max_wait" {
+			continue
+		}
+		if c.Fakeula.SourceRateLimits == nil {
+			c.Fakeula.SourceRateLimits = make(map[string]string)
+		}
+		c.Fakeula.SourceRateLimits[source] = spec
+	}
+
+	e.int("AUGURY_IOC_WORKERS", &c.Enrichment.IOCWorkers)
+	e.int("AUGURY_SOURCE_WORKERS", &c.Enrichment.SourceWorkers)
+	e.str("AUGURY_EXTRACTOR", &c.Enrichment.Extractor)
+	// Set but empty means no internal hostnames at all
+	e.list("AUGURY_INTERNAL_HOST_PREFIXES", &c.Enrichment.InternalHostPrefixes)
+
+	e.int("AUGURY_PARSE_CACHE_SIZE", &c.Cache.ParseSize)
+	e.duration("AUGURY_PARSE_CACHE_TTL", &c.Cache.ParseTTL)
+	e.duration("AUGURY_CACHE_TTL", &c.Cache.ResponseTTL)
+	e.duration("AUGURY_CACHE_PURGE_INTERVAL", &c.Cache.PurgeInterval)
+	for source := range e.suffixed("AUGURY_CACHE_TTL_") {
+		var ttl time.Duration
+		e.duration("AUGURY_CACHE_TTL_"+strings.ToUpper(source), &ttl)
+		if c.Cache.SourceTTLs == nil {
+			c.Cache.SourceTTLs = make(map[string]time.Duration)
+		}
+		c.Cache.SourceTTLs[source] = ttl
+	}
+
+	e.str("AUGURY_AUTH_MODE", &c.Auth.Mode)
+	e.str("AUGURY_OIDC_ISSUER", &c.Auth.Issuer)
+	e.str("AUGURY_OIDC_AUDIENCE", &c.Auth.Audience)
+	e.str("AUGURY_OIDC_JWKS_URL", &c.Auth.JWKSURL)
+	e.str("AUGURY_JWT_PUBLIC_KEY_FILE", &c.Auth.PublicKeyFile)
+	e.str("AUGURY_JWT_USER_CLAIM", &c.Auth.UserClaim)
+	e.str("AUGURY_JWT_ROLES_CLAIM", &c.Auth.RolesClaim)
+	e.str("AUGURY_DEFAULT_ROLE", &c.Auth.DefaultRole)
+
+	e.str("AUGURY_TRACING_EXPORTER", &c.Tracing.Exporter)
+	e.str("OTEL_EXPORTER_OTLP_ENDPOINT", &c.Tracing.Endpoint)
+	e.str("OTEL_SERVICE_NAME", &c.Tracing.ServiceName)
+	e.float("AUGURY_TRACING_SAMPLE_RATIO", &c.Tracing.SampleRatio)
+
+	e.str("AUGURY_LOG_LEVEL", &c.Logging.Level)
+	e.str("AUGURY_LOG_FORMAT", &c.Logging.Format)
+
+	e.list("AUGURY_CORS_ALLOWED_ORIGINS", &c.CORS.AllowedOrigins)
+	e.list("AUGURY_CORS_ALLOWED_METHODS", &c.CORS.AllowedMethods)
+	e.list("AUGURY_CORS_ALLOWED_HEADERS", &c.CORS.AllowedHeaders)
+	e.list("AUGURY_CORS_EXPOSED_HEADERS", &c.CORS.ExposedHeaders)
+	e.bool("AUGURY_CORS_ALLOW_CREDENTIALS", &c.CORS.AllowCredentials)
+	e.duration("AUGURY_CORS_MAX_AGE", &c.CORS.MaxAge)
+
+	return errors.Join(e.errs...)
+}
+
+//--------------------Validation---------------------------------------------------------------------------
+
+// Validate reports every invalid setting, naming each by its YAML path
+func (c *Config) Validate() error {
+	return c.validate(false)
+}
+
+// ValidateDatabase is Validate limited to the database and logging settings
+func (c *Config) ValidateDatabase() error {
+	return c.validate(true)
+}
+
+func (c *Config) validate(databaseOnly bool) error {
+	var errs []error
+	bad := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+	required := func(name, value string) {
+		if strings.TrimSpace(value) == "" {
+			bad("%s is required", name)
+		}
+	}
+	port := func(name string, p int) {
+		if p < 1 || p > 65535 {
+			bad("%s must be between 1 and 65535, got %d", name, p)
+		}
+	}
+	limit := func(name, spec string) {
+		if _, err := ratelimit.ParseLimit(spec); err != nil {
+			bad("%s: %v", name, err)
+		}
+	}
+	nonNegative := func(name string, d time.Duration) {
+		if d < 0 {
+			bad("%s must not be negative, got %s", name, d)
+		}
+	}
+	positive := func(name string, d time.Duration) {
+		if d <= 0 {
+			bad("%s must be positive, got %s", name, d)
+		}
+	}
+
+	if db := c.Database; !db.Disabled {
+		required("database.host", db.Host)
+		port("database.port", db.Port)
+		required("database.user", db.User)
+		required("database.password", db.Password)
+		required("database.name", db.Name)
+		if !slices.Contains([]string{"disable", "allow", "prefer", "require", "verify-ca", "verify-full"}, db.SSLMode) {
+			bad("database.sslmode %q is not a Postgres sslmode", db.SSLMode)
+		}
+		if db.MaxOpenConns < 1 {
+			bad("database.max_open_conns must be at least 1, got %d", db.MaxOpenConns)
+		}
+		if db.MaxIdleConns < 0 || db.MaxIdleConns > db.MaxOpenConns {
+			bad("database.max_idle_conns must be between 0 and max_open_conns (%d), got %d", db.MaxOpenConns, db.MaxIdleConns)
+		}
+		nonNegative("database.conn_max_idle_time", db.ConnMaxIdleTime)
+		nonNegative("database.conn_max_lifetime", db.ConnMaxLifetime)
+	}
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.Logging.Level)); err != nil {
+		bad("logging.level %q must be debug, info, warn or error", c.Logging.Level)
+	}
+	if f := c.Logging.Format; f != LogFormatJSON && f != LogFormatText {
+		bad("logging.format %q must be %s or %s", f, LogFormatJSON, LogFormatText)
+	}
+
+	if databaseOnly {
+		return errors.Join(errs...)
+	}
+
+	port("server.port", c.Server.Port)
+	limit("server.rate_limit", c.Server.RateLimit)
+	positive("server.read_header_timeout", c.Server.ReadHeaderTimeout)
+	positive("server.read_timeout", c.Server.ReadTimeout)
+	positive("server.write_timeout", c.Server.WriteTimeout)
+	positive("server.idle_timeout", c.Server.IdleTimeout)
+	positive("server.shutdown_timeout", c.Server.ShutdownTimeout)
+
+	f := c.Fakeula
+	if err := httpURL(f.URL); err != nil {
+		bad("fakeula.url: %v", err)
+	}
+	required("fakeula.user", f.User)
+	required("fakeula.password", f.Password)
+	positive("fakeula.timeout", f.Timeout)
+	if f.MaxRetries < 0 {
+		bad("fakeula.max_retries must not be negative, got %d", f.MaxRetries)
+	}
+	limit("fakeula.rate_limit", f.RateLimit)
+	for source, spec := range f.SourceRateLimits {
+		if !slices.Contains(fakeula.Sources, source) {
+			bad("fakeula.source_rate_limits: unknown source %q (want one of %s)", source, strings.Join(fakeula.Sources, ", "))
+			continue
+		}
+		limit("fakeula.source_rate_limits."+source, spec)
+	}
+	nonNegative("fakeula.max_wait", f.MaxWait)
+
+	if c.Enrichment.IOCWorkers < 1 {
+		bad("enrichment.ioc_workers must be at least 1, got %d", c.Enrichment.IOCWorkers)
+	}
+	if c.Enrichment.SourceWorkers < 1 {
+		bad("enrichment.source_workers must be at least 1, got %d", c.Enrichment.SourceWorkers)
+	}
+	if e := c.Enrichment.Extractor; e != extractor.BackendNative && e != extractor.BackendFakeula {
+		bad("enrichment.extractor %q must be %s or %s", e, extractor.BackendNative, extractor.BackendFakeula)
+	}
+
+	if c.Cache.ParseSize < 1 {
+		bad("cache.parse_size must be at least 1, got %d", c.Cache.ParseSize)
+	}
+	positive("cache.parse_ttl", c.Cache.ParseTTL)
+	nonNegative("cache.response_ttl", c.Cache.ResponseTTL)
+	for source, ttl := range c.Cache.SourceTTLs {
+		nonNegative("cache.source_ttls."+source, ttl)
+	}
+	positive("cache.purge_interval", c.Cache.PurgeInterval)
+
+	a := c.Auth
+	switch strings.ToLower(a.Mode) {
+	case "jwt":
+		if a.Issuer == "" && a.JWKSURL == "" && a.PublicKeyFile == "" {
+			bad("auth: jwt mode needs auth.issuer, auth.jwks_url or auth.public_key_file")
+		}
+	case "header":
+	default:
+		bad("auth.mode %q must be jwt or header", a.Mode)
+	}
+	if a.Issuer != "" {
+		if err := httpURL(a.Issuer); err != nil {
+			bad("auth.issuer: %v", err)
+		}
+	}
+	if a.JWKSURL != "" {
+		if err := httpURL(a.JWKSURL); err != nil {
+			bad("auth.jwks_url: %v", err)
+		}
+	}
+	if _, ok := rbac.Parse(a.DefaultRole); !ok {
+		bad("auth.default_role %q must be viewer, analyst or admin", a.DefaultRole)
+	}
+
+	t := c.Tracing
+	switch t.Exporter {
+	case "", ExporterStdout, ExporterNone:
+	case ExporterOTLP:
+		if t.Endpoint == "" {
+			bad("tracing: the otlp exporter needs tracing.endpoint")
+		}
+	default:
+		bad("tracing.exporter %q must be otlp, stdout or none", t.Exporter)
+	}
+	if t.Endpoint != "" {
+		if err := httpURL(t.Endpoint); err != nil {
+			bad("tracing.endpoint: %v", err)
+		}
+	}
+	required("tracing.service_name", t.ServiceName)
+	if t.SampleRatio < 0 || t.SampleRatio > 1 {
+		bad("tracing.sample_ratio must be between 0 and 1, got %v", t.SampleRatio)
+	}
+
+	if _, err := c.CORS.Policy(); err != nil {
+		bad("%v", err)
+	}
+
+	return errors.Join(errs...)
+}
+
+// httpURL checks that raw is an absolute http(s) URL
+func httpURL(raw string) error {
+	if raw == "" {
+		return errors.New("is required")
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("%q is not a URL", raw)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%q must be an absolute http or https URL", raw)
+	}
+	return nil
+}
+
+//--------------------Derived settings---------------------------------------------------------------------
+
+// Version identifies the effective settings: the first 12 hex digits of a SHA-256 over
+// them, passwords left out. Instances reporting the same version run the same config.
+func (c *Config) Version() string {
+	redacted := *c
+	redacted.Database.Password, redacted.Fakeula.Password = "", ""
+	b, err := yaml.Marshal(redacted)
+	if err != nil {
+		return "unknown"
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+// DSN returns the lib/pq connection string
+func (d Database) DSN() string {
+	return fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
+		quoteDSN(d.Host), d.Port, quoteDSN(d.User), quoteDSN(d.Password), quoteDSN(d.Name), d.SSLMode)
+}
+
+// quoteDSN quotes a connection string value when it is empty or contains spaces or quotes
+func quoteDSN(v string) string {
+	if v != "" && !strings.ContainsAny(v, ` '\`) {
+		return v
+	}
+	var b strings.Builder
+	b.WriteByte('\'')
+	for _, r := range v {
+		if r == '\'' || r == '\\' {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	b.WriteByte('\'')
+	return b.String()
+}
+
+// ClientConfig returns the fakeula.Config for these settings, with its source rate limits
+func (f Fakeula) ClientConfig() (fakeula.Config, error) {
+	limits, err := fakeula.NewLimits(f.RateLimit, f.SourceRateLimits)
+	if err != nil {
+		return fakeula.Config{}, err
+	}
+	return fakeula.Config{
+		BaseURL:    f.URL,
+		User:       f.User,
+		Pass:       f.Password,
+		Timeout:    f.Timeout,
+		MaxRetries: f.MaxRetries,
+		Limits:     limits,
+		MaxWait:    f.MaxWait,
+	}, nil
+}
+
+// Policy returns the CORS policy for these settings
+func (c CORS) Policy() (*cors.Policy, error) {
+	return cors.New(cors.Options{
+		AllowedOrigins:   c.AllowedOrigins,
+		AllowedMethods:   c.AllowedMethods,
+		AllowedHeaders:   c.AllowedHeaders,
+		ExposedHeaders:   c.ExposedHeaders,
+		AllowCredentials: c.AllowCredentials,
+		MaxAge:           c.MaxAge,
+	})
+}
+
+// APILimits returns the per-caller buckets for incoming API requests
+func (s Server) APILimits() (*ratelimit.Keyed, error) {
+	l, err := ratelimit.ParseLimit(s.RateLimit)
+	if err != nil {
+		return nil, fmt.Errorf("server.rate_limit: %w", err)
+	}
+	return ratelimit.Same(l), nil
+}
@@ -0,0 +1,239 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// valid returns settings that pass Validate
+func valid() *Config {
+	cfg := Default()
+	cfg.Database.Host, cfg.Database.User, cfg.Database.Password, cfg.Database.Name = "db", "augury", "secret", "augury"
+	cfg.Fakeula.URL, cfg.Fakeula.User, cfg.Fakeula.Password = "http://localhost:7000/", "user", "pass"
+	cfg.Auth.Issuer = "https://idp.example.com/"
+	return cfg
+}
+
+func writeFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "augury.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad_FileThenEnv(t *testing.T) {
+	path := writeFile(t, `
+server:
+  port: 9090
+database:
+  host: db.internal
+  user: augury
+  password: from-file
+  name: augury
+  max_open_conns: 40
+fakeula:
+  url: https://fakeula.internal/
+  user: svc
+  password: from-file
+  source_rate_limits:
+    cbr: 1/s:3
+enrichment:
+  internal_host_prefixes: [ws]
+cache:
+  source_ttls:
+    pdns: 2h
+auth:
+  mode: header
+`)
+	t.Setenv("DB_PASS", "from-env")
+	t.Setenv("FAKEULA_RATE_LIMIT_GEO", "off")
+	t.Setenv("AUGURY_CACHE_TTL_LDAP", "0s")
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Server.Port != 9090 || cfg.Database.MaxOpenConns != 40 || cfg.Database.MaxIdleConns != 10 {
+		t.Errorf("file values or defaults lost: %+v %+v", cfg.Server, cfg.Database)
+	}
+	if cfg.Database.Password != "from-env" || cfg.Fakeula.Password != "from-file" {
+		t.Errorf("expected the environment to override the file, got %q and %q", cfg.Database.Password, cfg.Fakeula.Password)
+	}
+	if cfg.Fakeula.SourceRateLimits["cbr"] != "1/s:3" || cfg.Fakeula.SourceRateLimits["geo"] != "off" {
+		t.Errorf("unexpected source rate limits %v", cfg.Fakeula.SourceRateLimits)
+	}
+	if cfg.Cache.SourceTTLs["pdns"] != 2*time.Hour || cfg.Cache.SourceTTLs["ldap"] != 0 {
+		t.Errorf("unexpected source TTLs %v", cfg.Cache.SourceTTLs)
+	}
+	if len(cfg.Enrichment.InternalHostPrefixes) != 1 || cfg.Enrichment.InternalHostPrefixes[0] != "ws" {
+		t.Errorf("unexpected prefixes %v", cfg.Enrichment.InternalHostPrefixes)
+	}
+}
+
+func TestLoad_Example(t *testing.T) {
+	cfg, err := Load("../config.example.yaml")
+	if err != nil {
+		t.Fatalf("the example config should be valid: %v", err)
+	}
+	if cfg.Fakeula.URL == "" || cfg.Database.Host == "" {
+		t.Errorf("example not read: %+v", cfg)
+	}
+}
+
+func TestLoad_UnknownKey(t *testing.T) {
+	path := writeFile(t, "fakeula:\n  pasword: typo\n")
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "pasword") {
+		t.Errorf("expected the misspelt key to be reported, got %v", err)
+	}
+}
+
+func TestLoad_MissingFile(t *testing.T) {
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
+
+func TestApplyEnv_InvalidValues(t *testing.T) {
+	cfg := valid()
+	err := cfg.applyEnv([]string{"PORT=http", "FAKEULA_TIMEOUT=15", "AUGURY_SKIP_DB=sometimes", "DB_HOST=ignored=still"})
+	if err == nil {
+		t.Fatal("expected errors")
+	}
+	for _, key := range []string{"PORT", "FAKEULA_TIMEOUT", "AUGURY_SKIP_DB"} {
+		if !strings.Contains(err.Error(), key) {
+			t.Errorf("expected %s in %v", key, err)
+		}
+	}
+	if cfg.Database.Host != "ignored=still" {
+		t.Errorf("values containing = should be kept whole, got %q", cfg.Database.Host)
+	}
+}
+
+func TestApplyEnv_EmptyPrefixes(t *testing.T) {
+	cfg := valid()
+	if err := cfg.applyEnv([]string{"AUGURY_INTERNAL_HOST_PREFIXES="}); err != nil {
+		t.Fatal(err)
+	}
+	if p := cfg.Enrichment.InternalHostPrefixes; p == nil || len(p) != 0 {
+		t.Errorf("expected an empty, non-nil prefix list, got %#v", p)
+	}
+}
+
+func TestApplyEnv_CORS(t *testing.T) {
+	cfg := valid()
+	err := cfg.applyEnv([]string{"AUGURY_CORS_ALLOWED_ORIGINS=https://augury.example.com, https://*.corp.example.com", "AUGURY_CORS_MAX_AGE=1h"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o := cfg.CORS.AllowedOrigins; len(o) != 2 || o[1] != "https://*.corp.example.com" {
+		t.Errorf("unexpected origins %q", o)
+	}
+	if cfg.CORS.MaxAge != time.Hour {
+		t.Errorf("expected max age 1h, got %s", cfg.CORS.MaxAge)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := valid().Validate(); err != nil {
+		t.Fatalf("expected valid settings, got %v", err)
+	}
+
+	tests := map[string]struct {
+		change func(*Config)
+		want   string
+	}{
+		"no db password":    {func(c *Config) { c.Database.Password = "" }, "database.password is required"},
+		"idle over open":    {func(c *Config) { c.Database.MaxIdleConns = 50 }, "database.max_idle_conns"},
+		"no pool":           {func(c *Config) { c.Database.MaxOpenConns = 0 }, "database.max_open_conns"},
+		"bad sslmode":       {func(c *Config) { c.Database.SSLMode = "maybe" }, "database.sslmode"},
+		"relative url":      {func(c *Config) { c.Fakeula.URL = "localhost:7000" }, "fakeula.url"},
+		"ftp url":           {func(c *Config) { c.Fakeula.URL = "ftp://fakeula/" }, "fakeula.url"},
+		"no fakeula user":   {func(c *Config) { c.Fakeula.User = "" }, "fakeula.user is required"},
+		"bad rate limit":    {func(c *Config) { c.Fakeula.RateLimit = "lots" }, "fakeula.rate_limit"},
+		"unknown source":    {func(c *Config) { c.Fakeula.SourceRateLimits = map[string]string{"cb": "1/s"} }, `unknown source "cb"`},
+		"no workers":        {func(c *Config) { c.Enrichment.IOCWorkers = 0 }, "enrichment.ioc_workers"},
+		"bad extractor":     {func(c *Config) { c.Enrichment.Extractor = "regex" }, "enrichment.extractor"},
+		"no jwt key source": {func(c *Config) { c.Auth.Issuer = "" }, "jwt mode needs"},
+		"bad role":          {func(c *Config) { c.Auth.DefaultRole = "root" }, "auth.default_role"},
+		"bad port":          {func(c *Config) { c.Server.Port = 0 }, "server.port"},
+		"no write timeout":  {func(c *Config) { c.Server.WriteTimeout = 0 }, "server.write_timeout"},
+		"otlp no endpoint":  {func(c *Config) { c.Tracing.Exporter = ExporterOTLP }, "tracing.endpoint"},
+		"bad exporter":      {func(c *Config) { c.Tracing.Exporter = "jaeger" }, "tracing.exporter"},
+		"bad sample ratio":  {func(c *Config) { c.Tracing.SampleRatio = 2 }, "tracing.sample_ratio"},
+		"bad log level":     {func(c *Config) { c.Logging.Level = "verbose" }, "logging.level"},
+		"bad log format":    {func(c *Config) { c.Logging.Format = "xml" }, "logging.format"},
+		"bad cors origin":   {func(c *Config) { c.CORS.AllowedOrigins = []string{"localhost:3000"} }, "cors: origin"},
+	}
+	for name, tt := range tests {
+		cfg := valid()
+		tt.change(cfg)
+		err := cfg.Validate()
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: expected an error containing %q, got %v", name, tt.want, err)
+		}
+	}
+
+	// Every problem is reported at once
+	cfg := valid()
+	cfg.Database.User, cfg.Fakeula.Password = "", ""
+	if err := cfg.Validate(); err == nil || strings.Count(err.Error(), "\n") != 1 {
+		t.Errorf("expected two errors, got %v", err)
+	}
+
+	// Without a database its settings are not checked
+	cfg = valid()
+	cfg.Database = Database{Disabled: true}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("expected a disabled database to skip validation, got %v", err)
+	}
+}
+
+func TestValidateDatabase(t *testing.T) {
+	// migrate runs without FAKEula credentials or auth settings
+	cfg := valid()
+	cfg.Fakeula = Fakeula{}
+	cfg.Auth = Auth{}
+	if err := cfg.ValidateDatabase(); err != nil {
+		t.Errorf("expected only the database to be checked, got %v", err)
+	}
+	if err := cfg.Validate(); err == nil {
+		t.Error("expected the full validation to still fail")
+	}
+
+	cfg.Database.Password = ""
+	if err := cfg.ValidateDatabase(); err == nil || !strings.Contains(err.Error(), "database.password is required") {
+		t.Errorf("expected a database error, got %v", err)
+	}
+}
+
+func TestDatabase_DSN(t *testing.T) {
+	d := valid().Database
+	d.Password = "it's a secret"
+	want := `host=db port=5432 user=augury password='it\'s a secret' dbname=augury sslmode=disable`
+	if got := d.DSN(); got != want {
+		t.Errorf("DSN() = %s, want %s", got, want)
+	}
+}
+
+func TestConfig_Version(t *testing.T) {
+	a, b := valid(), valid()
+	if a.Version() != b.Version() || len(a.Version()) != 12 {
+		t.Fatalf("expected equal 12 digit versions, got %q and %q", a.Version(), b.Version())
+	}
+	b.Database.Password = "rotated"
+	if a.Version() != b.Version() {
+		t.Error("passwords should not change the version")
+	}
+	b.Server.Port = 9090
+	if a.Version() == b.Version() {
+		t.Error("a different setting should change the version")
+	}
+}
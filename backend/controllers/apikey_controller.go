@@ -0,0 +1,141 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/0x-Singularity/Augury/apikey"
+	"github.com/0x-Singularity/Augury/identity"
+	"github.com/0x-Singularity/Augury/models"
+	"github.com/0x-Singularity/Augury/rbac"
+	"github.com/gorilla/mux"
+)
+
+// createAPIKeyRequest is the body of CreateAPIKey
+type createAPIKeyRequest struct {
+	Owner       string     `json:"owner"`
+	Description string     `json:"description"`
+	Role        string     `json:"role"`       // default analyst
+	Scopes      []string   `json:"scopes"`     // e.g. ["/ioc/extract", "/ioc/*"]; "*" for every route
+	ExpiresAt   *time.Time `json:"expires_at"` // RFC 3339
+	ExpiresIn   string     `json:"expires_in"` // Go duration such as 720h; default 90 days
+}
+
+// CreateAPIKey issues a new API key. The key is only ever returned in this response.
+func CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	var req createAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	key, err := newAPIKey(req, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	key.CreatedBy = identity.UserName(r.Context())
+
+	raw, prefix, hash, err := apikey.Generate()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to generate API key", "err", err)
+		http.Error(w, "Error creating API key", http.StatusInternalServerError)
+		return
+	}
+	key.Prefix = prefix
+	if err := models.CreateAPIKey(r.Context(), key, hash); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to store API key", "err", err)
+		http.Error(w, "Error creating API key", http.StatusInternalServerError)
+		return
+	}
+	slog.InfoContext(r.Context(), "API key created", "prefix", key.Prefix, "owner", key.Owner)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{"key": raw, "api_key": key})
+}
+
+// newAPIKey validates req and returns the key it describes
+func newAPIKey(req createAPIKeyRequest, now time.Time) (*models.APIKey, error) {
+	key := &models.APIKey{
+		Owner:       strings.TrimSpace(req.Owner),
+		Description: strings.TrimSpace(req.Description),
+		Role:        string(rbac.Analyst),
+		Scopes:      req.Scopes,
+	}
+	if key.Owner == "" {
+		return nil, errors.New("owner is required")
+	}
+	if req.Role != "" {
+		role, ok := rbac.Parse(req.Role)
+		if !ok {
+			return nil, errors.New("role must be viewer, analyst or admin")
+		}
+		key.Role = string(role)
+	}
+	if len(key.Scopes) == 0 {
+		return nil, errors.New(`at least one scope is required, e.g. "/ioc/extract" or "*"`)
+	}
+	for _, s := range key.Scopes {
+		if !apikey.ValidScope(s) {
+			return nil, errors.New("invalid scope " + strconv.Quote(s))
+		}
+	}
+
+	expires := now.Add(apikey.DefaultTTL)
+	switch {
+	case req.ExpiresAt != nil && req.ExpiresIn != "":
+		return nil, errors.New("set expires_at or expires_in, not both")
+	case req.ExpiresAt != nil:
+		expires = *req.ExpiresAt
+	case req.ExpiresIn != "":
+		d, err := time.ParseDuration(req.ExpiresIn)
+		if err != nil {
+			return nil, errors.New("expires_in must be a duration such as 720h")
+		}
+		expires = now.Add(d)
+	}
+	if !expires.After(now) {
+		return nil, errors.New("expiry must be in the future")
+	}
+	key.ExpiresAt = &expires
+	return key, nil
+}
+
+// ListAPIKeys lists every API key, without the keys themselves
+func ListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := models.ListAPIKeys(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to list API keys", "err", err)
+		http.Error(w, "Error retrieving API keys", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(keys)
+}
+
+// RevokeAPIKey revokes the key with the {id} in the path. Revoked keys stop working immediately.
+func RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || id <= 0 {
+		http.Error(w, "A numeric key id is required", http.StatusBadRequest)
+		return
+	}
+
+	revoked, err := models.RevokeAPIKey(r.Context(), id)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to revoke API key", "id", id, "err", err)
+		http.Error(w, "Error revoking API key", http.StatusInternalServerError)
+		return
+	}
+	if !revoked {
+		http.Error(w, "API key not found or already revoked", http.StatusNotFound)
+		return
+	}
+	slog.InfoContext(r.Context(), "API key revoked", "id", id)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,31 @@
+package controllers
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/0x-Singularity/Augury/audit"
+)
+
+// VerifyAudit recomputes the audit log's hash chain and reports whether it is intact.
+// A broken chain is still a 200: the report (broken_at, reason) is the answer.
+func (h *Handlers) VerifyAudit(w http.ResponseWriter, r *http.Request) {
+	if h.Audit == nil {
+		http.Error(w, "Audit log is unavailable without a database", http.StatusServiceUnavailable)
+		return
+	}
+
+	result, err := audit.Verify(r.Context(), h.Audit)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to verify audit log", "err", err)
+		http.Error(w, "Error verifying audit log", http.StatusInternalServerError)
+		return
+	}
+	if !result.Valid {
+		slog.ErrorContext(r.Context(), "AUDIT CHAIN BROKEN", "broken_at", result.BrokenAt, "reason", result.Reason)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
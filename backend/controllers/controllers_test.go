@@ -2,17 +2,61 @@ package controllers_test
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"net/http/httptest"
-	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/0x-Singularity/Augury/audit"
+	"github.com/0x-Singularity/Augury/config"
 	"github.com/0x-Singularity/Augury/controllers"
+	"github.com/0x-Singularity/Augury/enrich"
+	"github.com/0x-Singularity/Augury/fakeula"
+	"github.com/0x-Singularity/Augury/health"
+	"github.com/0x-Singularity/Augury/identity"
+	"github.com/0x-Singularity/Augury/indicator"
+	"github.com/0x-Singularity/Augury/models"
+	"github.com/0x-Singularity/Augury/ratelimit"
 	"github.com/kylelemons/godebug/pretty"
 )
 
+// testConfig returns settings for handler tests: no database, and no rate limits since
+// the fake FAKEula servers answer instantly
+func testConfig(fakeulaURL string) *config.Config {
+	cfg := config.Default()
+	cfg.Database.Disabled = true
+	cfg.Fakeula.URL, cfg.Fakeula.User, cfg.Fakeula.Password = fakeulaURL, "user", "pass"
+	cfg.Fakeula.RateLimit = "off"
+	return cfg
+}
+
+// newHandlers returns handlers built from cfg that call the FAKEula server in cfg
+func newHandlers(t *testing.T, cfg *config.Config) *controllers.Handlers {
+	t.Helper()
+	clientCfg, err := cfg.Fakeula.ClientConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	api, err := fakeula.New(clientCfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return controllers.New(cfg, api)
+}
+
+// mockHandlers returns handlers that call api instead of a FAKEula server
+func mockHandlers(api fakeula.API) *controllers.Handlers {
+	return controllers.New(testConfig("http://fakeula.invalid/"), api)
+}
+
 // fakeFakeula spins up a local HTTP server that pretends to be the FAKEula API for testing.
 // It answers every request with a minimal JSON
 func fakeFakeula() *httptest.Server {
@@ -65,12 +109,9 @@ func TestQueryPDNS_Success(t *testing.T) {
 	defer server.Close()
 
 	// point controller code at the fake server
-	os.Setenv("FAKEULA_API_URL", server.URL+"/")
-	os.Setenv("FAKEULA_USER", "user")
-	os.Setenv("FAKEULA_PASS", "pass")
-	os.Setenv("AUGURY_SKIP_DB", "1")
+	h := newHandlers(t, testConfig(server.URL+"/"))
 
-	rr, body, err := performRequest(controllers.QueryPDNS, http.MethodGet, "/pdns?ioc=example.com", nil)
+	rr, body, err := performRequest(h.QuerySource("pdns"), http.MethodGet, "/pdns?ioc=example.com", nil)
 	if err != nil {
 		t.Fatalf("unexpected decode error: %v", err)
 	}
@@ -87,7 +128,7 @@ func TestQueryPDNS_Success(t *testing.T) {
 
 func TestQueryPDNS_MissingIOC(t *testing.T) {
 	rr := httptest.NewRecorder()
-	controllers.QueryPDNS(rr, httptest.NewRequest(http.MethodGet, "/pdns", nil))
+	mockHandlers(nil).QuerySource("pdns")(rr, httptest.NewRequest(http.MethodGet, "/pdns", nil))
 
 	if rr.Code != http.StatusBadRequest {
 		t.Fatalf("expected 400 for missing ioc query‑param, got %d", rr.Code)
@@ -99,13 +140,10 @@ func TestExtractFromText_Integration(t *testing.T) {
 	server := fakeFakeula()
 	defer server.Close()
 
-	os.Setenv("FAKEULA_API_URL", server.URL+"/")
-	os.Setenv("FAKEULA_USER", "user")
-	os.Setenv("FAKEULA_PASS", "pass")
-	os.Setenv("AUGURY_SKIP_DB", "1")
+	h := newHandlers(t, testConfig(server.URL+"/"))
 
 	text := []byte("visit http://malicious.com for more info")
-	rr, body, err := performRequest(controllers.ExtractFromText, http.MethodPost, "/extract", text)
+	rr, body, err := performRequest(h.ExtractFromText, http.MethodPost, "/extract", text)
 	if err != nil {
 		t.Fatalf("decode error: %v", err)
 	}
@@ -126,26 +164,837 @@ func TestExtractFromText_Integration(t *testing.T) {
 	t.Log("response body:", pretty.Sprint(body))
 }
 
-func Test_md5FromCBR_Valid(t *testing.T) {
-	// CBR JSON containing an MD5
-	raw := json.RawMessage(`{
-		"data": [
-			{
-				"process": {
-					"hash": {
-						"md5": "abcd1234"
-					}
-				}
-			}
-		]
-	}`)
+func TestExtractFromText_ConcurrentIOCs(t *testing.T) {
+	iocs := []string{"malicious.com", "1.2.3.4", "evil.org", "1.2.3.4"}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"data": []any{}})
+	})
+	mux.HandleFunc("/extract", func(w http.ResponseWriter, r *http.Request) {
+		var data []any
+		for _, ioc := range iocs {
+			data = append(data, map[string]any{
+				"threat": map[string]any{
+					"indicator": map[string]any{"description": ioc},
+				},
+			})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"data": data})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	cfg := testConfig(server.URL + "/")
+	cfg.Enrichment.IOCWorkers, cfg.Enrichment.SourceWorkers = 2, 2
+	h := newHandlers(t, cfg)
+
+	// Use the FAKEula extractor so the IOC list comes from the fake /extract above
+	rr, body, err := performRequest(h.ExtractFromText, http.MethodPost, "/extract?extractor=fakeula", []byte("some text"))
+	if err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+
+	data, ok := body["data"].(map[string]any)
+	if !ok {
+		t.Fatalf("response missing data map")
+	}
+	if len(data) != 3 {
+		t.Fatalf("expected 3 unique IOCs in data map, got %d", len(data))
+	}
+	for _, ioc := range iocs {
+		if _, present := data[ioc]; !present {
+			t.Errorf("expected key for IOC %q in data map", ioc)
+		}
+	}
+}
+
+// mockUpstream implements fakeula.API; only the methods a test needs are overridden
+type mockUpstream struct {
+	fakeula.API
+	ldap func(ctx context.Context, ioc string) (*fakeula.Response, error)
+}
+
+func (m *mockUpstream) LDAP(ctx context.Context, ioc string) (*fakeula.Response, error) {
+	return m.ldap(ctx, ioc)
+}
+
+func TestQueryLDAP_MockUpstream(t *testing.T) {
+	var queried string
+	h := mockHandlers(&mockUpstream{
+		ldap: func(ctx context.Context, ioc string) (*fakeula.Response, error) {
+			queried = ioc
+			return &fakeula.Response{Data: []map[string]interface{}{
+				{"user": map[string]interface{}{"email": "alice.bob@example.com", "name": "abob"}},
+			}}, nil
+		},
+	})
+
+	rr, body, err := performRequest(h.QuerySource("ldap"), http.MethodGet, "/ldap?ioc=abob", nil)
+	if err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+	if queried != "abob" {
+		t.Errorf("mock queried with %q, want abob", queried)
+	}
+
+	data, _ := body["data"].(map[string]any)
+	if _, ok := data["ldap"]; !ok {
+		t.Fatalf("expected parsed ldap source in response, got %v", body)
+	}
+}
+
+func TestQueryLDAP_RedactsByRole(t *testing.T) {
+	h := mockHandlers(&mockUpstream{
+		ldap: func(ctx context.Context, ioc string) (*fakeula.Response, error) {
+			return &fakeula.Response{Data: []map[string]interface{}{
+				{"user": map[string]interface{}{"email": "alice.bob@example.com", "name": "abob", "phone": "555-0100", "title": "CFO"}},
+			}}, nil
+		},
+	})
+
+	tests := []struct {
+		role         string
+		phone, title bool
+	}{
+		{"viewer", false, false},
+		{"analyst", false, true},
+		{"admin", true, true},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/ldap?ioc=abob", nil)
+		req = req.WithContext(identity.WithIdentity(req.Context(), identity.Identity{Name: "abob", Roles: []string{tt.role}}))
+		rr := httptest.NewRecorder()
+		h.QuerySource("ldap")(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d", tt.role, rr.Code)
+		}
+
+		body := rr.Body.String()
+		if got := strings.Contains(body, "555-0100"); got != tt.phone {
+			t.Errorf("%s: phone visible = %v, want %v", tt.role, got, tt.phone)
+		}
+		if got := strings.Contains(body, "CFO"); got != tt.title {
+			t.Errorf("%s: title visible = %v, want %v", tt.role, got, tt.title)
+		}
+		if !strings.Contains(body, "alice.bob@example.com") {
+			t.Errorf("%s: unrestricted fields should stay visible: %s", tt.role, body)
+		}
+	}
+}
+
+func TestExtractFromTextStream_Events(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"data": []any{}})
+	})
+	// Make the base CBR lookup fail so a source_error event is emitted
+	mux.HandleFunc("/cbr/", func(w http.ResponseWriter, r *http.Request) {
+		if strings.Count(r.URL.Path, "/") == 2 {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"data": []any{}})
+	})
+	mux.HandleFunc("/extract", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"data": []any{
+				map[string]any{"threat": map[string]any{"indicator": map[string]any{"description": "malicious.com"}}},
+				map[string]any{"threat": map[string]any{"indicator": map[string]any{"description": "1.2.3.4"}}},
+			},
+		})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	h := newHandlers(t, testConfig(server.URL+"/"))
+
+	req := httptest.NewRequest(http.MethodPost, "/extract/stream?extractor=fakeula", bytes.NewReader([]byte("text")))
+	rr := httptest.NewRecorder()
+	h.ExtractFromTextStream(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+
+	counts := map[string]int{}
+	var last string
+	for _, line := range strings.Split(rr.Body.String(), "\n") {
+		if name, ok := strings.CutPrefix(line, "event: "); ok {
+			counts[name]++
+			last = name
+		}
+	}
+
+	if counts["start"] != 1 || counts["ioc"] != 2 || counts["progress"] != 2 {
+		t.Errorf("unexpected event counts: %v", counts)
+	}
+	if counts["source_error"] != 2 {
+		t.Errorf("expected one cbr source_error per IOC, got %d", counts["source_error"])
+	}
+	if last != "summary" {
+		t.Errorf("expected stream to end with summary, ended with %q", last)
+	}
+}
+
+func TestExtractFromTextStream_DedupesCanonicalIOCs(t *testing.T) {
+	var pdnsCalls int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"data": []any{}})
+	})
+	mux.HandleFunc("/pdns/malicious.com/_summary", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&pdnsCalls, 1)
+		json.NewEncoder(w).Encode(map[string]any{"data": []any{}})
+	})
+	mux.HandleFunc("/extract", func(w http.ResponseWriter, r *http.Request) {
+		var data []any
+		for _, ioc := range []string{"malicious.com", "Malicious.COM", "malicious.com."} {
+			data = append(data, map[string]any{"threat": map[string]any{"indicator": map[string]any{"description": ioc}}})
+		}
+		json.NewEncoder(w).Encode(map[string]any{"data": data})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	h := newHandlers(t, testConfig(server.URL+"/"))
+
+	req := httptest.NewRequest(http.MethodPost, "/extract/stream?extractor=fakeula", bytes.NewReader([]byte("text")))
+	rr := httptest.NewRecorder()
+	h.ExtractFromTextStream(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+
+	counts := map[string]int{}
+	for _, line := range strings.Split(rr.Body.String(), "\n") {
+		if name, ok := strings.CutPrefix(line, "event: "); ok {
+			counts[name]++
+		}
+	}
+	if counts["ioc"] != 1 || counts["progress"] != 1 {
+		t.Errorf("expected the variants to be enriched once, got event counts %v", counts)
+	}
+	if !strings.Contains(rr.Body.String(), `"total":1`) {
+		t.Errorf("expected a total of 1 IOC, got %s", rr.Body.String())
+	}
+	if got := atomic.LoadInt32(&pdnsCalls); got != 1 {
+		t.Errorf("expected 1 PDNS summary lookup, got %d", got)
+	}
+}
+
+func TestExtractFromText_NativeExtractor(t *testing.T) {
+	server := fakeFakeula()
+	defer server.Close()
+
+	h := newHandlers(t, testConfig(server.URL+"/"))
+
+	text := []byte("beacon to 10.1.2.3 from desk0042, dropper 44d88612fea8a8f36de82e1278abb02f")
+	rr, body, err := performRequest(h.ExtractFromText, http.MethodPost, "/extract?extractor=native", text)
+	if err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+
+	data, _ := body["data"].(map[string]any)
+	for _, ioc := range []string{"10.1.2.3", "desk0042", "44d88612fea8a8f36de82e1278abb02f"} {
+		if _, ok := data[ioc]; !ok {
+			t.Errorf("expected %q in data map, got %v", ioc, data)
+		}
+	}
+
+	indicators, _ := body["indicators"].([]any)
+	if len(indicators) != 3 {
+		t.Fatalf("expected 3 indicators, got %v", body["indicators"])
+	}
+	first, _ := indicators[0].(map[string]any)
+	if first["type"] != "ipv4" || first["start"] != float64(10) || first["end"] != float64(18) {
+		t.Errorf("unexpected first indicator %v", first)
+	}
+}
+
+func TestExtractFromText_RefusesPasteAboveBurst(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		json.NewEncoder(w).Encode(map[string]any{"data": []any{}})
+	}))
+	defer server.Close()
+
+	h := newHandlers(t, testConfig(server.URL+"/"))
+	// Each paste gets a full bucket of 3
+	limited := func(w http.ResponseWriter, r *http.Request) {
+		ratelimit.Same(ratelimit.Limit{Rate: 1, Burst: 3}).Middleware(http.HandlerFunc(h.ExtractFromText)).ServeHTTP(w, r)
+	}
+
+	text := []byte("10.0.0.1 10.0.0.2 10.0.0.3 10.0.0.4 10.0.0.5")
+	rr, _, _ := performRequest(limited, http.MethodPost, "/extract?extractor=native", text)
+	if rr.Code != http.StatusRequestEntityTooLarge || !strings.Contains(rr.Body.String(), "at most 3") {
+		t.Errorf("expected 413 naming the limit, got %d %q", rr.Code, rr.Body.String())
+	}
+	if calls.Load() != 0 {
+		t.Errorf("expected no upstream calls, got %d", calls.Load())
+	}
+
+	rr, _, _ = performRequest(limited, http.MethodPost, "/extract?extractor=native", []byte("10.0.0.1 10.0.0.2 10.0.0.3"))
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected a paste within the burst through, got %d", rr.Code)
+	}
+
+	// Repeats are looked up once, so they cost nothing
+	rr, _, _ = performRequest(limited, http.MethodPost, "/extract?extractor=native", []byte(strings.Repeat("10.0.0.1 ", 25)))
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected a paste repeating one IOC through, got %d %q", rr.Code, rr.Body.String())
+	}
+}
+
+func TestExtractFromText_DefaultLimitAllowsIncidentPaste(t *testing.T) {
+	server := fakeFakeula()
+	defer server.Close()
+
+	h := newHandlers(t, testConfig(server.URL+"/"))
+	limits, err := config.Default().Server.APILimits()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var text strings.Builder
+	for i := 1; i <= 50; i++ {
+		fmt.Fprintf(&text, "beacon to 10.0.0.%d\n", i)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/extract?extractor=native", strings.NewReader(text.String()))
+	req = req.WithContext(identity.WithIdentity(req.Context(), identity.Identity{Subject: "alice", Name: "alice", Method: "jwt"}))
+	rr := httptest.NewRecorder()
+	limits.Middleware(http.HandlerFunc(h.ExtractFromText)).ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected a 50-IOC paste through with the default limit, got %d %q", rr.Code, rr.Body.String())
+	}
+
+	var body struct {
+		Data map[string]any `json:"data"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if len(body.Data) != 50 {
+		t.Errorf("expected 50 IOCs enriched, got %d", len(body.Data))
+	}
+}
+
+func TestExtractFromText_DatabaseDisabled(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"data": []any{}})
+	})
+	mux.HandleFunc("/oil/netflow/", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"data": []any{map[string]any{"destination": map[string]any{"ip": "198.51.100.7"}}}})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
 
-	got, err := controllers.MD5FromCBR(raw)
+	// testConfig runs without a database
+	h := newHandlers(t, testConfig(server.URL+"/"))
+	rr, body, err := performRequest(h.ExtractFromText, http.MethodPost, "/extract?extractor=native", []byte("beacon to 203.0.113.9"))
 	if err != nil {
-		t.Fatalf("expected no error, got %v", err)
+		t.Fatalf("decode error: %v", err)
+	}
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+
+	data, _ := body["data"].(map[string]any)
+	result, _ := data["203.0.113.9"].(map[string]any)
+	if result["type"] != "ipv4" || result["cache"] == nil {
+		t.Errorf("expected the IOC type and cache status, got %v", result)
+	}
+	if netflow, _ := result["netflow"].(map[string]any); !strings.Contains(fmt.Sprint(netflow["data"]), "198.51.100.7") {
+		t.Errorf("expected the netflow source data, got %v", result)
+	}
+	for _, key := range []string{"log_id", "changes", "query_log"} {
+		if _, ok := result[key]; ok {
+			t.Errorf("expected no %s without a database, got %v", key, result[key])
+		}
+	}
+}
+
+func TestExtractFromText_UnknownExtractor(t *testing.T) {
+	rr := httptest.NewRecorder()
+	mockHandlers(nil).ExtractFromText(rr, httptest.NewRequest(http.MethodPost, "/extract?extractor=regex", bytes.NewReader([]byte("x"))))
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for unknown extractor, got %d", rr.Code)
+	}
+}
+
+func TestQueryPDNS_RefangsIOC(t *testing.T) {
+	var gotPath string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		json.NewEncoder(w).Encode(map[string]any{"data": []any{}})
+	}))
+	defer server.Close()
+	h := newHandlers(t, testConfig(server.URL+"/"))
+
+	rr, body, err := performRequest(h.QuerySource("pdns"), http.MethodGet, "/pdns?ioc=evil%5B.%5Dcom", nil)
+	if err != nil || rr.Code != http.StatusOK {
+		t.Fatalf("unexpected result %d %v", rr.Code, err)
+	}
+	if gotPath != "/pdns/evil.com" {
+		t.Errorf("FAKEula queried at %q, want /pdns/evil.com", gotPath)
+	}
+
+	query, _ := body["query"].(map[string]any)
+	if query["original"] != "evil[.]com" || query["refanged"] != "evil.com" {
+		t.Errorf("unexpected query echo %v", query)
+	}
+}
+
+func TestExtractFromText_RoutesByType(t *testing.T) {
+	var mu sync.Mutex
+	var paths []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		paths = append(paths, r.URL.Path)
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"data": []any{}})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	h := newHandlers(t, testConfig(server.URL+"/"))
+
+	// Upper case hash: it should be lowercased and only sent to the hash-aware sources
+	text := []byte("dropper 44D88612FEA8A8F36DE82E1278ABB02F")
+	rr, body, err := performRequest(h.ExtractFromText, http.MethodPost, "/extract?extractor=native", text)
+	if err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+	data, _ := body["data"].(map[string]any)
+	if _, ok := data["44d88612fea8a8f36de82e1278abb02f"]; !ok {
+		t.Errorf("expected normalized hash in data map, got %v", data)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := map[string]bool{
+		"/cbr/44d88612fea8a8f36de82e1278abb02f":        true,
+		"/cbr/binary/44d88612fea8a8f36de82e1278abb02f": true,
+	}
+	if len(paths) != len(want) {
+		t.Errorf("expected %d upstream calls, got %v", len(want), paths)
+	}
+	for _, p := range paths {
+		if !want[p] {
+			t.Errorf("unexpected upstream call %s", p)
+		}
+	}
+}
+
+// whoisEnricher is a source registered by a test
+type whoisEnricher struct {
+	mu      sync.Mutex
+	queried []string
+}
+
+func (e *whoisEnricher) Enrich(_ context.Context, _ fakeula.API, ioc string) (*fakeula.Response, error) {
+	e.mu.Lock()
+	e.queried = append(e.queried, ioc)
+	e.mu.Unlock()
+	return &fakeula.Response{Data: []map[string]interface{}{{"registrar": "Example Registrar"}}}, nil
+}
+
+func TestRegisteredSource_ExtractAndRoute(t *testing.T) {
+	whois := &whoisEnricher{}
+	h := mockHandlers(nil)
+	h.Sources = enrich.NewRegistry()
+	if err := h.Sources.Register(enrich.Source{Name: "whois", Enricher: whois, Extract: true, Types: []indicator.Type{indicator.Domain}, Raw: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	rr, _, err := performRequest(h.ExtractFromText, http.MethodPost, "/extract?extractor=native", []byte("evil.com and 1.2.3.4"))
+	if err != nil || rr.Code != http.StatusOK {
+		t.Fatalf("extract: status %d, err %v", rr.Code, err)
+	}
+	if len(whois.queried) != 1 || whois.queried[0] != "evil.com" {
+		t.Errorf("expected the extract flow to query whois for the domain only, got %v", whois.queried)
+	}
+
+	rr, body, err := performRequest(h.QuerySource("whois"), http.MethodGet, "/api/ioc/whois?ioc=Evil.com", nil)
+	if err != nil || rr.Code != http.StatusOK {
+		t.Fatalf("route: status %d, err %v", rr.Code, err)
+	}
+	if data, _ := body["data"].([]any); len(data) != 1 {
+		t.Errorf("expected the raw whois data, got %v", body)
+	}
+
+	rr, _, _ = performRequest(h.QuerySource("dns"), http.MethodGet, "/api/ioc/dns?ioc=evil.com", nil)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown source, got %d", rr.Code)
+	}
+}
+
+// memoryStore is an in-memory controllers.ResponseStore
+type memoryStore struct {
+	mu   sync.Mutex
+	data map[string][]byte
+	at   map[string]time.Time
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{data: map[string][]byte{}, at: map[string]time.Time{}}
+}
+
+func (m *memoryStore) Get(_ context.Context, source, ioc string) ([]byte, time.Time, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, ok := m.data[source+"|"+ioc]
+	return data, m.at[source+"|"+ioc], ok, nil
+}
+
+func (m *memoryStore) Put(_ context.Context, source, ioc string, data []byte, fetchedAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.data[source+"|"+ioc] = data
+	m.at[source+"|"+ioc] = fetchedAt.Add(-90 * time.Second) // pretend the data is already 90s old
+	return nil
+}
+
+func (m *memoryStore) Purge(_ context.Context, expiredBefore func(source string) time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var purged int64
+	for key, at := range m.at {
+		source, _, _ := strings.Cut(key, "|")
+		if at.Before(expiredBefore(source)) {
+			delete(m.data, key)
+			delete(m.at, key)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+func TestQueryPDNS_ResponseCache(t *testing.T) {
+	var calls atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/pdns/", func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"data": []any{}})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	h := newHandlers(t, testConfig(server.URL+"/"))
+	h.Responses = newMemoryStore()
+
+	lookup := func(target string) map[string]any {
+		t.Helper()
+		rr, body, err := performRequest(h.QuerySource("pdns"), http.MethodGet, target, nil)
+		if err != nil || rr.Code != http.StatusOK {
+			t.Fatalf("lookup %s: status %d, err %v", target, rr.Code, err)
+		}
+		cache, _ := body["cache"].(map[string]any)
+		return cache
+	}
+
+	if cache := lookup("/pdns?ioc=Example.com"); cache["hit"] != false {
+		t.Errorf("expected first lookup to miss, got %v", cache)
+	}
+	// Same IOC in a different spelling is served from the cache
+	cache := lookup("/pdns?ioc=example[.]com")
+	if cache["hit"] != true {
+		t.Errorf("expected second lookup to hit, got %v", cache)
+	}
+	if age, _ := cache["age_seconds"].(float64); age < 90 {
+		t.Errorf("expected cached data to be at least 90s old, got %v", cache["age_seconds"])
+	}
+	if calls.Load() != 1 {
+		t.Errorf("expected 1 upstream call, got %d", calls.Load())
+	}
+
+	if cache := lookup("/pdns?ioc=example.com&fresh=1"); cache["hit"] != false {
+		t.Errorf("expected fresh=1 to bypass the cache, got %v", cache)
+	}
+	if calls.Load() != 2 {
+		t.Errorf("expected fresh=1 to query upstream again, got %d calls", calls.Load())
+	}
+}
+
+// memorySnapshots is an in-memory controllers.SnapshotStore
+type memorySnapshots struct {
+	snapshots []models.Snapshot
+}
+
+func (m *memorySnapshots) Record(_ context.Context, ioc string, iocType indicator.Type, _ int, raw, parsed json.RawMessage) (int, error) {
+	logID := len(m.snapshots) + 1
+	m.snapshots = append(m.snapshots, models.Snapshot{LogID: logID, IOC: ioc, IOCType: string(iocType), Raw: raw, Parsed: parsed})
+	return logID, nil
+}
+
+func (m *memorySnapshots) Previous(_ context.Context, ioc string, logID int, sources []string) (*models.Snapshot, error) {
+	for i := len(m.snapshots) - 1; i >= 0; i-- {
+		s := m.snapshots[i]
+		var parsed map[string]json.RawMessage
+		json.Unmarshal(s.Parsed, &parsed)
+		for _, source := range sources {
+			if _, ok := parsed[source]; ok && s.IOC == ioc && s.LogID < logID {
+				return &s, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+func TestQueryLDAP_ReportsChanges(t *testing.T) {
+	title := "Analyst"
+	h := mockHandlers(&mockUpstream{
+		ldap: func(ctx context.Context, ioc string) (*fakeula.Response, error) {
+			return &fakeula.Response{Data: []map[string]interface{}{
+				{"user": map[string]interface{}{"email": "alice.bob@example.com", "name": "abob", "title": title}},
+			}}, nil
+		},
+	})
+	h.Snapshots = &memorySnapshots{}
+
+	lookup := func() map[string]any {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/api/ioc/ldap?ioc=abob", nil)
+		req = req.WithContext(identity.WithIdentity(req.Context(), identity.Identity{Name: "carol", Roles: []string{"admin"}}))
+		rr := httptest.NewRecorder()
+		h.QuerySource("ldap")(rr, req)
+		var body map[string]any
+		if err := json.NewDecoder(rr.Body).Decode(&body); err != nil || rr.Code != http.StatusOK {
+			t.Fatalf("status %d, err %v", rr.Code, err)
+		}
+		return body
+	}
+
+	if body := lookup(); body["log_id"] != float64(1) || body["changes"] != nil {
+		t.Errorf("first lookup: expected log 1 and nothing to compare with, got %v %v", body["log_id"], body["changes"])
+	}
+	title = "Lead Analyst"
+	body := lookup()
+	changes, _ := body["changes"].(map[string]any)
+	ldap, _ := changes["ldap_changes"].([]any)
+	if len(ldap) != 1 {
+		t.Fatalf("expected the title change, got %v", body["changes"])
+	}
+	change := ldap[0].(map[string]any)
+	if change["field"] != "title" || change["previous"] != "Analyst" || change["current"] != "Lead Analyst" {
+		t.Errorf("unexpected change %v", change)
+	}
+	if vanished, _ := changes["vanished_sources"].([]any); len(vanished) != 0 {
+		t.Errorf("sources other than ldap should not be compared: %v", vanished)
+	}
+}
+
+func TestPurgeResponses(t *testing.T) {
+	h := mockHandlers(nil)
+	store := newMemoryStore()
+	h.Responses = store
+	twoHoursAgo := time.Now().Add(-2 * time.Hour)
+	store.Put(context.Background(), "pdns", "evil.com", []byte(`{}`), twoHoursAgo) // lives an hour
+	store.Put(context.Background(), "geo", "8.8.8.8", []byte(`{}`), twoHoursAgo)   // lives a day
+
+	// A cancelled context purges once and returns
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	h.PurgeResponses(ctx, time.Hour)
+
+	if _, _, ok, _ := store.Get(context.Background(), "pdns", "evil.com"); ok {
+		t.Error("expected the expired pdns response to be purged")
+	}
+	if _, _, ok, _ := store.Get(context.Background(), "geo", "8.8.8.8"); !ok {
+		t.Error("expected the geo response to be kept")
+	}
+}
+
+func TestGetSnapshot_InvalidLogID(t *testing.T) {
+	for _, target := range []string{"/ioc/snapshot", "/ioc/snapshot?log_id=abc", "/ioc/snapshot?log_id=-1"} {
+		rr, _, _ := performRequest(controllers.GetSnapshot, http.MethodGet, target, nil)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", target, rr.Code)
+		}
+	}
+}
+
+func TestDiffIOC_MissingParams(t *testing.T) {
+	for _, target := range []string{"/ioc/diff", "/ioc/diff?log_id=0", "/ioc/diff?ioc=%20"} {
+		rr, _, _ := performRequest(controllers.DiffIOC, http.MethodGet, target, nil)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", target, rr.Code)
+		}
+	}
+}
+
+func TestHistory_InvalidFilters(t *testing.T) {
+	for _, target := range []string{
+		"/history?type=car",
+		"/history?sort=password",
+		"/history?order=sideways",
+		"/history?from=yesterday",
+		"/history?to=2026-13-01",
+		"/history?min_results=-1",
+		"/history?limit=0",
+	} {
+		rr, _, _ := performRequest(controllers.History, http.MethodGet, target, nil)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", target, rr.Code)
+		}
+	}
+}
+
+func TestCreateAPIKey_Validation(t *testing.T) {
+	tests := map[string]string{
+		"no owner":     `{"scopes": ["*"]}`,
+		"bad role":     `{"owner": "soar", "role": "root", "scopes": ["*"]}`,
+		"no scopes":    `{"owner": "soar"}`,
+		"bad scope":    `{"owner": "soar", "scopes": ["ioc/extract"]}`,
+		"past expiry":  `{"owner": "soar", "scopes": ["*"], "expires_at": "2001-01-01T00:00:00Z"}`,
+		"bad duration": `{"owner": "soar", "scopes": ["*"], "expires_in": "soon"}`,
+		"both expiry":  `{"owner": "soar", "scopes": ["*"], "expires_in": "1h", "expires_at": "2999-01-01T00:00:00Z"}`,
+		"not json":     `owner=soar`,
+	}
+	for name, body := range tests {
+		rr := httptest.NewRecorder()
+		controllers.CreateAPIKey(rr, httptest.NewRequest(http.MethodPost, "/api/admin/keys", strings.NewReader(body)))
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", name, rr.Code)
+		}
+	}
+}
+
+func TestQueryLDAP_UpstreamRateLimited(t *testing.T) {
+	h := mockHandlers(&mockUpstream{
+		ldap: func(ctx context.Context, ioc string) (*fakeula.Response, error) {
+			return nil, &ratelimit.Error{Key: "ldap", RetryAfter: 1500 * time.Millisecond}
+		},
+	})
+
+	rr := httptest.NewRecorder()
+	h.QuerySource("ldap")(rr, httptest.NewRequest(http.MethodGet, "/ldap?ioc=abob", nil))
+	if rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") != "2" {
+		t.Errorf("expected 429 with Retry-After 2, got %d %q", rr.Code, rr.Header().Get("Retry-After"))
+	}
+}
+
+// auditStore keeps audit records in memory
+type auditStore struct {
+	records []models.AuditRecord
+}
+
+func (s *auditStore) Append(_ context.Context, rec *models.AuditRecord, seal func(*models.AuditRecord)) error {
+	if n := len(s.records); n > 0 {
+		rec.PrevHash = s.records[n-1].Hash
+	}
+	seal(rec)
+	rec.ID = int64(len(s.records) + 1)
+	s.records = append(s.records, *rec)
+	return nil
+}
+
+func (s *auditStore) Records(_ context.Context, afterID int64, limit int) ([]models.AuditRecord, error) {
+	if int(afterID) >= len(s.records) {
+		return nil, nil
+	}
+	return s.records[afterID:], nil
+}
+
+func TestQueryLDAP_Audited(t *testing.T) {
+	store := &auditStore{}
+	h := mockHandlers(&mockUpstream{
+		ldap: func(ctx context.Context, ioc string) (*fakeula.Response, error) {
+			return &fakeula.Response{Data: []map[string]interface{}{
+				{"user": map[string]interface{}{"email": "alice.bob@example.com", "name": "abob"}},
+			}}, nil
+		},
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/ioc/ldap?ioc=ABob", nil)
+	req = req.WithContext(identity.WithIdentity(req.Context(), identity.Identity{Name: "carol", Method: "jwt"}))
+	audit.Middleware(store, false)(h.QuerySource("ldap")).ServeHTTP(httptest.NewRecorder(), req)
+
+	if len(store.records) != 1 {
+		t.Fatalf("expected one audit record, got %d", len(store.records))
+	}
+	rec := store.records[0]
+	if rec.Actor != "carol" || len(rec.IOCs) != 1 || rec.IOCs[0] != "abob" || len(rec.Sources) != 1 || rec.Sources[0] != "ldap" {
+		t.Errorf("unexpected audit record %+v", rec)
+	}
+
+	rr := httptest.NewRecorder()
+	h.Audit = store
+	h.VerifyAudit(rr, httptest.NewRequest(http.MethodGet, "/api/audit/verify", nil))
+	var result audit.Result
+	json.NewDecoder(rr.Body).Decode(&result)
+	if rr.Code != http.StatusOK || !result.Valid || result.Records != 1 {
+		t.Errorf("expected a valid chain, got %d %+v", rr.Code, result)
+	}
+}
+
+func TestNeedsDB_Disabled(t *testing.T) {
+	h := mockHandlers(nil)
+	called := false
+	handler := h.NeedsDB(func(w http.ResponseWriter, r *http.Request) { called = true })
+
+	rr := httptest.NewRecorder()
+	handler(rr, httptest.NewRequest(http.MethodGet, "/api/history?ioc=1.2.3.4", nil))
+	if rr.Code != http.StatusServiceUnavailable || called {
+		t.Errorf("expected 503 without calling the handler, got %d (called %v)", rr.Code, called)
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	server := fakeFakeula()
+	defer server.Close()
+	h := newHandlers(t, testConfig(server.URL))
+
+	rr := httptest.NewRecorder()
+	h.Readyz(rr, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	var report health.Report
+	if err := json.NewDecoder(rr.Body).Decode(&report); err != nil {
+		t.Fatal(err)
+	}
+	if rr.Code != http.StatusOK || report.Status != health.OK || report.ConfigVersion == "" {
+		t.Errorf("expected a ready report, got %d %+v", rr.Code, report)
+	}
+	if res, ok := report.Dependencies["fakeula"]; !ok || res.Status != health.Up || res.Hard {
+		t.Errorf("expected FAKEula up and soft, got %+v", report.Dependencies)
+	}
+	if _, ok := report.Dependencies["database"]; ok {
+		t.Error("a disabled database should not be checked")
+	}
+
+	// Only a hard dependency takes the instance out of rotation
+	down := func(context.Context) error { return errors.New("connection refused") }
+	h.Checks = []health.Check{{Name: "fakeula", Probe: down}}
+	rr = httptest.NewRecorder()
+	h.Readyz(rr, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), health.Degraded) {
+		t.Errorf("expected 200 degraded, got %d %s", rr.Code, rr.Body)
 	}
-	want := "abcd1234"
-	if got != want {
-		t.Errorf("md5FromCBR() = %q; want %q", got, want)
+	h.Checks = append(h.Checks, health.Check{Name: "database", Hard: true, Probe: down})
+	rr = httptest.NewRecorder()
+	h.Readyz(rr, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rr.Code != http.StatusServiceUnavailable || !strings.Contains(rr.Body.String(), "connection refused") {
+		t.Errorf("expected 503 with the error, got %d %s", rr.Code, rr.Body)
 	}
 }
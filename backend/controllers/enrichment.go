@@ -0,0 +1,139 @@
+package controllers
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+
+	"github.com/0x-Singularity/Augury/extractor"
+	"github.com/0x-Singularity/Augury/indicator"
+	"github.com/0x-Singularity/Augury/logging"
+	"github.com/0x-Singularity/Augury/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// iocResult is the outcome of enriching a single IOC
+type iocResult struct {
+	IOC      string
+	Data     map[string]interface{}
+	Failures []sourceFailure
+	Err      error
+}
+
+// enrichStream runs queryFakeulaForIOC for every IOC using a bounded worker pool and
+// sends each result as soon as it is ready. The channel is closed once every IOC has
+// been handled or ctx is cancelled; IOCs not yet started when ctx ends are skipped.
+// At most enrichment.ioc_workers IOCs are enriched at once.
+func (h *Handlers) enrichStream(ctx context.Context, iocs []string) <-chan iocResult {
+	results := make(chan iocResult)
+
+	workers := h.enrichment.IOCWorkers
+	if workers > len(iocs) {
+		workers = len(iocs)
+	}
+
+	jobs := make(chan string)
+	var wg sync.WaitGroup
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ioc := range jobs {
+				data, failures, err := h.enrichIOC(ctx, ioc)
+				select {
+				case results <- iocResult{IOC: ioc, Data: data, Failures: failures, Err: err}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	go func() {
+		defer close(jobs)
+		for _, ioc := range iocs {
+			select {
+			case jobs <- ioc:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	return results
+}
+
+// enrichIOC runs queryFakeulaForIOC in a span of its own, so a trace shows which IOC,
+// and below it which source, a slow extraction spent its time on
+func (h *Handlers) enrichIOC(ctx context.Context, ioc string) (map[string]interface{}, []sourceFailure, error) {
+	ctx, span := tracing.Start(ctx, "enrich IOC", attribute.String("augury.ioc", ioc))
+	data, failures, err := h.queryFakeulaForIOC(ctx, ioc)
+	span.SetAttributes(attribute.Int("augury.failed_sources", len(failures)))
+	tracing.End(span, err)
+	return data, failures, err
+}
+
+// enrichIOCs enriches every IOC in parallel and returns the same shape the serial
+// loop used to build: IOC -> raw results. IOCs that fail are logged and left out, as before.
+func (h *Handlers) enrichIOCs(ctx context.Context, iocs []string) map[string]interface{} {
+	rawResults := make(map[string]interface{}, len(iocs))
+
+	for res := range h.enrichStream(ctx, iocs) {
+		if res.Err != nil {
+			slog.ErrorContext(logging.WithIOC(ctx, res.IOC), "Error processing IOC", "err", res.Err)
+			continue
+		}
+		rawResults[res.IOC] = res.Data
+	}
+	return rawResults
+}
+
+// uniqueIOCs returns the values of the extracted indicators normalized and without repeats,
+// so the same indicator is not enriched twice (the response is keyed by IOC, so duplicates
+// were overwritten anyway). Both the JSON and the streaming extraction enrich this list.
+func uniqueIOCs(indicators []extractor.Indicator) []string {
+	seen := make(map[string]bool, len(indicators))
+	out := make([]string, 0, len(indicators))
+	for _, ioc := range extractor.Values(indicators) {
+		ioc = indicator.Canonical(ioc)
+		if seen[ioc] {
+			continue
+		}
+		seen[ioc] = true
+		out = append(out, ioc)
+	}
+	return out
+}
+
+// sourceGroup runs upstream queries for a single IOC concurrently, bounded by a semaphore
+type sourceGroup struct {
+	wg  sync.WaitGroup
+	sem chan struct{}
+}
+
+func newSourceGroup(limit int) *sourceGroup {
+	return &sourceGroup{sem: make(chan struct{}, limit)}
+}
+
+// Go schedules fn once a slot is free. Work that depends on an earlier result
+// (CBR -> binary) should be chained inside a single fn.
+func (g *sourceGroup) Go(fn func()) {
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		g.sem <- struct{}{}
+		defer func() { <-g.sem }()
+		fn()
+	}()
+}
+
+// Wait blocks until every scheduled query has finished
+func (g *sourceGroup) Wait() {
+	g.wg.Wait()
+}
@@ -1,193 +1,236 @@
 package controllers
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
-	"os"
-
+	"sync"
+
+	"github.com/0x-Singularity/Augury/audit"
+	"github.com/0x-Singularity/Augury/enrich"
+	"github.com/0x-Singularity/Augury/extractor"
+	"github.com/0x-Singularity/Augury/fakeula"
+	"github.com/0x-Singularity/Augury/indicator"
+	"github.com/0x-Singularity/Augury/logging"
+	"github.com/0x-Singularity/Augury/metrics"
 	"github.com/0x-Singularity/Augury/models"
-	"github.com/0x-Singularity/Augury/parser"
+	"github.com/0x-Singularity/Augury/ratelimit"
 )
 
 // ExtractFromText receives a block of text, extracts IOCs, and queries FAKEula for each one
-func ExtractFromText(w http.ResponseWriter, r *http.Request) {
-	body, err := io.ReadAll(r.Body)
-	if err != nil {
-		http.Error(w, "Could not read input", http.StatusBadRequest)
+func (h *Handlers) ExtractFromText(w http.ResponseWriter, r *http.Request) {
+	indicators, iocs, ok := h.extractIOCs(w, r)
+	if !ok {
 		return
 	}
 
-	// Call FAKEula extractor
-	extractURL := os.Getenv("FAKEULA_API_URL") + "extract"
-	req, err := http.NewRequest("POST", extractURL, bytes.NewBuffer(body))
-	if err != nil {
-		http.Error(w, "Failed to create extract request", http.StatusInternalServerError)
-		return
-	}
-	req.SetBasicAuth(os.Getenv("FAKEULA_USER"), os.Getenv("FAKEULA_PASS"))
-	req.Header.Set("Content-Type", "text/plain")
+	// Enrich every IOC in parallel, collecting raw results before parsing
+	rawResults := h.enrichIOCs(withFresh(r.Context(), r), iocs)
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		http.Error(w, "Failed to call FAKEula extract", http.StatusInternalServerError)
-		return
-	}
-	defer resp.Body.Close()
+	writeJSON(w, r, map[string]interface{}{
+		"data":       rawResults,
+		"indicators": indicators,
+	})
+}
 
-	var extractResult map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&extractResult); err != nil {
-		http.Error(w, "Failed to parse extract response", http.StatusInternalServerError)
-		return
+// extractIOCs reads the request body and extracts indicators from it with the selected
+// extraction backend, returning them along with the distinct IOCs to enrich (see uniqueIOCs).
+// On failure it writes the error response and returns ok=false.
+func (h *Handlers) extractIOCs(w http.ResponseWriter, r *http.Request) (indicators []extractor.Indicator, iocs []string, ok bool) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Could not read input", http.StatusBadRequest)
+		return nil, nil, false
 	}
 
-	iocs := extractIOCsFromResponse(extractResult)
-	userName := r.Header.Get("X-User-Name")
-	if userName == "" {
-		userName = "unknown"
+	backend, err := h.extractionBackend(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, nil, false
 	}
 
-	// Collect raw results before parsing
-	rawResults := map[string]interface{}{}
-
-	for _, ioc := range iocs {
-		rawData, err := queryFakeulaForIOC(ioc, userName)
-		if err != nil {
-			log.Printf("Error processing IOC %s: %v", ioc, err)
-			continue
-		}
-		rawResults[ioc] = rawData
+	indicators, err = backend.Extract(r.Context(), string(body))
+	if wait, limited := ratelimit.RetryAfter(err); limited {
+		ratelimit.WriteTooManyRequests(w, wait)
+		return nil, nil, false
 	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"data": rawResults,
-	})
-}
-
-// cbr response struct to parse the CBR response
-type cbrResponse struct {
-	Data []struct {
-		Process struct {
-			Hash struct {
-				MD5 string `json:"md5"`
-			} `json:"hash"`
-		} `json:"process"`
-	} `json:"data"`
+	if err != nil {
+		slog.ErrorContext(r.Context(), "IOC extraction failed", "err", err)
+		http.Error(w, "Failed to call FAKEula extract", http.StatusInternalServerError)
+		return nil, nil, false
+	}
+
+	audit.SetIOCs(r.Context(), extractor.Values(indicators)...)
+	iocs = uniqueIOCs(indicators)
+	metrics.ObserveExtraction(len(iocs))
+
+	// The request itself cost one token; every further IOC enriched costs another, so one
+	// huge paste can't monopolise FAKEula. Repeats of an IOC are looked up once and cost
+	// nothing. A paste with more IOCs than the caller's bucket holds is refused outright.
+	err = ratelimit.Charge(r.Context(), len(iocs)-1)
+	var tooLarge *ratelimit.TooLargeError
+	if errors.As(err, &tooLarge) {
+		slog.WarnContext(r.Context(), "Refused extraction above the rate limit burst", "iocs", len(iocs), "burst", tooLarge.Burst)
+		http.Error(w, fmt.Sprintf("Too many IOCs: found %d, at most %d can be looked up per request", len(iocs), tooLarge.Burst),
+			http.StatusRequestEntityTooLarge)
+		return nil, nil, false
+	}
+	if wait, limited := ratelimit.RetryAfter(err); limited {
+		slog.WarnContext(r.Context(), "Rate limited extraction", "iocs", len(iocs))
+		ratelimit.WriteTooManyRequests(w, wait)
+		return nil, nil, false
+	}
+	return indicators, iocs, true
 }
 
-// helper
-func MD5FromCBR(raw json.RawMessage) (string, error) {
-	var resp cbrResponse
-	if err := json.Unmarshal(raw, &resp); err != nil {
-		return "", err
+// extractionBackend picks the extractor from ?extractor=, falling back to the
+// enrichment.extractor setting
+func (h *Handlers) extractionBackend(r *http.Request) (extractor.Backend, error) {
+	name := r.URL.Query().Get("extractor")
+	if name == "" {
+		name = h.enrichment.Extractor
 	}
-	if len(resp.Data) > 0 {
-		return resp.Data[0].Process.Hash.MD5, nil
+	switch name {
+	case "", extractor.BackendNative:
+		return h.native, nil
+	case extractor.BackendFakeula:
+		return extractor.Fakeula{API: h.API}, nil
 	}
-	return "", nil // not found
+	return nil, fmt.Errorf("unknown extractor %q", name)
 }
-func extractIOCsFromResponse(response map[string]interface{}) []string {
-	iocs := []string{}
-	data, ok := response["data"].([]interface{})
-	if !ok {
-		return iocs
-	}
-	for _, item := range data {
-		if obj, ok := item.(map[string]interface{}); ok {
-			if threat, ok := obj["threat"].(map[string]interface{}); ok {
-				if indicator, ok := threat["indicator"].(map[string]interface{}); ok {
-					if desc, ok := indicator["description"].(string); ok {
-						iocs = append(iocs, desc)
-					}
-				}
-			}
-		}
-	}
-	return iocs
+
+// sourceFailure records one upstream source that could not be queried for an IOC
+type sourceFailure struct {
+	IOC    string `json:"ioc"`
+	Source string `json:"source"`
+	Error  string `json:"error"`
 }
 
-func queryFakeulaForIOC(ioc, userName string) (map[string]interface{}, error) {
-	baseURL := os.Getenv("FAKEULA_API_URL")
-	authUser := os.Getenv("FAKEULA_USER")
-	authPass := os.Getenv("FAKEULA_PASS")
-	client := &http.Client{}
+// queryFakeulaForIOC queries the enrichment sources that make sense for one IOC's type,
+// logs the lookup and returns the raw per-source results along with any sources that failed
+func (h *Handlers) queryFakeulaForIOC(ctx context.Context, ioc string) (map[string]interface{}, []sourceFailure, error) {
+	ioc, iocType := indicator.Normalize(ioc)
+	ctx = logging.WithIOC(ctx, ioc)
 
 	rawResponse := make(map[string]interface{})
-
-	//Query CBR first (to look for a hash) ---
-	cbrURL := fmt.Sprintf("%scbr/%s", baseURL, ioc)
-	cbrData, err := fetchJSON(client, cbrURL, authUser, authPass)
-	if err != nil {
-		log.Printf("CBR query failed for %s: %v", ioc, err)
-	} else {
-		rawResponse["cbr"] = cbrData
-	}
-
-	hashToQuery := ioc // fallback
-	if cbrData != nil {
-		if b, _ := json.Marshal(cbrData); len(b) > 0 {
-			if md5, _ := MD5FromCBR(b); md5 != "" {
-				hashToQuery = md5
-				log.Printf("Using MD5 from CBR (%s) for binary lookup", md5)
+	var failures []sourceFailure
+	var mu sync.Mutex
+	set := func(key string, value interface{}) {
+		mu.Lock()
+		rawResponse[key] = value
+		mu.Unlock()
+	}
+	fail := func(source, target string, err error) {
+		slog.WarnContext(logging.WithSource(ctx, source), "Source query failed", "target", target, "err", err)
+		mu.Lock()
+		failures = append(failures, sourceFailure{IOC: ioc, Source: source, Error: err.Error()})
+		mu.Unlock()
+	}
+	sources := make(map[string]map[string]interface{}) // per-source results for the snapshot
+	cacheStatuses := make(map[string]cacheStatus)
+	cached := func(source string, status cacheStatus) {
+		mu.Lock()
+		cacheStatuses[source] = status
+		mu.Unlock()
+	}
+	// lookup queries one source (through the response cache) and records the result
+	lookup := func(src enrich.Source, target string) (*fakeula.Response, bool) {
+		resp, status, err := cachedLookup(ctx, h, src.Name, target, func() (*fakeula.Response, error) {
+			return src.Enricher.Enrich(ctx, h.API, target)
+		})
+		if err != nil {
+			fail(src.Name, target, err)
+			return nil, false
+		}
+		cached(src.Name, status)
+		if len(resp.Data) > 0 {
+			audit.AddSources(ctx, src.Name)
+		}
+		data := resp.Map()
+		set(src.Name, data)
+		mu.Lock()
+		sources[src.Name] = data
+		mu.Unlock()
+		return resp, true
+	}
+	// query looks src up, if it accepts the IOC or its dependency found something to
+	// look up, and then its dependents with its response
+	var query func(src enrich.Source, dep *fakeula.Response)
+	query = func(src enrich.Source, dep *fakeula.Response) {
+		target := ""
+		if src.Supports(iocType) {
+			target = ioc
+		}
+		if dep != nil && src.Input != nil {
+			if derived := src.Input(dep); derived != "" {
+				target = derived
+				slog.DebugContext(ctx, "Using dependency result as input", "source", src.Name, "input", derived)
 			}
 		}
-	}
-	rawResponse["hash"] = hashToQuery
-	// Now hit the Binary endpoint (with hash or ioc) ---
-	binaryURL := fmt.Sprintf("%scbr/binary/%s", baseURL, hashToQuery)
-	binaryData, err := fetchJSON(client, binaryURL, authUser, authPass)
-	if err != nil {
-		log.Printf("Binary query failed for %s: %v", hashToQuery, err)
-	} else {
-		rawResponse["binary"] = binaryData
+		var resp *fakeula.Response
+		if target != "" {
+			if src.InputKey != "" {
+				set(src.InputKey, target)
+			}
+			resp, _ = lookup(src, target)
+		}
+		for _, next := range h.Sources.Dependents(src.Name) {
+			query(next, resp)
+		}
 	}
 
-	// --- Query Netflow ---
-	netflowURL := fmt.Sprintf("%soil/netflow/%s", baseURL, ioc)
-	netflowData, err := fetchJSON(client, netflowURL, authUser, authPass)
-	if err != nil {
-		log.Printf("Netflow query failed for %s: %v", ioc, err)
-	} else {
-		rawResponse["netflow"] = netflowData
+	// Independent sources run in parallel; a source and its dependents (CBR and binary)
+	// stay chained because the dependents need its result
+	group := newSourceGroup(h.enrichment.SourceWorkers)
+	for _, src := range h.Sources.Roots() {
+		group.Go(func() { query(src, nil) })
 	}
 
-	// --- Query Security Logs (CoxSight) ---
-	coxsightURL := fmt.Sprintf("%soil/coxsight/%s", baseURL, ioc)
-	coxsightData, err := fetchJSON(client, coxsightURL, authUser, authPass)
-	if err != nil {
-		log.Printf("CoxSight query failed for %s: %v", ioc, err)
-	} else {
-		rawResponse["coxsight"] = coxsightData
+	// --- Get PDNS Result Count ---
+	resultCount := 1 // same fallback pdnsResultCount uses when there is no summary
+	if pdns, ok := h.Sources.Lookup(enrich.PDNS); ok && pdns.Supports(iocType) {
+		group.Go(func() {
+			count, status, err := h.pdnsResultCount(ctx, ioc)
+			if err != nil {
+				fail(enrich.PDNS, ioc, err)
+			} else {
+				cached(enrich.PDNS, status)
+				if count > 0 {
+					audit.AddSources(ctx, enrich.PDNS)
+				}
+			}
+			resultCount = count
+		})
 	}
 
-	// --- Query Asset Inventory ---
-	assetURL := fmt.Sprintf("%sasset/%s", baseURL, ioc)
-	assetData, err := fetchJSON(client, assetURL, authUser, authPass)
-	if err != nil {
-		log.Printf("Asset query failed for %s: %v", ioc, err)
-	} else {
-		rawResponse["asset"] = assetData
-	}
+	group.Wait()
+	rawResponse["type"] = iocType
+	rawResponse["cache"] = cacheStatuses
 
-	// --- Get PDNS Result Count ---
-	resultCount := fetchPDNSResultCount(ioc)
+	// The caller went away (e.g. a streaming client disconnected); don't log a partial lookup
+	if err := ctx.Err(); err != nil {
+		return nil, failures, err
+	}
 
-	// If AUGURY_SKIP_DB=1, don’t touch the real DB at all
-	if os.Getenv("AUGURY_SKIP_DB") != "1" {
-		// --- Log the query ---
-		if err := models.InsertQueryLog(ioc, resultCount, userName); err != nil {
-			log.Println("Failed to log IOC lookup:", err)
+	// Without a database (database.disabled), don’t touch the real DB at all
+	if !h.skipDB {
+		// --- Log the query with a snapshot, and diff it against the previous lookup ---
+		logID, changes, err := h.recordLookup(ctx, ioc, iocType, resultCount, h.parseSources(sources), sources)
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to log IOC lookup", "err", err)
+		} else {
+			rawResponse["log_id"] = logID
+			rawResponse["changes"] = changes
 		}
 
 		// --- Retrieve and attach query logs ---
-		logEntry, err := models.GetQueryLog(ioc)
+		logEntry, err := models.GetQueryLog(ctx, ioc)
 		if err != nil {
-			log.Println("Failed to retrieve IOC log:", err)
+			slog.ErrorContext(ctx, "Failed to retrieve IOC log", "err", err)
 		}
 		if logEntry != nil {
 			var genericLogs []interface{}
@@ -197,392 +240,28 @@ func queryFakeulaForIOC(ioc, userName string) (map[string]interface{}, error) {
 		} else {
 			rawResponse["query_log"] = []interface{}{}
 		}
-		return rawResponse, nil
-	}
-
-	//SKIP DB Logging for testing
-	rawResponse = map[string]interface{}{}
-	return rawResponse, nil
-}
-
-func fetchJSON(client *http.Client, url, user, pass string) (interface{}, error) {
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, err
-	}
-	req.SetBasicAuth(user, pass)
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	var result interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return nil, err
-	}
-	return result, nil
-}
-
-func fetchPDNSResultCount(ioc string) int {
-	baseURL := os.Getenv("FAKEULA_API_URL")
-	url := fmt.Sprintf(baseURL+"/pdns/%s/_summary", ioc)
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		log.Println("Failed to create PDNS summary request:", err)
-		return 1
-	}
-
-	req.SetBasicAuth(os.Getenv("FAKEULA_USER"), os.Getenv("FAKEULA_PASS"))
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		log.Println("PDNS summary request failed:", err)
-		return 1
-	}
-	defer resp.Body.Close()
-
-	var summary struct {
-		Data []struct {
-			NumResults int `json:"num_results"`
-		} `json:"data"`
-	}
-
-	if err := json.NewDecoder(resp.Body).Decode(&summary); err != nil {
-		log.Println("Failed to decode PDNS summary:", err)
-		return 1
-	}
-
-	if len(summary.Data) > 0 {
-		log.Printf("PDNS Result Count for %s: %d", ioc, summary.Data[0].NumResults)
-		return summary.Data[0].NumResults
+		return rawResponse, failures, nil
 	}
 
-	log.Printf("No data found in PDNS summary for %s", ioc)
-	return 1
+	// Not logged, so there is no log ID, change report or history to attach
+	return rawResponse, failures, nil
 }
 
-// function to query all OIL sources
-func QueryAllOIL(w http.ResponseWriter, r *http.Request) {
-	ioc := r.URL.Query().Get("ioc")
-	if ioc == "" {
-		http.Error(w, "IOC parameter is required", http.StatusBadRequest)
-		return
-	}
-
-	baseURL := os.Getenv("FAKEULA_API_URL")
-	client := &http.Client{}
-	user := os.Getenv("FAKEULA_USER")
-	pass := os.Getenv("FAKEULA_PASS")
-
-	url := fmt.Sprintf("%soil/%s", baseURL, ioc)
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		http.Error(w, "Failed to build OIL query", http.StatusInternalServerError)
-		return
-	}
-	req.SetBasicAuth(user, pass)
-
-	resp, err := client.Do(req)
-	if err != nil {
-		http.Error(w, "Failed to query OIL", http.StatusInternalServerError)
-		return
-	}
-	defer resp.Body.Close()
-
-	var oilData map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&oilData); err != nil {
-		http.Error(w, "Error decoding OIL data", http.StatusInternalServerError)
-		return
-	}
-
-	//Run oilData through the parser
-
-	parsed := parser.FormatFakeulaResponse(oilData)
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(parsed)
-}
-
-// QueryPDNS queries the Passive DNS (PDNS) endpoint for a given IOC
-func QueryPDNS(w http.ResponseWriter, r *http.Request) {
-	ioc := r.URL.Query().Get("ioc")
-	if ioc == "" {
-		http.Error(w, "IOC parameter is required", http.StatusBadRequest)
-		return
-	}
-
-	baseURL := os.Getenv("FAKEULA_API_URL")
-	client := &http.Client{}
-	user := os.Getenv("FAKEULA_USER")
-	pass := os.Getenv("FAKEULA_PASS")
-
-	url := fmt.Sprintf("%spdns/%s", baseURL, ioc)
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		http.Error(w, "Failed to build PDNS query", http.StatusInternalServerError)
-		return
-	}
-	req.SetBasicAuth(user, pass)
-
-	resp, err := client.Do(req)
-	if err != nil {
-		http.Error(w, "Failed to query PDNS", http.StatusInternalServerError)
-		return
-	}
-	defer resp.Body.Close()
-
-	var pdnsData map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&pdnsData); err != nil {
-		http.Error(w, "Error decoding PDNS data", http.StatusInternalServerError)
-		return
-	}
-
-	// Run PDNS data through the parser
-	parsed := parser.FormatFakeulaResponse(pdnsData)
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(parsed)
-}
-
-// QueryLDAP queries the LDAP endpoint for a given IOC
-func QueryLDAP(w http.ResponseWriter, r *http.Request) {
-	ioc := r.URL.Query().Get("ioc")
-	if ioc == "" {
-		http.Error(w, "IOC parameter is required", http.StatusBadRequest)
-		return
-	}
-
-	baseURL := os.Getenv("FAKEULA_API_URL")
-	client := &http.Client{}
-	user := os.Getenv("FAKEULA_USER")
-	pass := os.Getenv("FAKEULA_PASS")
-
-	url := fmt.Sprintf("%sldap/%s", baseURL, ioc)
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		http.Error(w, "Failed to build LDAP query", http.StatusInternalServerError)
-		return
-	}
-	req.SetBasicAuth(user, pass)
-
-	resp, err := client.Do(req)
-	if err != nil {
-		http.Error(w, "Failed to query LDAP", http.StatusInternalServerError)
-		return
-	}
-	defer resp.Body.Close()
-
-	var ldapData map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&ldapData); err != nil {
-		http.Error(w, "Error decoding LDAP data", http.StatusInternalServerError)
-		return
-	}
-
-	// Run LDAP data through the parser
-	parsed := parser.FormatFakeulaResponse(ldapData)
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(parsed)
-}
-
-// QueryGeoIP queries the GeoIP endpoint for a given IOC
-func QueryGeoIP(w http.ResponseWriter, r *http.Request) {
-	ioc := r.URL.Query().Get("ioc")
-	if ioc == "" {
-		http.Error(w, "IOC parameter is required", http.StatusBadRequest)
-		return
-	}
-
-	baseURL := os.Getenv("FAKEULA_API_URL")
-	client := &http.Client{}
-	user := os.Getenv("FAKEULA_USER")
-	pass := os.Getenv("FAKEULA_PASS")
-
-	url := fmt.Sprintf("%sgeo/%s", baseURL, ioc)
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		http.Error(w, "Failed to build GeoIP query", http.StatusInternalServerError)
-		return
-	}
-	req.SetBasicAuth(user, pass)
-
-	resp, err := client.Do(req)
-	if err != nil {
-		http.Error(w, "Failed to query GeoIP", http.StatusInternalServerError)
-		return
-	}
-	defer resp.Body.Close()
-
-	var geoData map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&geoData); err != nil {
-		http.Error(w, "Error decoding GeoIP data", http.StatusInternalServerError)
-		return
-	}
-
-	// Run GeoIP data through the parser
-	parsed := parser.FormatFakeulaResponse(geoData)
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(parsed)
-}
-
-// QueryBinary queries the Binary endpoint for a given IOC
-func QueryBinary(w http.ResponseWriter, r *http.Request) {
-	ioc := r.URL.Query().Get("ioc")
-	if ioc == "" {
-		http.Error(w, "IOC parameter is required", http.StatusBadRequest)
-		return
-	}
-
-	baseURL := os.Getenv("FAKEULA_API_URL")
-	client := &http.Client{}
-	user := os.Getenv("FAKEULA_USER")
-	pass := os.Getenv("FAKEULA_PASS")
-
-	url := fmt.Sprintf("%scbr/binary/%s", baseURL, ioc)
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		http.Error(w, "Failed to build Binary query", http.StatusInternalServerError)
-		return
-	}
-	req.SetBasicAuth(user, pass)
-
-	resp, err := client.Do(req)
-	if err != nil {
-		http.Error(w, "Failed to query Binary", http.StatusInternalServerError)
-		return
-	}
-	defer resp.Body.Close()
-
-	var binaryData map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&binaryData); err != nil {
-		http.Error(w, "Error decoding Binary data", http.StatusInternalServerError)
-		return
-	}
-
-	// Run Binary data through the parser
-	parsed := parser.FormatFakeulaResponse(binaryData)
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(parsed)
-}
-
-// QueryVPN queries the VPN endpoint for a given IOC
-func QueryVPN(w http.ResponseWriter, r *http.Request) {
-	ioc := r.URL.Query().Get("ioc")
-	if ioc == "" {
-		http.Error(w, "IOC parameter is required", http.StatusBadRequest)
-		return
-	}
-
-	baseURL := os.Getenv("FAKEULA_API_URL")
-	client := &http.Client{}
-	user := os.Getenv("FAKEULA_USER")
-	pass := os.Getenv("FAKEULA_PASS")
-
-	url := fmt.Sprintf("%svpn/%s", baseURL, ioc)
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		http.Error(w, "Failed to build VPN query", http.StatusInternalServerError)
-		return
-	}
-	req.SetBasicAuth(user, pass)
-
-	resp, err := client.Do(req)
-	if err != nil {
-		http.Error(w, "Failed to query VPN", http.StatusInternalServerError)
-		return
-	}
-	defer resp.Body.Close()
-
-	var vpnData map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&vpnData); err != nil {
-		http.Error(w, "Error decoding VPN data", http.StatusInternalServerError)
-		return
-	}
-
-	// No specific parser for VPN, return raw data
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(vpnData)
-}
-
-func QueryCBR(w http.ResponseWriter, r *http.Request) {
-	ioc := r.URL.Query().Get("ioc")
-	if ioc == "" {
-		http.Error(w, "IOC parameter is required", http.StatusBadRequest)
-		return
-	}
-
-	baseURL := os.Getenv("FAKEULA_API_URL")
-	client := &http.Client{}
-	user := os.Getenv("FAKEULA_USER")
-	pass := os.Getenv("FAKEULA_PASS")
-
-	url := fmt.Sprintf("%scbr/%s", baseURL, ioc)
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		http.Error(w, "Failed to build CBR query", http.StatusInternalServerError)
-		return
-	}
-	req.SetBasicAuth(user, pass)
-
-	resp, err := client.Do(req)
-	if err != nil {
-		http.Error(w, "Failed to query CBR", http.StatusInternalServerError)
-		return
-	}
-	defer resp.Body.Close()
-
-	var cbrData map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&cbrData); err != nil {
-		http.Error(w, "Error decoding CBR data", http.StatusInternalServerError)
-		return
-	}
-
-	//parse the CBR data
-	parsed := parser.FormatFakeulaResponse(cbrData)
-	w.Header().Set("Content-Type", "application/json")
-
-	json.NewEncoder(w).Encode(parsed)
-}
-func QueryHost(w http.ResponseWriter, r *http.Request) {
-	ioc := r.URL.Query().Get("ioc")
-	if ioc == "" {
-		http.Error(w, "IOC parameter is required", http.StatusBadRequest)
-		return
-	}
-
-	baseURL := os.Getenv("FAKEULA_API_URL")
-	client := &http.Client{}
-	user := os.Getenv("FAKEULA_USER")
-	pass := os.Getenv("FAKEULA_PASS")
-
-	url := fmt.Sprintf("%scbr/sensor/%s", baseURL, ioc)
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		http.Error(w, "Failed to build Host query", http.StatusInternalServerError)
-		return
-	}
-	req.SetBasicAuth(user, pass)
-
-	resp, err := client.Do(req)
+// pdnsResultCount returns the number of passive DNS results for an IOC.
+// It falls back to 1 when the summary is empty or cannot be fetched, matching the old behaviour.
+func (h *Handlers) pdnsResultCount(ctx context.Context, ioc string) (int, cacheStatus, error) {
+	summary, status, err := cachedLookup(ctx, h, "pdns_summary", ioc, func() (*fakeula.PDNSSummary, error) {
+		return h.API.PDNSSummary(ctx, ioc)
+	})
 	if err != nil {
-		http.Error(w, "Failed to query Host", http.StatusInternalServerError)
-		return
+		return 1, status, err
 	}
-	defer resp.Body.Close()
 
-	var hostData map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&hostData); err != nil {
-		http.Error(w, "Error decoding CBR data", http.StatusInternalServerError)
-		return
+	if summary.NumResults > 0 {
+		slog.DebugContext(ctx, "PDNS result count", "results", summary.NumResults)
+		return summary.NumResults, status, nil
 	}
 
-	//parse the CBR data
-	parsed := parser.FormatFakeulaResponse(hostData)
-	w.Header().Set("Content-Type", "application/json")
-
-	json.NewEncoder(w).Encode(parsed)
+	slog.DebugContext(ctx, "No data found in PDNS summary")
+	return 1, status, nil
 }
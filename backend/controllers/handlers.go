@@ -0,0 +1,72 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/0x-Singularity/Augury/audit"
+	"github.com/0x-Singularity/Augury/config"
+	"github.com/0x-Singularity/Augury/enrich"
+	"github.com/0x-Singularity/Augury/extractor"
+	"github.com/0x-Singularity/Augury/fakeula"
+	"github.com/0x-Singularity/Augury/health"
+	"github.com/0x-Singularity/Augury/models"
+)
+
+// Handlers serves the endpoints that call FAKEula or read the audit log. It holds their
+// dependencies and settings, built once at startup by New; tests build their own with a
+// mock API and in-memory stores. Endpoints that only read the database are plain functions.
+type Handlers struct {
+	API fakeula.API
+	// Responses caches upstream responses between lookups; nil turns the cache off
+	Responses ResponseStore
+	// Snapshots logs lookups for diffing; nil when there is no database
+	Snapshots SnapshotStore
+	// Audit is the log VerifyAudit checks; nil when there is no database
+	Audit audit.Store
+	// Checks are the dependencies Readyz probes
+	Checks []health.Check
+	// Sources are the enrichment sources ExtractFromText and QuerySource use
+	Sources *enrich.Registry
+
+	configVersion string
+
+	enrichment config.Enrichment
+	cache      config.Cache
+	native     extractor.Native
+	skipDB     bool // don't log lookups or attach their history
+}
+
+// New builds the handlers from cfg, calling FAKEula through api
+func New(cfg *config.Config, api fakeula.API) *Handlers {
+	h := &Handlers{
+		API:        api,
+		Sources:    enrich.Default,
+		enrichment: cfg.Enrichment,
+		cache:      cfg.Cache,
+		native:     extractor.NewNative(cfg.Enrichment.InternalHostPrefixes),
+		skipDB:     cfg.Database.Disabled,
+
+		configVersion: cfg.Version(),
+	}
+	if !h.skipDB {
+		h.Responses = dbResponseStore{}
+		h.Snapshots = dbSnapshotStore{}
+		h.Audit = audit.DBStore()
+		h.Checks = append(h.Checks, health.Check{Name: "database", Hard: true, Probe: models.PingDB})
+	}
+	if pinger, ok := api.(fakeula.Pinger); ok {
+		h.Checks = append(h.Checks, health.Check{Name: "fakeula", Hard: cfg.Fakeula.Required, Probe: pinger.Ping})
+	}
+	return h
+}
+
+// NeedsDB wraps a handler that reads or writes the database so it answers 503 while the
+// database is disabled
+func (h *Handlers) NeedsDB(next http.HandlerFunc) http.HandlerFunc {
+	if !h.skipDB {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Unavailable without a database", http.StatusServiceUnavailable)
+	}
+}
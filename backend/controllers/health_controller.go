@@ -0,0 +1,30 @@
+package controllers
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/0x-Singularity/Augury/health"
+)
+
+// Healthz is the liveness probe: it answers as long as the process is serving
+func Healthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": health.OK})
+}
+
+// Readyz is the readiness probe. It reports every dependency's status and latency and the
+// config version, and answers 503 only while a hard dependency is down.
+func (h *Handlers) Readyz(w http.ResponseWriter, r *http.Request) {
+	report := health.Run(r.Context(), h.Checks)
+	report.ConfigVersion = h.configVersion
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if !report.Ready() {
+		slog.WarnContext(r.Context(), "Not ready", "dependencies", report.Dependencies)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(report)
+}
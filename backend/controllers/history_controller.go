@@ -0,0 +1,121 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/0x-Singularity/Augury/indicator"
+	"github.com/0x-Singularity/Augury/models"
+)
+
+// History lists past lookups from ioc_query_log, newest first by default.
+//
+// Filters: user, ioc (substring), type (ipv4, domain, ...), from and to (RFC 3339 or
+// YYYY-MM-DD; a bare "to" date includes that whole day) and min_results.
+// Ordering: sort (last_lookup, result_count, ioc, user_name) and order (asc or desc).
+// Paging: limit (up to 500) and cursor, taken from next_cursor of the previous page.
+func History(w http.ResponseWriter, r *http.Request) {
+	filter, err := historyFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	page, err := models.QueryHistory(r.Context(), filter)
+	if errors.Is(err, models.ErrInvalidCursor) {
+		http.Error(w, "Invalid cursor", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to query history", "err", err)
+		http.Error(w, "Error retrieving history", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
+
+// historyFilter reads and validates the History query parameters
+func historyFilter(r *http.Request) (models.HistoryFilter, error) {
+	q := r.URL.Query()
+	f := models.HistoryFilter{
+		User:        strings.TrimSpace(q.Get("user")),
+		IOCContains: strings.TrimSpace(q.Get("ioc")),
+		Sort:        q.Get("sort"),
+		Cursor:      q.Get("cursor"),
+	}
+
+	if t := q.Get("type"); t != "" {
+		if !knownType(t) {
+			return f, errors.New("unknown type " + strconv.Quote(t))
+		}
+		f.IOCType = t
+	}
+	if f.Sort != "" && !models.ValidHistorySort(f.Sort) {
+		return f, errors.New("sort must be one of last_lookup, result_count, ioc, user_name")
+	}
+	switch strings.ToLower(q.Get("order")) {
+	case "", "desc":
+	case "asc":
+		f.Ascending = true
+	default:
+		return f, errors.New("order must be asc or desc")
+	}
+
+	var err error
+	if f.From, err = historyTime(q.Get("from"), false); err != nil {
+		return f, errors.New("from: " + err.Error())
+	}
+	if f.To, err = historyTime(q.Get("to"), true); err != nil {
+		return f, errors.New("to: " + err.Error())
+	}
+	if raw := q.Get("min_results"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			return f, errors.New("min_results must be a non-negative number")
+		}
+		f.MinResults = &n
+	}
+	if raw := q.Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			return f, errors.New("limit must be a positive number")
+		}
+		f.Limit = n
+	}
+	return f, nil
+}
+
+// historyTime parses an RFC 3339 time or a date. When endOfDay is set a date means
+// the end of that day, so to=2026-03-01 includes lookups made on March 1st.
+func historyTime(raw string, endOfDay bool) (*time.Time, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return &t, nil
+	}
+	t, err := time.Parse("2006-01-02", raw)
+	if err != nil {
+		return nil, errors.New("expected RFC 3339 time or YYYY-MM-DD date")
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+	return &t, nil
+}
+
+func knownType(t string) bool {
+	for _, known := range indicator.Types {
+		if string(known) == t {
+			return true
+		}
+	}
+	return false
+}
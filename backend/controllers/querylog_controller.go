@@ -2,21 +2,30 @@ package controllers
 
 import (
 	"encoding/json"
+	"log/slog"
 	"net/http"
+	"strconv"
+	"time"
 
+	"github.com/0x-Singularity/Augury/audit"
+	"github.com/0x-Singularity/Augury/diff"
+	"github.com/0x-Singularity/Augury/indicator"
 	"github.com/0x-Singularity/Augury/models" // Import the model package
+	"github.com/0x-Singularity/Augury/refang"
 )
 
 // LookupIOC handles IOC queries
 func LookupIOC(w http.ResponseWriter, r *http.Request) {
-	ioc := r.URL.Query().Get("ioc")
+	ioc := refang.IOC(r.URL.Query().Get("ioc"))
 	if ioc == "" {
 		http.Error(w, "IOC parameter is required", http.StatusBadRequest)
 		return
 	}
+	// Lookups are logged under the canonical form
+	ioc = indicator.Canonical(ioc)
 
 	// Check if IOC exists in database
-	logEntry, err := models.GetQueryLog(ioc)
+	logEntry, err := models.GetQueryLog(r.Context(), ioc)
 	if err != nil {
 		http.Error(w, "Error retrieving query log", http.StatusInternalServerError)
 		return
@@ -33,12 +42,116 @@ func LookupIOC(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(logEntry)
 }
 
-// LogIOC stores a new lookup entry
+// GetSnapshot returns the full results saved for one lookup (?log_id=), so an analyst can
+// reopen exactly what was seen at the time
+func GetSnapshot(w http.ResponseWriter, r *http.Request) {
+	logID, err := strconv.Atoi(r.URL.Query().Get("log_id"))
+	if err != nil || logID <= 0 {
+		http.Error(w, "A numeric log_id parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	snapshot, err := models.GetSnapshot(r.Context(), logID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to retrieve snapshot", "err", err)
+		http.Error(w, "Error retrieving snapshot", http.StatusInternalServerError)
+		return
+	}
+	if snapshot == nil {
+		http.Error(w, "Snapshot not found", http.StatusNotFound)
+		return
+	}
+
+	audit.SetIOCs(r.Context(), snapshot.IOC)
+	writeJSON(w, r, snapshot)
+}
+
+// diffResponse is what DiffIOC returns: the two lookups compared and what changed between them
+type diffResponse struct {
+	IOC      string          `json:"ioc"`
+	Current  snapshotSummary `json:"current"`
+	Previous snapshotSummary `json:"previous"`
+	Changes  diff.Report     `json:"changes"`
+}
+
+type snapshotSummary struct {
+	LogID     int       `json:"log_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// DiffIOC compares a lookup with the previous lookup of the same IOC and sources. With ?ioc=
+// it uses the latest lookup of that IOC; with ?log_id= it uses that specific lookup.
+func DiffIOC(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var current *models.Snapshot
+	var err error
+	if raw := r.URL.Query().Get("log_id"); raw != "" {
+		logID, convErr := strconv.Atoi(raw)
+		if convErr != nil || logID <= 0 {
+			http.Error(w, "log_id must be a positive number", http.StatusBadRequest)
+			return
+		}
+		current, err = models.GetSnapshot(ctx, logID)
+	} else {
+		ioc := indicator.Canonical(refang.IOC(r.URL.Query().Get("ioc")))
+		if ioc == "" {
+			http.Error(w, "IOC or log_id parameter is required", http.StatusBadRequest)
+			return
+		}
+		current, err = models.PreviousSnapshot(ctx, ioc, 0, nil)
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to retrieve snapshot", "err", err)
+		http.Error(w, "Error retrieving snapshot", http.StatusInternalServerError)
+		return
+	}
+	if current == nil {
+		http.Error(w, "No snapshot found for this lookup", http.StatusNotFound)
+		return
+	}
+	audit.SetIOCs(ctx, current.IOC)
+
+	curParsed, err := diff.Decode(current.Parsed)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to decode snapshot", "err", err)
+		http.Error(w, "Stored snapshot is unreadable", http.StatusInternalServerError)
+		return
+	}
+
+	// Compare with the last lookup of the same sources, e.g. a PDNS lookup with the last
+	// one that has PDNS results
+	sources := curParsed.Sources()
+	previous, err := models.PreviousSnapshot(ctx, current.IOC, current.LogID, sources)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to retrieve previous snapshot", "err", err)
+		http.Error(w, "Error retrieving snapshot", http.StatusInternalServerError)
+		return
+	}
+	if previous == nil {
+		http.Error(w, "IOC has no earlier lookup to compare with", http.StatusNotFound)
+		return
+	}
+	prevParsed, err := diff.Decode(previous.Parsed)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to decode snapshot", "err", err)
+		http.Error(w, "Stored snapshot is unreadable", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, r, diffResponse{
+		IOC:      current.IOC,
+		Current:  snapshotSummary{LogID: current.LogID, CreatedAt: current.CreatedAt},
+		Previous: snapshotSummary{LogID: previous.LogID, CreatedAt: previous.CreatedAt},
+		Changes:  diff.Compare(prevParsed.Only(sources), curParsed),
+	})
+}
+
+// LogIOC stores a new lookup entry for the authenticated user
 func LogIOC(w http.ResponseWriter, r *http.Request) {
 	type RequestData struct {
 		IOC         string `json:"ioc"`
 		ResultCount int    `json:"result_count"`
-		UserName    string `json:"user_name"`
 	}
 
 	var requestData RequestData
@@ -48,14 +161,13 @@ func LogIOC(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Ensure user_name is provided
-	if requestData.UserName == "" {
-		http.Error(w, "UserName is required", http.StatusBadRequest)
+	// Insert log into DB; the user comes from the request's identity, never the payload
+	ioc, iocType := indicator.Normalize(refang.IOC(requestData.IOC))
+	if ioc == "" {
+		http.Error(w, "IOC is required", http.StatusBadRequest)
 		return
 	}
-
-	// Insert log into DB
-	err = models.InsertQueryLog(requestData.IOC, requestData.ResultCount, requestData.UserName)
+	err = models.InsertQueryLog(r.Context(), ioc, requestData.ResultCount, string(iocType))
 	if err != nil {
 		http.Error(w, "Failed to log IOC lookup", http.StatusInternalServerError)
 		return
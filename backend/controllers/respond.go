@@ -0,0 +1,22 @@
+package controllers
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/0x-Singularity/Augury/rbac"
+)
+
+// writeJSON writes v as the JSON response, with every field the caller's role may not
+// see redacted (see rbac.DefaultFieldPolicy)
+func writeJSON(w http.ResponseWriter, r *http.Request, v interface{}) {
+	out, err := rbac.DefaultFieldPolicy.Apply(v, rbac.RoleOf(r.Context()))
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to encode response", "err", err)
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
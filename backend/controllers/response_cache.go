@@ -0,0 +1,182 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/0x-Singularity/Augury/metrics"
+	"github.com/0x-Singularity/Augury/models"
+	"github.com/0x-Singularity/Augury/ratelimit"
+)
+
+// ResponseStore persists upstream responses between lookups. The default store is the
+// upstream_cache table; tests swap in their own through Handlers.Responses.
+type ResponseStore interface {
+	// Get returns the stored response and when it was fetched; ok is false when there is none
+	Get(ctx context.Context, source, ioc string) (data []byte, fetchedAt time.Time, ok bool, err error)
+	Put(ctx context.Context, source, ioc string, data []byte, fetchedAt time.Time) error
+	// Purge deletes the responses of each source fetched before expiredBefore(source)
+	Purge(ctx context.Context, expiredBefore func(source string) time.Time) (int64, error)
+}
+
+// dbResponseStore keeps responses in Postgres so they survive restarts
+type dbResponseStore struct{}
+
+func (dbResponseStore) Get(ctx context.Context, source, ioc string) ([]byte, time.Time, bool, error) {
+	cached, err := models.GetCachedResponse(ctx, source, ioc)
+	if err != nil || cached == nil {
+		return nil, time.Time{}, false, err
+	}
+	return cached.Response, cached.FetchedAt, true, nil
+}
+
+func (dbResponseStore) Put(ctx context.Context, source, ioc string, data []byte, fetchedAt time.Time) error {
+	return models.PutCachedResponse(ctx, source, ioc, data, fetchedAt)
+}
+
+func (dbResponseStore) Purge(ctx context.Context, expiredBefore func(source string) time.Time) (int64, error) {
+	return models.PurgeCachedResponses(ctx, expiredBefore)
+}
+
+// Default cache lifetimes. Event style sources go stale quickly, inventory style ones don't.
+// Each can be overridden in cache.source_ttls (AUGURY_CACHE_TTL_<SOURCE>, e.g.
+// AUGURY_CACHE_TTL_PDNS=2h); cache.response_ttl covers sources without a default of their
+// own. A TTL of 0 turns caching off.
+var sourceCacheTTLs = map[string]time.Duration{
+	"oil":          10 * time.Minute,
+	"netflow":      10 * time.Minute,
+	"coxsight":     10 * time.Minute,
+	"vpn":          10 * time.Minute,
+	"cbr":          30 * time.Minute,
+	"host":         time.Hour,
+	"pdns":         time.Hour,
+	"pdns_summary": time.Hour,
+	"binary":       24 * time.Hour,
+	"asset":        24 * time.Hour,
+	"ldap":         24 * time.Hour,
+	"geo":          24 * time.Hour,
+}
+
+// cacheTTL returns how long a cached response from source stays usable
+func (h *Handlers) cacheTTL(source string) time.Duration {
+	if ttl, ok := h.cache.SourceTTLs[source]; ok {
+		return ttl
+	}
+	if ttl, ok := sourceCacheTTLs[source]; ok {
+		return ttl
+	}
+	return h.cache.ResponseTTL
+}
+
+// cacheStatus tells the client whether a source was served from the cache and how old the data is
+type cacheStatus struct {
+	Hit        bool      `json:"hit"`
+	FetchedAt  time.Time `json:"fetched_at"`
+	AgeSeconds int64     `json:"age_seconds"`
+}
+
+// freshKey marks a request context as bypassing the response cache
+type freshKey struct{}
+
+// withFresh records whether the caller asked for fresh data (?fresh=1)
+func withFresh(ctx context.Context, r *http.Request) context.Context {
+	if r.URL.Query().Get("fresh") != "1" {
+		return ctx
+	}
+	return context.WithValue(ctx, freshKey{}, true)
+}
+
+func isFresh(ctx context.Context) bool {
+	fresh, _ := ctx.Value(freshKey{}).(bool)
+	return fresh
+}
+
+// cachedLookup serves source's response for ioc from the cache when it is recent enough,
+// otherwise calls fetch and stores the result. Failed lookups are never cached, and cache
+// errors only cost the cache, never the lookup.
+func cachedLookup[T any](ctx context.Context, h *Handlers, source, ioc string, fetch func() (T, error)) (T, cacheStatus, error) {
+	store := h.Responses
+	ttl := h.cacheTTL(source)
+
+	if store != nil && ttl > 0 && !isFresh(ctx) {
+		data, fetchedAt, ok, err := store.Get(ctx, source, ioc)
+		if err != nil {
+			slog.WarnContext(ctx, "Response cache read failed", "source", source, "ioc", ioc, "err", err)
+		}
+		if ok && time.Since(fetchedAt) < ttl {
+			var cached T
+			if err := json.Unmarshal(data, &cached); err == nil {
+				metrics.ObserveResponseCache(source, true)
+				return cached, cacheStatus{Hit: true, FetchedAt: fetchedAt, AgeSeconds: int64(time.Since(fetchedAt).Seconds())}, nil
+			}
+			slog.WarnContext(ctx, "Discarding unreadable cached response", "source", source, "ioc", ioc)
+		}
+		metrics.ObserveResponseCache(source, false)
+	}
+
+	started := time.Now()
+	result, err := fetch()
+	metrics.ObserveUpstream(source, time.Since(started), upstreamErrorReason(err))
+	status := cacheStatus{FetchedAt: time.Now()}
+	if err != nil || store == nil || ttl <= 0 {
+		return result, status, err
+	}
+	if data, err := json.Marshal(result); err == nil {
+		if err := store.Put(ctx, source, ioc, data, status.FetchedAt); err != nil {
+			slog.WarnContext(ctx, "Response cache write failed", "source", source, "ioc", ioc, "err", err)
+		}
+	}
+	return result, status, nil
+}
+
+// PurgeResponses deletes cached responses older than their source's lifetime, now and then
+// every interval until ctx is done. Responses are otherwise only ever replaced, so those of
+// IOCs nobody looks up again would be kept forever.
+func (h *Handlers) PurgeResponses(ctx context.Context, interval time.Duration) {
+	if h.Responses == nil {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		h.purgeResponses(ctx, time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (h *Handlers) purgeResponses(ctx context.Context, now time.Time) {
+	purged, err := h.Responses.Purge(ctx, func(source string) time.Time {
+		return now.Add(-h.cacheTTL(source))
+	})
+	if err != nil {
+		if ctx.Err() == nil {
+			slog.WarnContext(ctx, "Response cache purge failed", "err", err)
+		}
+		return
+	}
+	if purged > 0 {
+		slog.DebugContext(ctx, "Purged expired cached responses", "responses", purged)
+	}
+}
+
+// upstreamErrorReason classifies a failed upstream call for the metrics
+func upstreamErrorReason(err error) string {
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	}
+	if _, limited := ratelimit.RetryAfter(err); limited {
+		return "rate_limited"
+	}
+	return "error"
+}
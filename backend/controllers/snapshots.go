@@ -0,0 +1,84 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+
+	"github.com/0x-Singularity/Augury/diff"
+	"github.com/0x-Singularity/Augury/indicator"
+	"github.com/0x-Singularity/Augury/models"
+)
+
+// SnapshotStore logs lookups with a snapshot of their results, so later lookups of the same
+// IOC can be diffed against them. The default store is the query log and lookup_snapshots
+// tables; tests swap in their own through Handlers.Snapshots.
+type SnapshotStore interface {
+	// Record logs a lookup by the user in ctx with its snapshot and returns the log ID
+	Record(ctx context.Context, ioc string, iocType indicator.Type, resultCount int, raw, parsed json.RawMessage) (logID int, err error)
+	// Previous returns the newest snapshot of ioc taken before the lookup logID that holds
+	// any of sources, or nil if there is none
+	Previous(ctx context.Context, ioc string, logID int, sources []string) (*models.Snapshot, error)
+}
+
+// dbSnapshotStore keeps snapshots in Postgres
+type dbSnapshotStore struct{}
+
+func (dbSnapshotStore) Record(ctx context.Context, ioc string, iocType indicator.Type, resultCount int, raw, parsed json.RawMessage) (int, error) {
+	return models.RecordLookup(ctx, ioc, resultCount, string(iocType), raw, parsed)
+}
+
+func (dbSnapshotStore) Previous(ctx context.Context, ioc string, logID int, sources []string) (*models.Snapshot, error) {
+	return models.PreviousSnapshot(ctx, ioc, logID, sources)
+}
+
+// parseSources parses each source's raw results with its parser, giving the snapshot form
+// the diff engine compares
+func (h *Handlers) parseSources(sources map[string]map[string]interface{}) diff.Parsed {
+	parsed := make(diff.Parsed, len(sources))
+	for name, data := range sources {
+		src, _ := h.Sources.Lookup(name)
+		parsed[name] = src.Parsed(data).Data
+	}
+	return parsed
+}
+
+// recordLookup logs the lookup with its snapshot and compares it with the previous lookup
+// of the same IOC that queried the same sources, limited to those sources: a single PDNS
+// lookup is diffed against the PDNS results of the last lookup that has them. changes is
+// nil when there is nothing to compare with.
+func (h *Handlers) recordLookup(ctx context.Context, ioc string, iocType indicator.Type, resultCount int,
+	parsed diff.Parsed, sources map[string]map[string]interface{}) (logID int, changes *diff.Report, err error) {
+	rawJSON, err := json.Marshal(sources)
+	if err != nil {
+		return 0, nil, fmt.Errorf("encode raw snapshot: %w", err)
+	}
+	parsedJSON, err := json.Marshal(parsed)
+	if err != nil {
+		return 0, nil, fmt.Errorf("encode parsed snapshot: %w", err)
+	}
+
+	logID, err = h.Snapshots.Record(ctx, ioc, iocType, resultCount, rawJSON, parsedJSON)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	// The diff is a convenience; failing to build it doesn't fail the lookup
+	names := parsed.Sources()
+	previous, err := h.Snapshots.Previous(ctx, ioc, logID, names)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to load previous snapshot", "err", err)
+		return logID, nil, nil
+	}
+	if previous == nil {
+		return logID, nil, nil
+	}
+	prevParsed, err := diff.Decode(previous.Parsed)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to decode previous snapshot", "err", err)
+		return logID, nil, nil
+	}
+	report := diff.Compare(prevParsed.Only(names), parsed)
+	return logID, &report, nil
+}
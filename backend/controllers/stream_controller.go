@@ -0,0 +1,108 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/0x-Singularity/Augury/logging"
+	"github.com/0x-Singularity/Augury/rbac"
+)
+
+// ExtractFromTextStream is the Server-Sent Events variant of ExtractFromText.
+// Instead of one JSON document it emits:
+//
+//	event: start         {"total": m, "indicators": [...]}
+//	event: ioc           {"ioc": "...", "data": {...}}   one per IOC, as soon as it is enriched
+//	event: source_error  {"ioc": "...", "source": "cbr", "error": "..."}
+//	event: ioc_error     {"ioc": "...", "error": "..."}          the IOC could not be enriched at all
+//	event: progress      {"done": n, "total": m}
+//	event: summary       {"total": m, "completed": n, "failed": f, "source_errors": e, "duration_ms": d}
+//
+// If the client disconnects the request context is cancelled, which stops the
+// worker pool and aborts any in-flight FAKEula requests.
+func (h *Handlers) ExtractFromTextStream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	indicators, iocs, ok := h.extractIOCs(w, r)
+	if !ok {
+		return
+	}
+	started := time.Now()
+
+	// A stream lasts as long as the enrichment, so the server's write timeout doesn't apply;
+	// a client that goes away still cancels it
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		slog.WarnContext(r.Context(), "Could not lift the write deadline for the extraction stream", "err", err)
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no") // stop reverse proxies from buffering the stream
+	w.WriteHeader(http.StatusOK)
+
+	stream := &sseWriter{w: w, flusher: flusher, role: rbac.RoleOf(r.Context())}
+	stream.send("start", map[string]interface{}{"total": len(iocs), "indicators": indicators})
+
+	done, failed, sourceErrors := 0, 0, 0
+	for res := range h.enrichStream(withFresh(r.Context(), r), iocs) {
+		for _, f := range res.Failures {
+			sourceErrors++
+			stream.send("source_error", f)
+		}
+
+		done++
+		if res.Err != nil {
+			failed++
+			slog.ErrorContext(logging.WithIOC(r.Context(), res.IOC), "Error processing IOC", "err", res.Err)
+			stream.send("ioc_error", map[string]string{"ioc": res.IOC, "error": res.Err.Error()})
+		} else {
+			stream.send("ioc", map[string]interface{}{"ioc": res.IOC, "data": res.Data})
+		}
+		stream.send("progress", map[string]int{"done": done, "total": len(iocs)})
+	}
+
+	if r.Context().Err() != nil {
+		slog.InfoContext(r.Context(), "Extraction stream cancelled by client", "done", done, "total", len(iocs))
+		return
+	}
+
+	stream.send("summary", map[string]interface{}{
+		"total":         len(iocs),
+		"completed":     done - failed,
+		"failed":        failed,
+		"source_errors": sourceErrors,
+		"duration_ms":   time.Since(started).Milliseconds(),
+	})
+}
+
+// sseWriter writes Server-Sent Events and flushes after each one. Payloads are
+// redacted for role like every other response.
+type sseWriter struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+	role    rbac.Role
+}
+
+func (s *sseWriter) send(event string, payload interface{}) {
+	payload, err := rbac.DefaultFieldPolicy.Apply(payload, s.role)
+	if err != nil {
+		slog.Error("Failed to encode event", "event", event, "err", err)
+		return
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		slog.Error("Failed to encode event", "event", event, "err", err)
+		return
+	}
+	fmt.Fprintf(s.w, "event: %s\ndata: %s\n\n", event, data)
+	s.flusher.Flush()
+}
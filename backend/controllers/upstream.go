@@ -0,0 +1,108 @@
+package controllers
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/0x-Singularity/Augury/audit"
+	"github.com/0x-Singularity/Augury/diff"
+	"github.com/0x-Singularity/Augury/enrich"
+	"github.com/0x-Singularity/Augury/fakeula"
+	"github.com/0x-Singularity/Augury/indicator"
+	"github.com/0x-Singularity/Augury/logging"
+	"github.com/0x-Singularity/Augury/parser"
+	"github.com/0x-Singularity/Augury/ratelimit"
+	"github.com/0x-Singularity/Augury/refang"
+)
+
+// lookupQuery records the IOC as the analyst sent it and as it was looked up
+type lookupQuery struct {
+	Original   string         `json:"original"`
+	Refanged   string         `json:"refanged"`
+	Normalized string         `json:"normalized"`
+	Type       indicator.Type `json:"type"`
+}
+
+// parsedLookupResponse is a parsed single-source result plus the query that produced it.
+// Snapshotted sources add the lookup's log ID and what changed since the previous one.
+type parsedLookupResponse struct {
+	parser.ParsedFakeulaResult
+	Query   lookupQuery  `json:"query"`
+	Cache   cacheStatus  `json:"cache"`
+	LogID   int          `json:"log_id,omitempty"`
+	Changes *diff.Report `json:"changes,omitempty"`
+}
+
+// QuerySource returns the handler of /api/ioc/{name}, a lookup of the ioc parameter in that
+// one source: it validates, refangs and normalizes the IOC, queries the source and writes
+// the result, parsed unless the source is raw. Lookups of snapshotted sources are logged
+// and diffed against the previous one (see enrich.Source.Snapshot). Responses are cached under the source name
+// (see cacheTTL); ?fresh=1 bypasses the cache. Unknown sources answer 404.
+func (h *Handlers) QuerySource(name string) http.HandlerFunc {
+	src, ok := h.Sources.Lookup(name)
+	if !ok {
+		return http.NotFound
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		h.serveLookup(w, r, src)
+	}
+}
+
+func (h *Handlers) serveLookup(w http.ResponseWriter, r *http.Request, src enrich.Source) {
+	original := r.URL.Query().Get("ioc")
+	ioc := refang.IOC(original)
+	if ioc == "" {
+		http.Error(w, "IOC parameter is required", http.StatusBadRequest)
+		return
+	}
+	query := lookupQuery{Original: original, Refanged: ioc}
+	ioc, query.Type = indicator.Normalize(ioc)
+	query.Normalized = ioc
+	audit.SetIOCs(r.Context(), ioc)
+
+	ctx := logging.WithSource(logging.WithIOC(withFresh(r.Context(), r), ioc), src.Name)
+	resp, status, err := cachedLookup(ctx, h, src.Name, ioc, func() (*fakeula.Response, error) {
+		return src.Enricher.Enrich(ctx, h.API, ioc)
+	})
+	if wait, limited := ratelimit.RetryAfter(err); limited {
+		slog.WarnContext(ctx, "Upstream query rate limited")
+		ratelimit.WriteTooManyRequests(w, wait)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Upstream query failed", "err", err)
+		http.Error(w, "Failed to query "+src.Label, http.StatusInternalServerError)
+		return
+	}
+
+	if len(resp.Data) > 0 {
+		audit.AddSources(r.Context(), src.Name)
+	}
+	data := resp.Map()
+	var logID int
+	var changes *diff.Report
+	if src.Snapshot && h.Snapshots != nil {
+		sources := map[string]map[string]interface{}{src.Name: data}
+		logID, changes, err = h.recordLookup(ctx, ioc, query.Type, len(resp.Data), h.parseSources(sources), sources)
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to log IOC lookup", "err", err)
+		}
+	}
+	if src.Raw {
+		data["query"] = query
+		data["cache"] = status
+		if logID != 0 {
+			data["log_id"] = logID
+			data["changes"] = changes
+		}
+		writeJSON(w, r, data)
+		return
+	}
+	writeJSON(w, r, parsedLookupResponse{
+		ParsedFakeulaResult: src.Parsed(data),
+		Query:               query,
+		Cache:               status,
+		LogID:               logID,
+		Changes:             changes,
+	})
+}
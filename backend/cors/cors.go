@@ -0,0 +1,204 @@
+// Package cors answers cross-origin requests according to a configured policy: which
+// origins may call the API, with which methods and headers, and whether browsers may send
+// credentials. Origins are listed exactly ("https://augury.example.com") or as patterns with
+// a single "*" standing for one whole host label or the port ("https://*.example.com",
+// "http://localhost:*"). A lone "*" allows every origin and rules out credentials.
+package cors
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Options describes a policy
+type Options struct {
+	AllowedOrigins   []string
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	ExposedHeaders   []string
+	AllowCredentials bool
+	MaxAge           time.Duration // how long browsers may cache a preflight answer
+}
+
+// Policy is a validated set of Options, ready to serve
+type Policy struct {
+	anyOrigin   bool
+	exact       map[string]bool
+	patterns    []pattern
+	methods     string
+	headers     string
+	exposed     string
+	credentials bool
+	maxAge      string
+}
+
+// pattern matches origins that start with prefix and end with suffix, with one host label
+// or, after a colon, a port in between
+type pattern struct {
+	prefix, suffix string
+}
+
+// New validates o and returns its policy
+func New(o Options) (*Policy, error) {
+	p := &Policy{
+		exact:       make(map[string]bool),
+		credentials: o.AllowCredentials,
+		methods:     strings.ToUpper(strings.Join(o.AllowedMethods, ", ")),
+		headers:     strings.Join(o.AllowedHeaders, ", "),
+		exposed:     strings.Join(o.ExposedHeaders, ", "),
+	}
+	var errs []error
+	for _, origin := range o.AllowedOrigins {
+		origin = strings.ToLower(strings.TrimSpace(origin))
+		switch {
+		case origin == "*":
+			p.anyOrigin = true
+		case strings.Count(origin, "*") > 1:
+			errs = append(errs, fmt.Errorf("origin %q: only one * is allowed", origin))
+		case strings.Contains(origin, "*"):
+			prefix, suffix, _ := strings.Cut(origin, "*")
+			if err := checkPattern(origin, prefix, suffix); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			if err := checkOrigin(prefix + "1" + suffix); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			p.patterns = append(p.patterns, pattern{prefix, suffix})
+		default:
+			if err := checkOrigin(origin); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			p.exact[origin] = true
+		}
+	}
+	if p.anyOrigin && o.AllowCredentials {
+		errs = append(errs, errors.New("origin \"*\" cannot be combined with credentials; list the origins"))
+	}
+	for _, m := range o.AllowedMethods {
+		if m == "" || strings.ContainsAny(m, " ,") {
+			errs = append(errs, fmt.Errorf("method %q is not an HTTP method", m))
+		}
+	}
+	if o.MaxAge < 0 {
+		errs = append(errs, fmt.Errorf("max age must not be negative, got %s", o.MaxAge))
+	}
+	p.maxAge = strconv.Itoa(int(o.MaxAge.Seconds()))
+	if err := errors.Join(errs...); err != nil {
+		return nil, fmt.Errorf("cors: %w", err)
+	}
+	return p, nil
+}
+
+// checkOrigin accepts scheme://host[:port] with nothing after it, as browsers send it
+func checkOrigin(origin string) error {
+	u, err := url.Parse(origin)
+	if err != nil || u.Scheme == "" || u.Host == "" || u.Path != "" || u.RawQuery != "" || u.User != nil {
+		return fmt.Errorf("origin %q must look like https://host[:port]", origin)
+	}
+	return nil
+}
+
+// checkPattern accepts a "*" that is a whole host label, followed by a dot and preceded by
+// the scheme or a dot, or that is the port at the end. "https://*example.com" would match
+// https://evilexample.com.
+func checkPattern(origin, prefix, suffix string) error {
+	label := (strings.HasSuffix(prefix, "://") || strings.HasSuffix(prefix, ".")) && strings.HasPrefix(suffix, ".")
+	port := strings.HasSuffix(prefix, ":") && !strings.HasSuffix(prefix, "://") && suffix == ""
+	if !label && !port {
+		return fmt.Errorf("origin %q: * must stand for a whole host label (https://*.example.com) or the port (http://localhost:*)", origin)
+	}
+	return nil
+}
+
+// Allows reports whether origin, as sent in the Origin header, may call the API
+func (p *Policy) Allows(origin string) bool {
+	if origin == "" {
+		return false
+	}
+	if p.anyOrigin {
+		return true
+	}
+	origin = strings.ToLower(origin)
+	if p.exact[origin] {
+		return true
+	}
+	for _, pt := range p.patterns {
+		if pt.matches(origin) {
+			return true
+		}
+	}
+	return false
+}
+
+func (pt pattern) matches(origin string) bool {
+	if len(origin) <= len(pt.prefix)+len(pt.suffix) || !strings.HasPrefix(origin, pt.prefix) || !strings.HasSuffix(origin, pt.suffix) {
+		return false
+	}
+	middle := origin[len(pt.prefix) : len(origin)-len(pt.suffix)]
+	port := strings.HasSuffix(pt.prefix, ":")
+	return strings.IndexFunc(middle, func(c rune) bool {
+		if port {
+			return c < '0' || c > '9'
+		}
+		return !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-')
+	}) < 0
+}
+
+// Middleware adds the CORS headers allowed origins get and answers every OPTIONS request
+// itself, preflight or not. Requests from other origins are served without CORS headers,
+// so the browser withholds the response from the calling page.
+func (p *Policy) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		origin := r.Header.Get("Origin")
+		allowed := p.Allows(origin)
+		// The answer depends on the Origin unless every origin gets "*"
+		if !p.anyOrigin {
+			h.Add("Vary", "Origin")
+		}
+		if allowed {
+			p.allowOrigin(h, origin)
+		}
+
+		if r.Method == http.MethodOptions {
+			if r.Header.Get("Access-Control-Request-Method") != "" {
+				h.Add("Vary", "Access-Control-Request-Method")
+				h.Add("Vary", "Access-Control-Request-Headers")
+				if allowed {
+					h.Set("Access-Control-Allow-Methods", p.methods)
+					if p.headers != "" {
+						h.Set("Access-Control-Allow-Headers", p.headers)
+					}
+					h.Set("Access-Control-Max-Age", p.maxAge)
+				}
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		if allowed && p.exposed != "" {
+			h.Set("Access-Control-Expose-Headers", p.exposed)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// allowOrigin names the origin allowed to read the response
+func (p *Policy) allowOrigin(h http.Header, origin string) {
+	if p.anyOrigin {
+		h.Set("Access-Control-Allow-Origin", "*")
+		return
+	}
+	h.Set("Access-Control-Allow-Origin", origin)
+	if p.credentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
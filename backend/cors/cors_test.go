@@ -0,0 +1,132 @@
+package cors
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func testPolicy(t *testing.T, o Options) *Policy {
+	t.Helper()
+	p, err := New(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestPolicy_Allows(t *testing.T) {
+	p := testPolicy(t, Options{AllowedOrigins: []string{"https://augury.example.com", "https://*.corp.example.com", "http://localhost:*"}})
+
+	tests := map[string]bool{
+		"https://augury.example.com":         true,
+		"HTTPS://Augury.Example.com":         true,
+		"http://augury.example.com":          false,
+		"https://soc.corp.example.com":       true,
+		"https://a.b.corp.example.com":       false,
+		"https://evilcorp.example.com":       false,
+		"https://corp.example.com":           false,
+		"https://evil.com/.corp.example.com": false,
+		"https://corp.example.com.evil.com":  false,
+		"http://localhost:3000":              true,
+		"http://localhost:evil.com":          false,
+		"null":                               false,
+		"":                                   false,
+	}
+	for origin, want := range tests {
+		if got := p.Allows(origin); got != want {
+			t.Errorf("Allows(%q) = %v, want %v", origin, got, want)
+		}
+	}
+}
+
+func TestNew_Invalid(t *testing.T) {
+	tests := map[string]Options{
+		"path":                 {AllowedOrigins: []string{"https://augury.example.com/app"}},
+		"no scheme":            {AllowedOrigins: []string{"augury.example.com"}},
+		"two wildcards":        {AllowedOrigins: []string{"https://*.*.example.com"}},
+		"partial label":        {AllowedOrigins: []string{"https://*example.com"}},
+		"label prefix":         {AllowedOrigins: []string{"https://app*.example.com"}},
+		"last label":           {AllowedOrigins: []string{"https://example.*"}},
+		"partial port":         {AllowedOrigins: []string{"http://localhost:30*"}},
+		"wildcard scheme":      {AllowedOrigins: []string{"*://augury.example.com"}},
+		"any with credentials": {AllowedOrigins: []string{"*"}, AllowCredentials: true},
+		"bad method":           {AllowedMethods: []string{"GET POST"}},
+		"negative max age":     {MaxAge: -time.Second},
+	}
+	for name, o := range tests {
+		if _, err := New(o); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	p := testPolicy(t, Options{
+		AllowedOrigins:   []string{"https://augury.example.com"},
+		AllowedMethods:   []string{"GET", "POST"},
+		AllowedHeaders:   []string{"Authorization"},
+		ExposedHeaders:   []string{"X-Request-ID"},
+		AllowCredentials: true,
+		MaxAge:           10 * time.Minute,
+	})
+	served := false
+	handler := p.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		served = true
+	}))
+	do := func(method, origin string, preflight bool) *httptest.ResponseRecorder {
+		served = false
+		req := httptest.NewRequest(method, "/api/ioc/geo", nil)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		if preflight {
+			req.Header.Set("Access-Control-Request-Method", "GET")
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := do(http.MethodOptions, "https://augury.example.com", true)
+	h := rec.Header()
+	if served || rec.Code != http.StatusNoContent {
+		t.Errorf("preflight: served=%v, status %d", served, rec.Code)
+	}
+	if h.Get("Access-Control-Allow-Origin") != "https://augury.example.com" || h.Get("Access-Control-Allow-Credentials") != "true" ||
+		h.Get("Access-Control-Allow-Methods") != "GET, POST" || h.Get("Access-Control-Allow-Headers") != "Authorization" ||
+		h.Get("Access-Control-Max-Age") != "600" {
+		t.Errorf("preflight: unexpected headers %v", h)
+	}
+	if vary := h.Values("Vary"); len(vary) != 3 {
+		t.Errorf("preflight: expected to vary on the origin and requested method and headers, got %v", vary)
+	}
+
+	rec = do(http.MethodGet, "https://augury.example.com", false)
+	if !served || rec.Header().Get("Access-Control-Expose-Headers") != "X-Request-ID" {
+		t.Errorf("allowed request: served=%v, headers %v", served, rec.Header())
+	}
+
+	rec = do(http.MethodGet, "https://evil.example.com", false)
+	if !served || rec.Header().Get("Access-Control-Allow-Origin") != "" || rec.Header().Get("Vary") != "Origin" {
+		t.Errorf("other origin: served=%v, headers %v", served, rec.Header())
+	}
+
+	rec = do(http.MethodOptions, "https://evil.example.com", true)
+	if served || rec.Header().Get("Access-Control-Allow-Methods") != "" {
+		t.Errorf("other origin preflight: served=%v, headers %v", served, rec.Header())
+	}
+}
+
+func TestMiddleware_AnyOrigin(t *testing.T) {
+	p := testPolicy(t, Options{AllowedOrigins: []string{"*"}})
+	handler := p.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	req := httptest.NewRequest(http.MethodGet, "/api/ioc/geo", nil)
+	req.Header.Set("Origin", "https://anywhere.example")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Header().Get("Access-Control-Allow-Origin") != "*" || rec.Header().Get("Vary") != "" {
+		t.Errorf("unexpected headers %v", rec.Header())
+	}
+}
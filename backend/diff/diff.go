@@ -0,0 +1,265 @@
+// Package diff compares two lookups of the same IOC and reports what changed between them:
+// sources that appeared or went quiet, new OIL events, new passive DNS answers, and
+// asset or LDAP attributes that changed value.
+//
+// Both sides are parsed snapshots keyed by enrichment source (netflow, cbr, ...), each
+// holding the parser.MultiLevelMap built from that source's response.
+package diff
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/0x-Singularity/Augury/parser"
+)
+
+// Parsed is a parsed snapshot: enrichment source -> parsed FAKEula data
+type Parsed map[string]parser.MultiLevelMap
+
+// OilEvent is an OIL entry seen in the current lookup but not the previous one
+type OilEvent struct {
+	Source string          `json:"source"`
+	Event  *parser.OilInfo `json:"event"`
+}
+
+// PDNSAnswer is a passive DNS answer seen in the current lookup but not the previous one
+type PDNSAnswer struct {
+	Source string           `json:"source"`
+	Answer parser.DNSAnswer `json:"answer"`
+}
+
+// AttributeChange is one asset or LDAP field whose value changed.
+// Subject names the asset or person (host name, IP, email...).
+type AttributeChange struct {
+	Source   string `json:"source"`
+	Subject  string `json:"subject"`
+	Field    string `json:"field"`
+	Previous string `json:"previous"`
+	Current  string `json:"current"`
+}
+
+// Report lists everything that changed between two lookups
+type Report struct {
+	NewSources      []string          `json:"new_sources"`
+	VanishedSources []string          `json:"vanished_sources"`
+	NewOilEvents    []OilEvent        `json:"new_oil_events"`
+	NewPDNSAnswers  []PDNSAnswer      `json:"new_pdns_answers"`
+	AssetChanges    []AttributeChange `json:"asset_changes"`
+	LDAPChanges     []AttributeChange `json:"ldap_changes"`
+}
+
+// Empty reports whether nothing changed
+func (r Report) Empty() bool {
+	return len(r.NewSources) == 0 && len(r.VanishedSources) == 0 && len(r.NewOilEvents) == 0 &&
+		len(r.NewPDNSAnswers) == 0 && len(r.AssetChanges) == 0 && len(r.LDAPChanges) == 0
+}
+
+// Decode reads a parsed snapshot as stored by models.RecordLookup
+func Decode(raw []byte) (Parsed, error) {
+	var p Parsed
+	if err := json.Unmarshal(raw, &p); err != nil {
+		return nil, fmt.Errorf("decode parsed snapshot: %w", err)
+	}
+	return p, nil
+}
+
+// Sources returns the enrichment sources the snapshot holds, sorted
+func (p Parsed) Sources() []string {
+	return sortedKeys(p)
+}
+
+// Only returns the part of p holding the given sources. A lookup that queried only some
+// sources, such as a single PDNS lookup, is compared with that part of an earlier one.
+func (p Parsed) Only(sources []string) Parsed {
+	out := make(Parsed, len(sources))
+	for _, source := range sources {
+		if levels, ok := p[source]; ok {
+			out[source] = levels
+		}
+	}
+	return out
+}
+
+// Compare reports what current has that previous did not, and what changed.
+// Slices in the report are never nil so they encode as [] rather than null.
+func Compare(previous, current Parsed) Report {
+	report := Report{
+		NewSources:      []string{},
+		VanishedSources: []string{},
+		NewOilEvents:    []OilEvent{},
+		NewPDNSAnswers:  []PDNSAnswer{},
+		AssetChanges:    []AttributeChange{},
+		LDAPChanges:     []AttributeChange{},
+	}
+
+	prevSources, curSources := sourcesWithData(previous), sourcesWithData(current)
+	for source := range curSources {
+		if !prevSources[source] {
+			report.NewSources = append(report.NewSources, source)
+		}
+	}
+	for source := range prevSources {
+		if !curSources[source] {
+			report.VanishedSources = append(report.VanishedSources, source)
+		}
+	}
+	sort.Strings(report.NewSources)
+	sort.Strings(report.VanishedSources)
+
+	// OIL events and PDNS answers have no stable ID, so compare by content
+	seenOil := make(map[string]bool)
+	seenAnswers := make(map[string]bool)
+	eachEntry(previous, func(_ string, e parser.FakeulaEntry) {
+		if e.Oil != nil {
+			seenOil[fingerprint(e.Oil)] = true
+		}
+		if e.PDNS != nil {
+			for _, a := range e.PDNS.Answers {
+				seenAnswers[answerKey(a)] = true
+			}
+		}
+	})
+	eachEntry(current, func(source string, e parser.FakeulaEntry) {
+		if e.Oil != nil {
+			if key := fingerprint(e.Oil); !seenOil[key] {
+				seenOil[key] = true
+				report.NewOilEvents = append(report.NewOilEvents, OilEvent{Source: source, Event: e.Oil})
+			}
+		}
+		if e.PDNS != nil {
+			for _, a := range e.PDNS.Answers {
+				if key := answerKey(a); !seenAnswers[key] {
+					seenAnswers[key] = true
+					report.NewPDNSAnswers = append(report.NewPDNSAnswers, PDNSAnswer{Source: source, Answer: a})
+				}
+			}
+		}
+	})
+
+	report.AssetChanges = compareAttributes(previous, current, func(e parser.FakeulaEntry) (string, interface{}) {
+		if e.Asset == nil {
+			return "", nil
+		}
+		return firstNonEmpty(e.Asset.Name, e.Asset.IP), e.Asset
+	})
+	report.LDAPChanges = compareAttributes(previous, current, func(e parser.FakeulaEntry) (string, interface{}) {
+		if e.LDAP == nil {
+			return "", nil
+		}
+		return firstNonEmpty(e.LDAP.Email, e.LDAP.Name), e.LDAP
+	})
+	return report
+}
+
+// sourcesWithData returns "enrichment/origin" for every parsed origin that has entries
+func sourcesWithData(p Parsed) map[string]bool {
+	out := make(map[string]bool)
+	for source, levels := range p {
+		for origin, byType := range levels {
+			for _, entries := range byType {
+				if len(entries) > 0 {
+					out[source+"/"+origin] = true
+					break
+				}
+			}
+		}
+	}
+	return out
+}
+
+// eachEntry calls fn once per distinct entry, in a stable order. Entries are stored under
+// every structure type they contain, so the same entry can appear more than once.
+func eachEntry(p Parsed, fn func(source string, e parser.FakeulaEntry)) {
+	for _, source := range sortedKeys(p) {
+		levels := p[source]
+		seen := make(map[string]bool)
+		for _, origin := range sortedKeys(levels) {
+			byType := levels[origin]
+			for _, structType := range sortedKeys(byType) {
+				for _, e := range byType[structType] {
+					key := fingerprint(e)
+					if seen[key] {
+						continue
+					}
+					seen[key] = true
+					fn(source+"/"+origin, e)
+				}
+			}
+		}
+	}
+}
+
+// compareAttributes matches entries by the subject pick returns and reports fields whose value changed
+func compareAttributes(previous, current Parsed, pick func(parser.FakeulaEntry) (string, interface{})) []AttributeChange {
+	prev := make(map[string]map[string]string)
+	eachEntry(previous, func(source string, e parser.FakeulaEntry) {
+		if subject, v := pick(e); subject != "" {
+			prev[source+"|"+subject] = fields(v)
+		}
+	})
+
+	changes := []AttributeChange{}
+	eachEntry(current, func(source string, e parser.FakeulaEntry) {
+		subject, v := pick(e)
+		old, ok := prev[source+"|"+subject]
+		if subject == "" || !ok {
+			return
+		}
+		cur := fields(v)
+		for _, field := range sortedKeys(cur) {
+			if old[field] != cur[field] {
+				changes = append(changes, AttributeChange{
+					Source: source, Subject: subject, Field: field,
+					Previous: old[field], Current: cur[field],
+				})
+			}
+		}
+	})
+	return changes
+}
+
+// fields flattens a parsed struct into its JSON field names and string values
+func fields(v interface{}) map[string]string {
+	var m map[string]interface{}
+	b, _ := json.Marshal(v)
+	_ = json.Unmarshal(b, &m)
+	out := make(map[string]string, len(m))
+	for k, val := range m {
+		if s, ok := val.(string); ok {
+			out[k] = s
+		} else {
+			enc, _ := json.Marshal(val)
+			out[k] = string(enc)
+		}
+	}
+	return out
+}
+
+func fingerprint(v interface{}) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+// answerKey identifies a DNS answer regardless of how often it has been seen since
+func answerKey(a parser.DNSAnswer) string {
+	return a.Name + "|" + a.Type + "|" + a.Data
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
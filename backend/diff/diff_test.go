@@ -0,0 +1,120 @@
+package diff
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/0x-Singularity/Augury/parser"
+)
+
+func oilEntry(ts, msg string) parser.FakeulaEntry {
+	return parser.FakeulaEntry{Oil: &parser.OilInfo{Timestamp: ts, Message: msg}}
+}
+
+func TestCompare(t *testing.T) {
+	previous := Parsed{
+		"coxsight": {
+			"helios": {"oil": {oilEntry("2026-01-01T00:00:00Z", "old alert")}},
+		},
+		"asset": {
+			"asset": {"asset": {{Asset: &parser.AssetInfo{Name: "web01", IP: "10.0.0.5", StackOwner: "alice"}}}},
+		},
+		"pdns": {
+			"pdns": {"pdns": {{PDNS: &parser.PDNSInfo{Answers: []parser.DNSAnswer{
+				{Name: "evil.com", Type: "A", Data: "1.2.3.4", Count: 3},
+			}}}}},
+		},
+		"netflow": {
+			"netflow": {"oil": {oilEntry("2026-01-01T00:00:00Z", "flow")}},
+		},
+	}
+	current := Parsed{
+		"coxsight": {
+			"helios": {"oil": {
+				oilEntry("2026-01-01T00:00:00Z", "old alert"),
+				oilEntry("2026-02-01T00:00:00Z", "new alert"),
+			}},
+		},
+		"asset": {
+			"asset": {"asset": {{Asset: &parser.AssetInfo{Name: "web01", IP: "10.0.0.5", StackOwner: "bob"}}}},
+		},
+		"pdns": {
+			"pdns": {"pdns": {{PDNS: &parser.PDNSInfo{Answers: []parser.DNSAnswer{
+				{Name: "evil.com", Type: "A", Data: "1.2.3.4", Count: 9}, // seen more often, not new
+				{Name: "evil.com", Type: "A", Data: "5.6.7.8"},
+			}}}}},
+		},
+		"cbr": {
+			"process": {"process": {{Process: &parser.ProcessInfo{Name: "evil.exe"}}}},
+		},
+	}
+
+	r := Compare(previous, current)
+
+	if len(r.NewSources) != 1 || r.NewSources[0] != "cbr/process" {
+		t.Errorf("new sources: %v", r.NewSources)
+	}
+	if len(r.VanishedSources) != 1 || r.VanishedSources[0] != "netflow/netflow" {
+		t.Errorf("vanished sources: %v", r.VanishedSources)
+	}
+	if len(r.NewOilEvents) != 1 || r.NewOilEvents[0].Event.Message != "new alert" || r.NewOilEvents[0].Source != "coxsight/helios" {
+		t.Errorf("new oil events: %+v", r.NewOilEvents)
+	}
+	if len(r.NewPDNSAnswers) != 1 || r.NewPDNSAnswers[0].Answer.Data != "5.6.7.8" {
+		t.Errorf("new pdns answers: %+v", r.NewPDNSAnswers)
+	}
+	want := AttributeChange{Source: "asset/asset", Subject: "web01", Field: "stackOwner", Previous: "alice", Current: "bob"}
+	if len(r.AssetChanges) != 1 || r.AssetChanges[0] != want {
+		t.Errorf("asset changes: %+v", r.AssetChanges)
+	}
+	if r.Empty() {
+		t.Error("expected a non-empty report")
+	}
+}
+
+func TestCompare_NoChanges(t *testing.T) {
+	snap := Parsed{
+		"ldap": {"ldap": {"ldap": {{LDAP: &parser.LdapInfo{Email: "a@example.com", Title: "Analyst"}}}}},
+	}
+	r := Compare(snap, snap)
+	if !r.Empty() {
+		t.Errorf("expected no changes, got %+v", r)
+	}
+
+	// Empty slices encode as [] so the frontend never has to null-check
+	b, _ := json.Marshal(r)
+	var decoded map[string]interface{}
+	json.Unmarshal(b, &decoded)
+	if _, ok := decoded["ldap_changes"].([]interface{}); !ok {
+		t.Errorf("expected ldap_changes to encode as an array: %s", b)
+	}
+}
+
+func TestDecode(t *testing.T) {
+	p, err := Decode([]byte(`{"geo":{"geo":{"geo":[{"oil":null,"geo":{"countryCode":"NZ"}}]}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := p["geo"]["geo"]["geo"][0].Geo.CountryCode; got != "NZ" {
+		t.Errorf("expected NZ, got %q", got)
+	}
+}
+
+func TestCompare_OnlySharedSources(t *testing.T) {
+	previous := Parsed{
+		"ldap":    {"ldap": {"ldap": {{LDAP: &parser.LdapInfo{Email: "a@example.com", Title: "Analyst"}}}}},
+		"netflow": {"netflow": {"oil": {oilEntry("2026-01-01T00:00:00Z", "flow")}}},
+	}
+	current := Parsed{
+		"ldap": {"ldap": {"ldap": {{LDAP: &parser.LdapInfo{Email: "a@example.com", Title: "Lead Analyst"}}}}},
+	}
+
+	r := Compare(previous.Only(current.Sources()), current)
+	if len(r.VanishedSources) != 0 {
+		t.Errorf("sources the lookup didn't query should not vanish: %v", r.VanishedSources)
+	}
+	want := AttributeChange{Source: "ldap/ldap", Subject: "a@example.com", Field: "title", Previous: "Analyst", Current: "Lead Analyst"}
+	if len(r.LDAPChanges) != 1 || r.LDAPChanges[0] != want {
+		t.Errorf("ldap changes: %+v", r.LDAPChanges)
+	}
+}
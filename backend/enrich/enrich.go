@@ -0,0 +1,174 @@
+// Package enrich is the registry of enrichment sources. Each source declares its name,
+// the IOC types it answers for, the source it depends on, if any, how its results are
+// parsed and the role its route needs. Registering a source is all it takes for
+// ExtractFromText to query it for every matching IOC and for /api/ioc/{source} to serve it.
+package enrich
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/0x-Singularity/Augury/fakeula"
+	"github.com/0x-Singularity/Augury/indicator"
+	"github.com/0x-Singularity/Augury/parser"
+	"github.com/0x-Singularity/Augury/rbac"
+)
+
+// Enricher queries one upstream source for an IOC
+type Enricher interface {
+	Enrich(ctx context.Context, api fakeula.API, ioc string) (*fakeula.Response, error)
+}
+
+// EnricherFunc adapts a fakeula.API method expression, such as fakeula.API.Geo, to an Enricher
+type EnricherFunc func(api fakeula.API, ctx context.Context, ioc string) (*fakeula.Response, error)
+
+func (f EnricherFunc) Enrich(ctx context.Context, api fakeula.API, ioc string) (*fakeula.Response, error) {
+	return f(api, ctx, ioc)
+}
+
+// Source is one registered enrichment source
+type Source struct {
+	// Name keys the source's results in responses, the response cache and the audit log,
+	// and names its route: /api/ioc/{Name}
+	Name string
+	// Label names the source in error messages, e.g. "GeoIP"
+	Label    string
+	Enricher Enricher
+
+	// Extract queries the source for every IOC ExtractFromText finds whose type is in
+	// Types. An empty Types accepts every type.
+	Extract bool
+	Types   []indicator.Type
+
+	// DependsOn names a source whose response Input turns into this source's query, e.g.
+	// binary looks up the MD5 CBR found. The dependent runs after it, even for IOC types
+	// it doesn't accept itself, whenever Input finds something to look up.
+	DependsOn string
+	Input     func(dep *fakeula.Response) string
+	// InputKey records the value the dependent looked up in the IOC's results, e.g. "hash"
+	InputKey string
+
+	// Snapshot logs every lookup through the route with a snapshot of its results, diffed
+	// against the previous one like the extract flow's lookups. It is for sources the
+	// extract flow doesn't query in full.
+	Snapshot bool
+
+	// Parse formats the source's results; nil uses parser.FormatFakeulaResponse. Raw
+	// makes the route return the upstream response unparsed.
+	Parse func(map[string]interface{}) parser.ParsedFakeulaResult
+	Raw   bool
+	// Role is the minimum role allowed to call the route
+	Role rbac.Role
+}
+
+// Supports reports whether the source should be queried for an IOC of type t
+func (s Source) Supports(t indicator.Type) bool {
+	return len(s.Types) == 0 || slices.Contains(s.Types, t)
+}
+
+// Parsed formats data, a response in the generic form fakeula.Response.Map returns
+func (s Source) Parsed(data map[string]interface{}) parser.ParsedFakeulaResult {
+	if s.Parse != nil {
+		return s.Parse(data)
+	}
+	return parser.FormatFakeulaResponse(data)
+}
+
+// Registry holds sources in registration order. Sources are registered at startup;
+// lookups afterwards may run concurrently.
+type Registry struct {
+	sources []Source
+}
+
+// NewRegistry returns an empty registry
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Register adds src. The source it depends on must already be registered, and both must
+// be queried by the extract flow.
+func (r *Registry) Register(src Source) error {
+	switch {
+	case src.Name == "":
+		return errors.New("enrich: source without a name")
+	case src.Enricher == nil:
+		return fmt.Errorf("enrich: source %q has no enricher", src.Name)
+	}
+	if _, ok := r.Lookup(src.Name); ok {
+		return fmt.Errorf("enrich: source %q registered twice", src.Name)
+	}
+	if src.DependsOn != "" {
+		dep, ok := r.Lookup(src.DependsOn)
+		if !ok {
+			return fmt.Errorf("enrich: source %q depends on unknown source %q", src.Name, src.DependsOn)
+		}
+		if !src.Extract || !dep.Extract || src.Input == nil {
+			return fmt.Errorf("enrich: source %q and %q must both be extracted, with an Input", src.Name, src.DependsOn)
+		}
+	}
+	if src.Label == "" {
+		src.Label = src.Name
+	}
+	r.sources = append(r.sources, src)
+	return nil
+}
+
+// Lookup returns the source called name
+func (r *Registry) Lookup(name string) (Source, bool) {
+	for _, src := range r.sources {
+		if src.Name == name {
+			return src, true
+		}
+	}
+	return Source{}, false
+}
+
+// All returns every source in registration order
+func (r *Registry) All() []Source {
+	return slices.Clone(r.sources)
+}
+
+// Roots returns the sources the extract flow starts with: those it queries that depend on nothing
+func (r *Registry) Roots() []Source {
+	var out []Source
+	for _, src := range r.sources {
+		if src.Extract && src.DependsOn == "" {
+			out = append(out, src)
+		}
+	}
+	return out
+}
+
+// Dependents returns the sources that depend on name
+func (r *Registry) Dependents(name string) []Source {
+	var out []Source
+	for _, src := range r.sources {
+		if src.DependsOn == name {
+			out = append(out, src)
+		}
+	}
+	return out
+}
+
+// For returns the names of the sources the extract flow queries directly for type t
+func (r *Registry) For(t indicator.Type) []string {
+	var out []string
+	for _, src := range r.sources {
+		if src.Extract && src.Supports(t) {
+			out = append(out, src.Name)
+		}
+	}
+	return out
+}
+
+// Default holds the built-in sources (see sources.go)
+var Default = NewRegistry()
+
+// Register adds src to Default and panics if it is invalid. Call it from an init function.
+func Register(src Source) {
+	if err := Default.Register(src); err != nil {
+		panic(err)
+	}
+}
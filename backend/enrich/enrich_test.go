@@ -0,0 +1,91 @@
+package enrich
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/0x-Singularity/Augury/fakeula"
+	"github.com/0x-Singularity/Augury/indicator"
+)
+
+func TestDefault_For(t *testing.T) {
+	tests := map[indicator.Type][]string{
+		indicator.IPv4:   {CBR, Netflow, CoxSight, Asset},
+		indicator.MD5:    {CBR, Binary},
+		indicator.SHA1:   {CBR, Binary},
+		indicator.SHA256: {CBR, Binary},
+		indicator.Email:  {CoxSight},
+		indicator.URL:    {CoxSight},
+	}
+	for typ, want := range tests {
+		if got := Default.For(typ); !reflect.DeepEqual(got, want) {
+			t.Errorf("For(%s) = %v, want %v", typ, got, want)
+		}
+	}
+	if geo, _ := Default.Lookup(Geo); !geo.Supports(indicator.MD5) {
+		t.Error("sources without types should accept every type")
+	}
+}
+
+func TestDefault_RoutesEveryHash(t *testing.T) {
+	hashes := map[string]indicator.Type{
+		"D41D8CD98F00B204E9800998ECF8427E":                                 indicator.MD5,
+		"da39a3ee5e6b4b0d3255bfef95601890afd80709":                         indicator.SHA1,
+		"e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855": indicator.SHA256,
+	}
+	for hash, want := range hashes {
+		_, typ := indicator.Normalize(hash)
+		if typ != want {
+			t.Errorf("Normalize(%s) type = %s, want %s", hash, typ, want)
+		}
+		if got := Default.For(typ); !reflect.DeepEqual(got, []string{CBR, Binary}) {
+			t.Errorf("%s routed to %v, want CBR and binary", typ, got)
+		}
+	}
+}
+
+func TestDefault_Dependencies(t *testing.T) {
+	for _, src := range Default.Roots() {
+		if src.Name == Binary {
+			t.Error("binary depends on CBR and should not be a root")
+		}
+	}
+	deps := Default.Dependents(CBR)
+	if len(deps) != 1 || deps[0].Name != Binary {
+		t.Errorf("expected binary to depend on CBR, got %v", deps)
+	}
+}
+
+func TestRegistry_Register(t *testing.T) {
+	lookup := EnricherFunc(fakeula.API.Geo)
+	r := NewRegistry()
+	if err := r.Register(Source{Name: "whois", Enricher: lookup, Extract: true}); err != nil {
+		t.Fatal(err)
+	}
+	if src, _ := r.Lookup("whois"); src.Label != "whois" {
+		t.Errorf("expected the name as default label, got %q", src.Label)
+	}
+
+	tests := map[string]Source{
+		"no name":            {Enricher: lookup},
+		"no enricher":        {Name: "rdap"},
+		"duplicate":          {Name: "whois", Enricher: lookup},
+		"unknown dependency": {Name: "rdap", Enricher: lookup, Extract: true, DependsOn: "dns", Input: md5FromCBR},
+		"no input":           {Name: "rdap", Enricher: lookup, Extract: true, DependsOn: "whois"},
+	}
+	for name, src := range tests {
+		if err := r.Register(src); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestMD5FromCBR(t *testing.T) {
+	resp := &fakeula.Response{Data: []map[string]interface{}{{"process": map[string]interface{}{"hash": map[string]interface{}{"md5": "abcd1234"}}}}}
+	if got := md5FromCBR(resp); got != "abcd1234" {
+		t.Errorf("md5FromCBR() = %q, want abcd1234", got)
+	}
+	if got := md5FromCBR(&fakeula.Response{}); got != "" {
+		t.Errorf("md5FromCBR() of an empty response = %q, want nothing", got)
+	}
+}
@@ -0,0 +1,61 @@
+package enrich
+
+import (
+	"github.com/0x-Singularity/Augury/fakeula"
+	"github.com/0x-Singularity/Augury/indicator"
+	"github.com/0x-Singularity/Augury/rbac"
+)
+
+// Built-in source names
+const (
+	CBR      = "cbr"
+	Binary   = "binary"
+	Netflow  = "netflow"
+	CoxSight = "coxsight"
+	Asset    = "asset"
+	PDNS     = "pdns"
+	OIL      = "oil"
+	LDAP     = "ldap"
+	Geo      = "geo"
+	VPN      = "vpn"
+	Host     = "host"
+)
+
+// The extract flow queries the first five for every IOC of a type they accept, PDNS only
+// for its result count; the rest are looked up one at a time through their routes.
+// PDNS and LDAP route lookups are snapshotted so their answers and attributes are diffed.
+// Viewers may call the low-sensitivity routes, analysts every one.
+func init() {
+	// CBR process search understands IPs, host names, domains and hashes
+	Register(Source{Name: CBR, Label: "CBR", Enricher: EnricherFunc(fakeula.API.CBR), Role: rbac.Analyst,
+		Extract: true, Types: []indicator.Type{indicator.IPv4, indicator.IPv6, indicator.Domain, indicator.Hostname, indicator.MD5, indicator.SHA1, indicator.SHA256}})
+	// Binary lookups take a hash directly; other types only reach it through the MD5 CBR finds
+	Register(Source{Name: Binary, Label: "Binary", Enricher: EnricherFunc(fakeula.API.Binary), Role: rbac.Analyst,
+		Extract: true, Types: []indicator.Type{indicator.MD5, indicator.SHA1, indicator.SHA256},
+		DependsOn: CBR, Input: md5FromCBR, InputKey: "hash"})
+	Register(Source{Name: Netflow, Label: "Netflow", Enricher: EnricherFunc(fakeula.API.Netflow), Role: rbac.Analyst,
+		Extract: true, Types: []indicator.Type{indicator.IPv4, indicator.IPv6}})
+	Register(Source{Name: CoxSight, Label: "CoxSight", Enricher: EnricherFunc(fakeula.API.CoxSight), Role: rbac.Analyst,
+		Extract: true, Types: []indicator.Type{indicator.IPv4, indicator.IPv6, indicator.Domain, indicator.Hostname, indicator.URL, indicator.Email}})
+	Register(Source{Name: Asset, Label: "Asset", Enricher: EnricherFunc(fakeula.API.Asset), Role: rbac.Analyst,
+		Extract: true, Types: []indicator.Type{indicator.IPv4, indicator.IPv6, indicator.Domain, indicator.Hostname}})
+	// Types limits the PDNS summary the extract flow fetches for the result count
+	Register(Source{Name: PDNS, Label: "PDNS", Enricher: EnricherFunc(fakeula.API.PDNS), Role: rbac.Viewer, Snapshot: true,
+		Types: []indicator.Type{indicator.IPv4, indicator.IPv6, indicator.Domain}})
+
+	Register(Source{Name: OIL, Label: "OIL", Enricher: EnricherFunc(fakeula.API.Oil), Role: rbac.Analyst})
+	Register(Source{Name: LDAP, Label: "LDAP", Enricher: EnricherFunc(fakeula.API.LDAP), Role: rbac.Analyst, Snapshot: true})
+	Register(Source{Name: Geo, Label: "GeoIP", Enricher: EnricherFunc(fakeula.API.Geo), Role: rbac.Viewer})
+	// There is no parser for VPN, so its route returns the raw data
+	Register(Source{Name: VPN, Label: "VPN", Enricher: EnricherFunc(fakeula.API.VPN), Role: rbac.Analyst, Raw: true})
+	Register(Source{Name: Host, Label: "Host", Enricher: EnricherFunc(fakeula.API.Sensor), Role: rbac.Analyst})
+}
+
+// md5FromCBR is binary's Input: the MD5 of the first process CBR found
+func md5FromCBR(cbr *fakeula.Response) string {
+	procs, err := cbr.Processes()
+	if err != nil || len(procs) == 0 {
+		return ""
+	}
+	return procs[0].Process.Hash.MD5
+}
@@ -0,0 +1,119 @@
+package extractor
+
+import (
+	"context"
+	"strings"
+
+	"github.com/0x-Singularity/Augury/fakeula"
+	"github.com/0x-Singularity/Augury/indicator"
+	"github.com/0x-Singularity/Augury/refang"
+)
+
+// Backend names accepted in the enrichment.extractor setting and the ?extractor= query parameter
+const (
+	BackendNative  = "native"
+	BackendFakeula = "fakeula"
+)
+
+// Backend extracts indicators from text
+type Backend interface {
+	Extract(ctx context.Context, text string) ([]Indicator, error)
+}
+
+// Native adapts an Extractor to the Backend interface
+type Native struct {
+	*Extractor
+}
+
+// Extract implements Backend; native extraction cannot fail
+func (n Native) Extract(_ context.Context, text string) ([]Indicator, error) {
+	return n.Extractor.Extract(text), nil
+}
+
+// NewNative builds the native backend. A nil prefix list keeps DefaultInternalHostPrefixes;
+// an empty one marks no tokens as internal hostnames.
+func NewNative(internalHostPrefixes []string) Native {
+	return Native{New(Options{InternalHostPrefixes: internalHostPrefixes})}
+}
+
+// Fakeula sends text to FAKEula's /extract endpoint. It is kept so results can be
+// compared with the native extractor.
+type Fakeula struct {
+	API fakeula.API
+}
+
+// Extract implements Backend. The text is refanged with our rules before it is sent.
+// FAKEula does not report positions, so offsets point at the first occurrence of each
+// value, or -1 when it cannot be found (FAKEula lowercases some indicators).
+func (f Fakeula) Extract(ctx context.Context, text string) ([]Indicator, error) {
+	refanged := refang.Text(text)
+	resp, err := f.API.Extract(ctx, refanged.Text)
+	if err != nil {
+		return nil, err
+	}
+
+	offsets := newOffsetIndex(text)
+	out := make([]Indicator, 0, len(resp.Indicators))
+	for _, ind := range resp.Indicators {
+		found := Indicator{
+			Type:     fakeulaType(ind),
+			Value:    indicator.Canonical(ind.Description),
+			Original: ind.Description,
+			Start:    -1,
+			End:      -1,
+		}
+		if i := strings.Index(refanged.Text, ind.Description); i >= 0 {
+			start, end := refanged.OriginalSpan(i, i+len(ind.Description))
+			found.Original = text[start:end]
+			found.Start = offsets.char(start)
+			found.End = offsets.char(end)
+		}
+		out = append(out, found)
+	}
+	return out, nil
+}
+
+// fakeulaType maps FAKEula's STIX-style indicator types onto ours
+func fakeulaType(ind fakeula.ExtractedIndicator) indicator.Type {
+	switch ind.Type {
+	case "ipv4-addr", "ipv6-addr":
+		// FAKEula labels IPv6 addresses as ipv4-addr too
+		if strings.Contains(ind.Description, ":") {
+			return indicator.IPv6
+		}
+		return indicator.IPv4
+	case "domain-name":
+		if strings.Contains(ind.Description, ".") {
+			return indicator.Domain
+		}
+		return indicator.Hostname
+	case "email-addr":
+		return indicator.Email
+	case "url":
+		return indicator.URL
+	case "file":
+		switch len(ind.Description) {
+		case 32:
+			return indicator.MD5
+		case 40:
+			return indicator.SHA1
+		case 64:
+			return indicator.SHA256
+		}
+	}
+	return indicator.Classify(ind.Description)
+}
+
+// Values returns the distinct indicator values in order of first appearance
+func Values(indicators []Indicator) []string {
+	seen := make(map[string]bool, len(indicators))
+	out := make([]string, 0, len(indicators))
+	for _, ind := range indicators {
+		if seen[ind.Value] {
+			continue
+		}
+		seen[ind.Value] = true
+		out = append(out, ind.Value)
+	}
+	return out
+}
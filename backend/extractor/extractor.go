@@ -0,0 +1,312 @@
+// Package extractor finds IOCs in free form text without a round-trip to FAKEula.
+//
+// Text is refanged first (hxxp://evil[.]com becomes http://evil.com). The extractor then
+// recognises IPv4/IPv6 addresses, URLs, email addresses, domains, MD5/SHA1/SHA256 hashes
+// and bare internal hostnames (tokens starting with a configured prefix such as "desk"
+// or "lap"). Every match is returned with its refanged value, the text it was found as,
+// and character offsets so the frontend can highlight it in the original.
+package extractor
+
+import (
+	"net/netip"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/0x-Singularity/Augury/indicator"
+	"github.com/0x-Singularity/Augury/refang"
+)
+
+// Indicator is a single IOC found in the text.
+// Value is the refanged, canonical form and Original is the text as it appeared in the input.
+// Start and End are character (rune) offsets of Original in the input, End being exclusive.
+type Indicator struct {
+	Type     indicator.Type `json:"type"`
+	Value    string         `json:"value"`
+	Original string         `json:"original"`
+	Start    int            `json:"start"`
+	End      int            `json:"end"`
+}
+
+// DefaultInternalHostPrefixes mirrors FAKEula's internal_host_prefixes setting
+var DefaultInternalHostPrefixes = []string{"desk", "work", "lap"}
+
+// Options configures an Extractor
+type Options struct {
+	// InternalHostPrefixes marks tokens such as "desk1234" as internal hostnames.
+	// Matching is case-insensitive.
+	InternalHostPrefixes []string
+	// Refanger is applied before extraction; nil means refang.Default
+	Refanger *refang.Refanger
+}
+
+// Extractor pulls indicators out of text. It is safe for concurrent use.
+type Extractor struct {
+	prefixes []string
+	refanger *refang.Refanger
+}
+
+// New builds an Extractor. A nil prefix list falls back to DefaultInternalHostPrefixes.
+func New(opts Options) *Extractor {
+	prefixes := opts.InternalHostPrefixes
+	if prefixes == nil {
+		prefixes = DefaultInternalHostPrefixes
+	}
+	e := &Extractor{refanger: opts.Refanger}
+	if e.refanger == nil {
+		e.refanger = refang.Default
+	}
+	for _, p := range prefixes {
+		if p = strings.ToLower(strings.TrimSpace(p)); p != "" {
+			e.prefixes = append(e.prefixes, p)
+		}
+	}
+	return e
+}
+
+//--------------------Patterns---------------------------------------------------------------------
+
+var (
+	urlPattern    = regexp.MustCompile(`(?i)\b(?:https?|ftp)://[^\s<>"'` + "`" + `]+`)
+	emailPattern  = regexp.MustCompile(`(?i)\b[a-z0-9._%+\-]+@(?:[a-z0-9](?:[a-z0-9-]*[a-z0-9])?\.)+[a-z]{2,63}\b`)
+	ipv4Pattern   = regexp.MustCompile(`\b(?:(?:25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)\.){3}(?:25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)\b`)
+	ipv6Pattern   = regexp.MustCompile(`(?i)(?:[0-9a-f]{0,4}:){2,7}(?:[0-9a-f]{1,4}|(?:\d{1,3}\.){3}\d{1,3})?`)
+	hashPattern   = regexp.MustCompile(`\b[a-fA-F0-9]{32,64}\b`)
+	domainPattern = regexp.MustCompile(`(?i)\b(?:[a-z0-9](?:[a-z0-9-]{0,61}[a-z0-9])?\.)+[a-z][a-z0-9-]{0,61}[a-z0-9]\b`)
+	tokenPattern  = regexp.MustCompile(`[A-Za-z0-9][A-Za-z0-9-]*`)
+	digitPattern  = regexp.MustCompile(`\d`)
+)
+
+// trailing punctuation that usually ends a sentence rather than a URL
+const urlTrailing = ".,;:!?)]}'\""
+
+// span is a match in byte offsets of the refanged text
+type span struct {
+	typ        indicator.Type
+	value      string
+	start, end int
+}
+
+// Extract returns every indicator in text, ordered by position.
+// Repeated indicators are returned once per occurrence.
+func (e *Extractor) Extract(text string) []Indicator {
+	refanged := e.refanger.Text(text)
+	spans := e.scan(refanged.Text)
+
+	offsets := newOffsetIndex(text)
+	out := make([]Indicator, 0, len(spans))
+	for _, s := range spans {
+		start, end := refanged.OriginalSpan(s.start, s.end)
+		out = append(out, Indicator{
+			Type:     s.typ,
+			Value:    indicator.Canonical(s.value),
+			Original: text[start:end],
+			Start:    offsets.char(start),
+			End:      offsets.char(end),
+		})
+	}
+	return out
+}
+
+// scan finds indicator spans in already refanged text, ordered by position
+func (e *Extractor) scan(text string) []span {
+	var spans []span
+
+	urls := e.findURLs(text)
+	emails := findAll(emailPattern, text, indicator.Email)
+	spans = append(spans, urls...)
+	spans = append(spans, emails...)
+	spans = append(spans, findIPv4(text)...)
+	spans = append(spans, findIPv6(text)...)
+	spans = append(spans, findHashes(text)...)
+
+	// Domains inside an email address are part of that address; domains inside a URL
+	// are reported separately because the host is worth enriching on its own
+	for _, d := range findAll(domainPattern, text, indicator.Domain) {
+		if overlaps(d, emails) || indicator.Classify(d.value) != indicator.Domain {
+			continue
+		}
+		spans = append(spans, d)
+	}
+
+	spans = append(spans, e.findInternalHosts(text, spans)...)
+
+	sort.SliceStable(spans, func(i, j int) bool {
+		if spans[i].start != spans[j].start {
+			return spans[i].start < spans[j].start
+		}
+		return spans[i].end > spans[j].end
+	})
+	return spans
+}
+
+func findAll(re *regexp.Regexp, text string, typ indicator.Type) []span {
+	var out []span
+	for _, loc := range re.FindAllStringIndex(text, -1) {
+		out = append(out, span{typ: typ, value: text[loc[0]:loc[1]], start: loc[0], end: loc[1]})
+	}
+	return out
+}
+
+func (e *Extractor) findURLs(text string) []span {
+	var out []span
+	for _, s := range findAll(urlPattern, text, indicator.URL) {
+		trimmed := strings.TrimRight(s.value, urlTrailing)
+		s.end -= len(s.value) - len(trimmed)
+		s.value = trimmed
+		if strings.HasSuffix(s.value, "://") {
+			continue
+		}
+		out = append(out, s)
+	}
+	return out
+}
+
+// findIPv4 skips dotted numbers that are part of something longer, like version strings
+func findIPv4(text string) []span {
+	var out []span
+	for _, s := range findAll(ipv4Pattern, text, indicator.IPv4) {
+		if s.start >= 2 && text[s.start-1] == '.' && isDigit(text[s.start-2]) {
+			continue
+		}
+		if s.end+1 < len(text) && text[s.end] == '.' && isDigit(text[s.end+1]) {
+			continue
+		}
+		out = append(out, s)
+	}
+	return out
+}
+
+// findIPv6 uses a loose pattern to find candidates and netip to validate them,
+// which rules out things like timestamps ("12:30:45")
+func findIPv6(text string) []span {
+	var out []span
+	for _, s := range findAll(ipv6Pattern, text, indicator.IPv6) {
+		if s.start > 0 && isWordByte(text[s.start-1]) {
+			continue
+		}
+		if s.end < len(text) && isWordByte(text[s.end]) {
+			continue
+		}
+		addr, err := netip.ParseAddr(s.value)
+		if err != nil || !addr.Is6() || addr.IsUnspecified() {
+			continue
+		}
+		out = append(out, s)
+	}
+	return out
+}
+
+func findHashes(text string) []span {
+	var out []span
+	for _, s := range findAll(hashPattern, text, "") {
+		switch len(s.value) {
+		case 32:
+			s.typ = indicator.MD5
+		case 40:
+			s.typ = indicator.SHA1
+		case 64:
+			s.typ = indicator.SHA256
+		default:
+			continue
+		}
+		out = append(out, s)
+	}
+	return out
+}
+
+// findInternalHosts reports tokens such as "DESK0042" or "lap-nyc-17". A token must start
+// with a configured prefix and contain a digit, so ordinary words like "working" are ignored.
+func (e *Extractor) findInternalHosts(text string, existing []span) []span {
+	if len(e.prefixes) == 0 {
+		return nil
+	}
+	var out []span
+	for _, s := range findAll(tokenPattern, text, indicator.Hostname) {
+		// Only whole whitespace-delimited tokens count, not pieces of a URL or domain
+		if s.start > 0 && !isBoundary(text[s.start-1]) {
+			continue
+		}
+		if s.end < len(text) && !isBoundary(text[s.end]) {
+			continue
+		}
+		if !e.hasPrefix(s.value) || !digitPattern.MatchString(s.value) || overlaps(s, existing) {
+			continue
+		}
+		out = append(out, s)
+	}
+	return out
+}
+
+func (e *Extractor) hasPrefix(token string) bool {
+	lower := strings.ToLower(token)
+	for _, p := range e.prefixes {
+		if strings.HasPrefix(lower, p) && len(lower) > len(p) {
+			return true
+		}
+	}
+	return false
+}
+
+func overlaps(s span, others []span) bool {
+	for _, o := range others {
+		if s.start < o.end && o.start < s.end {
+			return true
+		}
+	}
+	return false
+}
+
+func isDigit(b byte) bool {
+	return b >= '0' && b <= '9'
+}
+
+func isWordByte(b byte) bool {
+	return isDigit(b) || b == ':' || b == '_' || (b|0x20 >= 'a' && b|0x20 <= 'z')
+}
+
+// isBoundary reports whether b may sit next to an internal hostname token
+func isBoundary(b byte) bool {
+	return strings.IndexByte(" \t\r\n,;()[]{}<>\"'", b) >= 0
+}
+
+// offsetIndex converts byte offsets into character offsets
+type offsetIndex struct {
+	ascii bool
+	chars []int
+}
+
+func newOffsetIndex(text string) offsetIndex {
+	idx := offsetIndex{ascii: true}
+	for i := 0; i < len(text); i++ {
+		if text[i] >= utf8.RuneSelf {
+			idx.ascii = false
+			break
+		}
+	}
+	if idx.ascii {
+		return idx
+	}
+	idx.chars = make([]int, len(text)+1)
+	n := 0
+	for i := range text {
+		idx.chars[i] = n
+		n++
+	}
+	idx.chars[len(text)] = n
+	// Bytes inside a multi-byte rune map to that rune's offset
+	for i := 1; i < len(text); i++ {
+		if !utf8.RuneStart(text[i]) {
+			idx.chars[i] = idx.chars[i-1]
+		}
+	}
+	return idx
+}
+
+func (o offsetIndex) char(byteOffset int) int {
+	if o.ascii {
+		return byteOffset
+	}
+	return o.chars[byteOffset]
+}
@@ -0,0 +1,118 @@
+package extractor
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/0x-Singularity/Augury/indicator"
+)
+
+func TestExtract(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []Indicator
+	}{
+		{
+			name: "ipv4 skips version strings",
+			text: "C2 at 8.8.4.4, agent 1.2.3.4.5 and 999.1.1.1",
+			want: []Indicator{ind(indicator.IPv4, "8.8.4.4", 6, 13)},
+		},
+		{
+			name: "ipv6 skips timestamps and macs",
+			text: "seen 2001:db8::ff00:42:8329 at 12:30:45 from 00:1a:2b:3c:4d:5e",
+			want: []Indicator{ind(indicator.IPv6, "2001:db8::ff00:42:8329", 5, 27)},
+		},
+		{
+			name: "url with trailing punctuation and its host",
+			text: "Download http://evil.example.com/a.exe.",
+			want: []Indicator{
+				ind(indicator.URL, "http://evil.example.com/a.exe", 9, 38),
+				ind(indicator.Domain, "evil.example.com", 16, 32),
+			},
+		},
+		{
+			name: "email domain is not reported separately",
+			text: "phish from bad.actor@mail.example.org",
+			want: []Indicator{ind(indicator.Email, "bad.actor@mail.example.org", 11, 37)},
+		},
+		{
+			name: "filenames are not domains",
+			text: "opened invoice.pdf and report.docx on example.co.uk",
+			want: []Indicator{ind(indicator.Domain, "example.co.uk", 38, 51)},
+		},
+		{
+			name: "hashes by length",
+			text: "44d88612fea8a8f36de82e1278abb02f 3395856ce81f2b7382dee72602f798b642f14140 " +
+				"275a021bbfb6489e54d471899f7db9d1663fc695ec2fe2a2c4538aabf651fd0f",
+			want: []Indicator{
+				ind(indicator.MD5, "44d88612fea8a8f36de82e1278abb02f", 0, 32),
+				ind(indicator.SHA1, "3395856ce81f2b7382dee72602f798b642f14140", 33, 73),
+				ind(indicator.SHA256, "275a021bbfb6489e54d471899f7db9d1663fc695ec2fe2a2c4538aabf651fd0f", 74, 138),
+			},
+		},
+		{
+			name: "internal hostnames need a prefix and a digit",
+			text: "working on DESK0042 and lap-nyc-7",
+			want: []Indicator{
+				{Type: indicator.Hostname, Value: "desk0042", Original: "DESK0042", Start: 11, End: 19},
+				ind(indicator.Hostname, "lap-nyc-7", 24, 33),
+			},
+		},
+		{
+			name: "offsets are in characters, not bytes",
+			text: "naïve → 10.0.0.1",
+			want: []Indicator{ind(indicator.IPv4, "10.0.0.1", 8, 16)},
+		},
+	}
+
+	e := New(Options{})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := e.Extract(tt.text)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Extract(%q)\n got  %+v\n want %+v", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+// ind builds an indicator whose original text equals its value
+func ind(typ indicator.Type, value string, start, end int) Indicator {
+	return Indicator{Type: typ, Value: value, Original: value, Start: start, End: end}
+}
+
+func TestExtract_Defanged(t *testing.T) {
+	text := "Beacon to hxxp://evil[.]com/gate and 10[.]0[.]0[.]1; reply to ops[@]evil(.)com"
+	got := New(Options{}).Extract(text)
+	want := []Indicator{
+		{Type: indicator.URL, Value: "http://evil.com/gate", Original: "hxxp://evil[.]com/gate", Start: 10, End: 32},
+		{Type: indicator.Domain, Value: "evil.com", Original: "evil[.]com", Start: 17, End: 27},
+		{Type: indicator.IPv4, Value: "10.0.0.1", Original: "10[.]0[.]0[.]1", Start: 37, End: 51},
+		{Type: indicator.Email, Value: "ops@evil.com", Original: "ops[@]evil(.)com", Start: 62, End: 78},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Extract(%q)\n got  %+v\n want %+v", text, got, want)
+	}
+	for _, ind := range got {
+		if text[ind.Start:ind.End] != ind.Original {
+			t.Errorf("offsets of %q point at %q", ind.Value, text[ind.Start:ind.End])
+		}
+	}
+}
+
+func TestExtract_CustomPrefixes(t *testing.T) {
+	e := New(Options{InternalHostPrefixes: []string{"SRV"}})
+	got := e.Extract("desk0042 srv-db-01")
+	want := []Indicator{ind(indicator.Hostname, "srv-db-01", 9, 18)}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestValues(t *testing.T) {
+	got := Values([]Indicator{{Value: "a"}, {Value: "b"}, {Value: "a"}})
+	if !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Errorf("Values() = %v", got)
+	}
+}
@@ -0,0 +1,401 @@
+// Package fakeula is a typed client for the FAKEula (Count SOCula) API.
+//
+// All lookups share one HTTP transport, take a context, and retry transient
+// failures (network errors, 429 and 5xx responses) with exponential backoff.
+// Every attempt first takes a token from its source's rate limit (see Config.Limits).
+package fakeula
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/0x-Singularity/Augury/ratelimit"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// API lists every FAKEula endpoint Augury uses. Handlers depend on this
+// interface so tests can substitute a mock for the real client.
+type API interface {
+	Oil(ctx context.Context, ioc string) (*Response, error)
+	Netflow(ctx context.Context, ioc string) (*Response, error)
+	CoxSight(ctx context.Context, ioc string) (*Response, error)
+	PDNS(ctx context.Context, ioc string) (*Response, error)
+	PDNSSummary(ctx context.Context, ioc string) (*PDNSSummary, error)
+	LDAP(ctx context.Context, ioc string) (*Response, error)
+	Geo(ctx context.Context, ioc string) (*Response, error)
+	CBR(ctx context.Context, ioc string) (*Response, error)
+	Binary(ctx context.Context, hash string) (*Response, error)
+	Sensor(ctx context.Context, ioc string) (*Response, error)
+	VPN(ctx context.Context, ioc string) (*Response, error)
+	Asset(ctx context.Context, ioc string) (*Response, error)
+	Extract(ctx context.Context, text string) (*ExtractResponse, error)
+}
+
+// Pinger is implemented by clients that can check FAKEula is reachable
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// Config holds the connection and retry settings for a Client
+type Config struct {
+	BaseURL string
+	User    string
+	Pass    string
+
+	// Timeout bounds a single attempt, not the whole retry loop
+	Timeout time.Duration
+	// MaxRetries is the number of extra attempts after the first one fails transiently
+	MaxRetries int
+	// BaseBackoff is the delay before the first retry; it doubles on every retry up to MaxBackoff
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+
+	// Limits holds one token bucket per source (the first path segment: oil, pdns, cbr...).
+	// Nil means unlimited. A call that would wait more than MaxWait for a token fails
+	// with a *ratelimit.Error instead.
+	Limits  *ratelimit.Keyed
+	MaxWait time.Duration
+}
+
+// Defaults used when a Config field is left zero
+const (
+	DefaultTimeout     = 15 * time.Second
+	DefaultMaxRetries  = 2
+	DefaultBaseBackoff = 200 * time.Millisecond
+	DefaultMaxBackoff  = 2 * time.Second
+	DefaultMaxWait     = 10 * time.Second
+)
+
+// tracer starts the span around each call
+var tracer = otel.Tracer("github.com/0x-Singularity/Augury/fakeula")
+
+// sharedTransport is reused by every Client so connections to FAKEula are pooled.
+// tracedTransport wraps it so each attempt is traced and carries the trace context to FAKEula.
+var sharedTransport = &http.Transport{
+	Proxy: http.ProxyFromEnvironment,
+	DialContext: (&net.Dialer{
+		Timeout:   5 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}).DialContext,
+	MaxIdleConns:          100,
+	MaxIdleConnsPerHost:   32,
+	IdleConnTimeout:       90 * time.Second,
+	TLSHandshakeTimeout:   5 * time.Second,
+	ExpectContinueTimeout: 1 * time.Second,
+}
+
+var tracedTransport = otelhttp.NewTransport(sharedTransport)
+
+// Client talks to a FAKEula instance. It is safe for concurrent use.
+type Client struct {
+	cfg  Config
+	base *url.URL
+	http *http.Client
+}
+
+var (
+	_ API    = (*Client)(nil)
+	_ Pinger = (*Client)(nil)
+)
+
+// New builds a Client from cfg, filling in defaults for zero values
+func New(cfg Config) (*Client, error) {
+	if cfg.BaseURL == "" {
+		return nil, errors.New("fakeula: base URL is required")
+	}
+	base, err := url.Parse(cfg.BaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("fakeula: invalid base URL: %w", err)
+	}
+	// Normalise so endpoint paths can always be appended with a single slash
+	base.Path = strings.TrimSuffix(base.Path, "/")
+
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+	if cfg.MaxRetries < 0 {
+		cfg.MaxRetries = 0
+	}
+	if cfg.BaseBackoff <= 0 {
+		cfg.BaseBackoff = DefaultBaseBackoff
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = DefaultMaxBackoff
+	}
+	if cfg.MaxWait <= 0 {
+		cfg.MaxWait = DefaultMaxWait
+	}
+
+	return &Client{
+		cfg:  cfg,
+		base: base,
+		http: &http.Client{Transport: tracedTransport, Timeout: cfg.Timeout},
+	}, nil
+}
+
+//--------------------Endpoint methods---------------------------------------------------------------------
+
+// Oil queries every OIL source for an IOC
+func (c *Client) Oil(ctx context.Context, ioc string) (*Response, error) {
+	return c.lookup(ctx, "oil", ioc)
+}
+
+// Netflow queries the netflow OIL source
+func (c *Client) Netflow(ctx context.Context, ioc string) (*Response, error) {
+	return c.lookup(ctx, "oil", "netflow", ioc)
+}
+
+// CoxSight queries the CoxSight security log OIL source
+func (c *Client) CoxSight(ctx context.Context, ioc string) (*Response, error) {
+	return c.lookup(ctx, "oil", "coxsight", ioc)
+}
+
+// PDNS queries passive DNS
+func (c *Client) PDNS(ctx context.Context, ioc string) (*Response, error) {
+	return c.lookup(ctx, "pdns", ioc)
+}
+
+// PDNSSummary returns only the number of passive DNS results for an IOC
+func (c *Client) PDNSSummary(ctx context.Context, ioc string) (*PDNSSummary, error) {
+	var summary struct {
+		Data []PDNSSummary `json:"data"`
+	}
+	if err := c.getJSON(ctx, "pdns/_summary", &summary, "pdns", ioc, "_summary"); err != nil {
+		return nil, err
+	}
+	if len(summary.Data) == 0 {
+		return &PDNSSummary{}, nil
+	}
+	return &summary.Data[0], nil
+}
+
+// LDAP looks up a user or email address in the directory
+func (c *Client) LDAP(ctx context.Context, ioc string) (*Response, error) {
+	return c.lookup(ctx, "ldap", ioc)
+}
+
+// Geo looks up GeoIP and ASN information for an IP
+func (c *Client) Geo(ctx context.Context, ioc string) (*Response, error) {
+	return c.lookup(ctx, "geo", ioc)
+}
+
+// CBR searches Carbon Black Response processes
+func (c *Client) CBR(ctx context.Context, ioc string) (*Response, error) {
+	return c.lookup(ctx, "cbr", ioc)
+}
+
+// Binary looks up a binary in Carbon Black Response by hash
+func (c *Client) Binary(ctx context.Context, hash string) (*Response, error) {
+	return c.lookup(ctx, "cbr", "binary", hash)
+}
+
+// Sensor looks up a Carbon Black Response sensor (host)
+func (c *Client) Sensor(ctx context.Context, ioc string) (*Response, error) {
+	return c.lookup(ctx, "cbr", "sensor", ioc)
+}
+
+// VPN checks whether an IP belongs to a VPN or hosting provider
+func (c *Client) VPN(ctx context.Context, ioc string) (*Response, error) {
+	return c.lookup(ctx, "vpn", ioc)
+}
+
+// Asset looks up an IP or hostname in the asset inventory
+func (c *Client) Asset(ctx context.Context, ioc string) (*Response, error) {
+	return c.lookup(ctx, "asset", ioc)
+}
+
+// Extract asks FAKEula to pull IOCs out of free form text
+func (c *Client) Extract(ctx context.Context, text string) (*ExtractResponse, error) {
+	var raw rawExtractResponse
+	err := c.do(ctx, "extract", http.MethodPost, c.endpoint("extract"), []byte(text), "text/plain", &raw)
+	if err != nil {
+		return nil, err
+	}
+	return raw.typed(), nil
+}
+
+// Ping checks that FAKEula answers an authenticated request, with a GeoIP lookup of a
+// loopback address served from FAKEula's local database. It makes a single attempt and
+// bypasses the rate limits, so health checks neither retry nor take tokens from lookups.
+func (c *Client) Ping(ctx context.Context) error {
+	_, err := c.attempt(ctx, http.MethodGet, c.endpoint("geo", "127.0.0.1"), nil, "", &Response{})
+	return err
+}
+
+//--------------------Request plumbing---------------------------------------------------------------------
+
+// lookup GETs an endpoint that returns the standard {"data": [...]} envelope
+func (c *Client) lookup(ctx context.Context, segments ...string) (*Response, error) {
+	resp := &Response{Endpoint: strings.Join(segments[:len(segments)-1], "/")}
+	if err := c.getJSON(ctx, resp.Endpoint, resp, segments...); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// getJSON GETs the endpoint at segments; name identifies it in traces, e.g. oil/netflow
+func (c *Client) getJSON(ctx context.Context, name string, out interface{}, segments ...string) error {
+	return c.do(ctx, name, http.MethodGet, c.endpoint(segments...), nil, "", out)
+}
+
+// endpoint joins path segments onto the base URL, escaping each one
+func (c *Client) endpoint(segments ...string) string {
+	u := *c.base
+	escaped := make([]string, len(segments))
+	for i, s := range segments {
+		escaped[i] = url.PathEscape(s)
+	}
+	u.Path = c.base.Path + "/" + strings.Join(segments, "/")
+	u.RawPath = c.base.EscapedPath() + "/" + strings.Join(escaped, "/")
+	return u.String()
+}
+
+// do performs the request, retrying transient failures, and decodes the JSON body into out.
+// FAKEula answers 404 with an empty data envelope when nothing is found, so 404 is not an error.
+// Each attempt counts against the rate limit of the source name starts with (oil for
+// oil/netflow). The call is traced as one span, with a child span per attempt.
+func (c *Client) do(ctx context.Context, name, method, target string, body []byte, contentType string, out interface{}) (err error) {
+	ctx, span := tracer.Start(ctx, "fakeula "+name, trace.WithAttributes(attribute.String("fakeula.endpoint", name)))
+	attempts := 0
+	defer func() {
+		span.SetAttributes(attribute.Int("fakeula.attempts", attempts))
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	source, _, _ := strings.Cut(name, "/")
+	var lastErr error
+	for attempt := 0; ; attempt++ {
+		if c.cfg.Limits != nil {
+			if err := c.cfg.Limits.Wait(ctx, source, c.cfg.MaxWait); err != nil {
+				return err
+			}
+		}
+		attempts++
+		retryAfter, err := c.attempt(ctx, method, target, body, contentType, out)
+		if err == nil {
+			return nil
+		}
+		lastErr = err
+		if ctx.Err() != nil || !isTransient(err) || attempt >= c.cfg.MaxRetries {
+			return lastErr
+		}
+
+		wait := c.backoff(attempt)
+		if retryAfter > wait {
+			wait = retryAfter
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// attempt makes a single request. It returns any Retry-After hint the server sent.
+func (c *Client) attempt(ctx context.Context, method, target string, body []byte, contentType string, out interface{}) (time.Duration, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, reader)
+	if err != nil {
+		return 0, err
+	}
+	req.SetBasicAuth(c.cfg.User, c.cfg.Pass)
+	req.Header.Set("Accept", "application/json")
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 && resp.StatusCode != http.StatusNotFound {
+		snippet, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return parseRetryAfter(resp.Header.Get("Retry-After")), &StatusError{
+			Method:     method,
+			URL:        redact(target),
+			StatusCode: resp.StatusCode,
+			Body:       strings.TrimSpace(string(snippet)),
+		}
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return 0, fmt.Errorf("fakeula: decode %s: %w", redact(target), err)
+	}
+	return 0, nil
+}
+
+// backoff returns the delay before retry number attempt+1, with up to 50% jitter
+func (c *Client) backoff(attempt int) time.Duration {
+	d := c.cfg.BaseBackoff << attempt
+	if d <= 0 || d > c.cfg.MaxBackoff {
+		d = c.cfg.MaxBackoff
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// StatusError is returned when FAKEula answers with an unexpected HTTP status
+type StatusError struct {
+	Method     string
+	URL        string
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("fakeula: %s %s: status %d: %s", e.Method, e.URL, e.StatusCode, e.Body)
+}
+
+// isTransient reports whether a failed attempt is worth retrying.
+// Callers check their own context first, so a timeout here is a per-attempt timeout.
+func isTransient(err error) bool {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode == http.StatusTooManyRequests || statusErr.StatusCode >= 500
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// parseRetryAfter understands the delta-seconds form of Retry-After
+func parseRetryAfter(value string) time.Duration {
+	if secs, err := strconv.Atoi(strings.TrimSpace(value)); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	return 0
+}
+
+// redact strips credentials from a URL before it ends up in an error or log line
+func redact(target string) string {
+	u, err := url.Parse(target)
+	if err != nil {
+		return target
+	}
+	return u.Redacted()
+}
@@ -0,0 +1,298 @@
+package fakeula
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/0x-Singularity/Augury/ratelimit"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+func newTestClient(t *testing.T, url string) *Client {
+	t.Helper()
+	c, err := New(Config{
+		BaseURL:     url,
+		User:        "user",
+		Pass:        "pass",
+		MaxRetries:  2,
+		BaseBackoff: time.Millisecond,
+		MaxBackoff:  5 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return c
+}
+
+func TestClient_PathJoiningAndAuth(t *testing.T) {
+	var gotPath string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		if u, p, ok := r.BasicAuth(); !ok || u != "user" || p != "pass" {
+			t.Errorf("missing or wrong basic auth: %q %q", u, p)
+		}
+		json.NewEncoder(w).Encode(map[string]any{"data": []any{map[string]any{"num_results": 7}}})
+	}))
+	defer server.Close()
+
+	// Trailing slash or not, paths must come out the same
+	for _, base := range []string{server.URL, server.URL + "/"} {
+		c := newTestClient(t, base)
+		summary, err := c.PDNSSummary(context.Background(), "example.com")
+		if err != nil {
+			t.Fatalf("PDNSSummary: %v", err)
+		}
+		if gotPath != "/pdns/example.com/_summary" {
+			t.Errorf("base %q: path = %q", base, gotPath)
+		}
+		if summary.NumResults != 7 {
+			t.Errorf("NumResults = %d, want 7", summary.NumResults)
+		}
+	}
+}
+
+func TestClient_CBRProcesses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"data": []any{map[string]any{
+			"process": map[string]any{"name": "evil.exe", "hash": map[string]any{"md5": "44d88612fea8a8f36de82e1278abb02f"}, "pid": 4242},
+		}}})
+	}))
+	defer server.Close()
+
+	resp, err := newTestClient(t, server.URL).CBR(context.Background(), "desk0042")
+	if err != nil {
+		t.Fatalf("CBR: %v", err)
+	}
+	procs, err := resp.Processes()
+	if err != nil {
+		t.Fatalf("Processes: %v", err)
+	}
+	if len(procs) != 1 || procs[0].Process.Name != "evil.exe" || procs[0].Process.Hash.MD5 != "44d88612fea8a8f36de82e1278abb02f" {
+		t.Errorf("unexpected processes %+v", procs)
+	}
+}
+
+func TestClient_RetriesTransientErrors(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"data": []any{map[string]any{"key": "1.2.3.4"}}})
+	}))
+	defer server.Close()
+
+	resp, err := newTestClient(t, server.URL).Netflow(context.Background(), "1.2.3.4")
+	if err != nil {
+		t.Fatalf("Netflow: %v", err)
+	}
+	if calls != 3 {
+		t.Errorf("expected 3 attempts, got %d", calls)
+	}
+	if resp.Endpoint != "oil/netflow" || len(resp.Data) != 1 {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+}
+
+func TestClient_DoesNotRetryClientErrors(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	_, err := newTestClient(t, server.URL).Geo(context.Background(), "1.2.3.4")
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected 401 StatusError, got %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("expected a single attempt, got %d", calls)
+	}
+}
+
+func TestClient_NotFoundIsEmpty(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]any{"data": []any{}})
+	}))
+	defer server.Close()
+
+	resp, err := newTestClient(t, server.URL).VPN(context.Background(), "9.9.9.9")
+	if err != nil {
+		t.Fatalf("VPN: %v", err)
+	}
+	if !resp.Empty() {
+		t.Errorf("expected empty response, got %+v", resp)
+	}
+}
+
+func TestClient_Ping(t *testing.T) {
+	var calls int32
+	status := http.StatusNotFound
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if r.URL.Path != "/geo/127.0.0.1" {
+			t.Errorf("unexpected path %q", r.URL.Path)
+		}
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]any{"data": []any{}})
+	}))
+	defer server.Close()
+	c := newTestClient(t, server.URL)
+
+	if err := c.Ping(context.Background()); err != nil {
+		t.Errorf("expected an empty answer to count as up, got %v", err)
+	}
+	status = http.StatusServiceUnavailable
+	if err := c.Ping(context.Background()); err == nil {
+		t.Error("expected an error from a failing FAKEula")
+	}
+	if calls != 2 {
+		t.Errorf("expected one attempt per ping, got %d", calls)
+	}
+}
+
+func TestClient_PropagatesTraceContext(t *testing.T) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	otel.SetTracerProvider(sdktrace.NewTracerProvider())
+	var traceparent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		json.NewEncoder(w).Encode(map[string]any{"data": []any{}})
+	}))
+	defer server.Close()
+
+	ctx, span := otel.Tracer("test").Start(context.Background(), "request")
+	defer span.End()
+	if _, err := newTestClient(t, server.URL).Asset(ctx, "host1"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(traceparent, span.SpanContext().TraceID().String()) {
+		t.Errorf("expected the trace ID in traceparent, got %q", traceparent)
+	}
+}
+
+func TestClient_Extract(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "text/plain" {
+			t.Errorf("unexpected request %s %s", r.Method, r.Header.Get("Content-Type"))
+		}
+		w.Write([]byte(`{"data": [
+			{"threat": {"indicator": {"type": "ipv4-addr", "description": "1.2.3.4"}}},
+			{"threat": {"indicator": {"type": "url", "url": "http://x"}}}
+		]}`))
+	}))
+	defer server.Close()
+
+	resp, err := newTestClient(t, server.URL).Extract(context.Background(), "seen 1.2.3.4")
+	if err != nil {
+		t.Fatalf("Extract: %v", err)
+	}
+	if got := resp.IOCs(); len(got) != 1 || got[0] != "1.2.3.4" {
+		t.Errorf("IOCs() = %v", got)
+	}
+	if resp.Indicators[0].Type != "ipv4-addr" {
+		t.Errorf("Type = %q", resp.Indicators[0].Type)
+	}
+}
+
+func TestClient_ContextCancelStopsRetries(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "busy", http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	c, _ := New(Config{BaseURL: server.URL, MaxRetries: 10, BaseBackoff: time.Second})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if _, err := c.CBR(ctx, "x"); err == nil {
+		t.Fatal("expected an error")
+	}
+	if time.Since(start) > 500*time.Millisecond {
+		t.Errorf("retries ignored context cancellation")
+	}
+}
+
+func TestClient_RateLimitsPerSource(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		json.NewEncoder(w).Encode(map[string]any{"data": []any{}})
+	}))
+	defer server.Close()
+
+	c, err := New(Config{
+		BaseURL: server.URL,
+		MaxWait: time.Millisecond,
+		Limits: ratelimit.NewKeyed(func(source string) ratelimit.Limit {
+			if source == "cbr" {
+				return ratelimit.Limit{Rate: 0.1, Burst: 1}
+			}
+			return ratelimit.Unlimited
+		}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if _, err := c.CBR(ctx, "evil.exe"); err != nil {
+		t.Fatalf("first CBR call: %v", err)
+	}
+	// Binary shares the cbr budget, which is now empty
+	_, err = c.Binary(ctx, "d41d8cd98f00b204e9800998ecf8427e")
+	if wait, limited := ratelimit.RetryAfter(err); !limited || wait <= 0 {
+		t.Fatalf("expected a rate limit error, got %v", err)
+	}
+	if _, err := c.Geo(ctx, "8.8.8.8"); err != nil {
+		t.Fatalf("geo should not be limited: %v", err)
+	}
+	if got := atomic.LoadInt32(&calls); got != 2 {
+		t.Errorf("expected 2 upstream calls, got %d", got)
+	}
+}
+
+func TestNewLimits(t *testing.T) {
+	limits, err := NewLimits("", map[string]string{"cbr": "1/m:1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := limits.Take("cbr", 1); err != nil {
+		t.Fatal("expected the first cbr call to pass")
+	}
+	if err := limits.Take("cbr", 1); err == nil {
+		t.Error("expected the cbr override to apply")
+	}
+	if err := limits.Take("geo", 20); err != nil {
+		t.Error("expected geo to keep its larger budget")
+	}
+
+	if limits, _ = NewLimits("off", nil); !limitsUnlimited(limits, "cbr") {
+		t.Error("expected off to drop the built-in cbr limit")
+	}
+
+	if _, err := NewLimits("", map[string]string{"geo": "fast"}); err == nil {
+		t.Error("expected an error for an invalid limit")
+	}
+	if _, err := NewLimits("", map[string]string{"carbonblack": "1/s"}); err == nil {
+		t.Error("expected an error for an unknown source")
+	}
+}
+
+func limitsUnlimited(limits *ratelimit.Keyed, source string) bool {
+	return limits.Take(source, 1000) == nil
+}
@@ -0,0 +1,62 @@
+package fakeula
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/0x-Singularity/Augury/ratelimit"
+)
+
+// Sources are the rate limited FAKEula endpoint groups. Netflow and CoxSight count as
+// oil, Binary and Sensor as cbr, since they hit the same backend.
+var Sources = []string{"oil", "pdns", "ldap", "geo", "cbr", "vpn", "asset", "extract"}
+
+// DefaultRateLimit applies to sources without a limit of their own
+const DefaultRateLimit = "10/s:20"
+
+// sourceRateLimits are the built-in per-source limits. Carbon Black is fragile and
+// gets a tight budget; GeoIP is a cheap local lookup.
+var sourceRateLimits = map[string]string{
+	"cbr": "2/s:5",
+	"geo": "50/s:100",
+}
+
+// NewLimits builds the per-source buckets. spec limits every source (DefaultRateLimit
+// when empty) and perSource overrides it for single sources, e.g. {"cbr": "1/s:3"}. The
+// built-in per-source limits apply unless overridden, and are dropped when spec is "off".
+func NewLimits(spec string, perSource map[string]string) (*ratelimit.Keyed, error) {
+	if spec == "" {
+		spec = DefaultRateLimit
+	}
+	def, err := ratelimit.ParseLimit(spec)
+	if err != nil {
+		return nil, fmt.Errorf("fakeula: rate limit: %w", err)
+	}
+
+	builtIn := sourceRateLimits
+	if def == ratelimit.Unlimited {
+		builtIn = nil
+	}
+
+	limits := make(map[string]ratelimit.Limit, len(Sources))
+	for source, spec := range perSource {
+		if !slices.Contains(Sources, source) {
+			return nil, fmt.Errorf("fakeula: rate limit for unknown source %q", source)
+		}
+		if limits[source], err = ratelimit.ParseLimit(spec); err != nil {
+			return nil, fmt.Errorf("fakeula: rate limit for %s: %w", source, err)
+		}
+	}
+	for source, spec := range builtIn {
+		if _, ok := limits[source]; !ok {
+			limits[source], _ = ratelimit.ParseLimit(spec)
+		}
+	}
+
+	return ratelimit.NewKeyed(func(source string) ratelimit.Limit {
+		if l, ok := limits[source]; ok {
+			return l
+		}
+		return def
+	}), nil
+}
@@ -0,0 +1,109 @@
+package fakeula
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Response is the standard FAKEula envelope: a list of ECS-style documents under "data"
+type Response struct {
+	// Endpoint is the path the response came from, e.g. "oil/netflow" or "cbr/binary"
+	Endpoint string                   `json:"-"`
+	Data     []map[string]interface{} `json:"data"`
+}
+
+// Map returns the response in the generic form parser.FormatFakeulaResponse consumes
+// and that ExtractFromText returns to the frontend
+func (r *Response) Map() map[string]interface{} {
+	data := make([]interface{}, len(r.Data))
+	for i, doc := range r.Data {
+		data[i] = doc
+	}
+	return map[string]interface{}{"data": data}
+}
+
+// Empty reports whether FAKEula found nothing
+func (r *Response) Empty() bool {
+	return r == nil || len(r.Data) == 0
+}
+
+// Decode decodes the documents into docs, a pointer to a slice of one of the typed
+// documents below
+func (r *Response) Decode(docs interface{}) error {
+	b, err := json.Marshal(r.Data)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, docs)
+}
+
+// CBRProcess is a process document from /cbr; only the fields Augury reads are typed
+type CBRProcess struct {
+	Process struct {
+		Name       string `json:"name"`
+		Executable string `json:"executable"`
+		Hash       struct {
+			MD5    string `json:"md5"`
+			SHA256 string `json:"sha256"`
+		} `json:"hash"`
+	} `json:"process"`
+}
+
+// Processes returns the documents of a /cbr response as processes
+func (r *Response) Processes() ([]CBRProcess, error) {
+	var procs []CBRProcess
+	if r.Empty() {
+		return procs, nil
+	}
+	if err := r.Decode(&procs); err != nil {
+		return nil, fmt.Errorf("fakeula: decode %s processes: %w", r.Endpoint, err)
+	}
+	return procs, nil
+}
+
+// PDNSSummary is the result of /pdns/{ioc}/_summary
+type PDNSSummary struct {
+	NumResults int `json:"num_results"`
+}
+
+// ExtractedIndicator is a single IOC found by /extract
+type ExtractedIndicator struct {
+	// Type is FAKEula's indicator type, e.g. "ipv4-addr", "domain-name", "file"
+	Type        string `json:"type"`
+	Description string `json:"description"`
+}
+
+// ExtractResponse is the result of /extract
+type ExtractResponse struct {
+	Indicators []ExtractedIndicator `json:"indicators"`
+}
+
+// IOCs returns the indicator values in the order FAKEula reported them
+func (r *ExtractResponse) IOCs() []string {
+	iocs := make([]string, 0, len(r.Indicators))
+	for _, ind := range r.Indicators {
+		iocs = append(iocs, ind.Description)
+	}
+	return iocs
+}
+
+// rawExtractResponse mirrors the nested JSON /extract returns
+type rawExtractResponse struct {
+	Data []struct {
+		Threat struct {
+			Indicator ExtractedIndicator `json:"indicator"`
+		} `json:"threat"`
+	} `json:"data"`
+}
+
+// typed flattens the nested extract JSON, skipping indicators without a description
+func (r *rawExtractResponse) typed() *ExtractResponse {
+	out := &ExtractResponse{Indicators: []ExtractedIndicator{}}
+	for _, item := range r.Data {
+		if item.Threat.Indicator.Description == "" {
+			continue
+		}
+		out.Indicators = append(out.Indicators, item.Threat.Indicator)
+	}
+	return out
+}
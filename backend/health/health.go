@@ -0,0 +1,100 @@
+// Package health probes the services Augury depends on, for the /readyz endpoint.
+//
+// A dependency is either hard or soft. Augury can't serve without a hard dependency
+// (Postgres), so an instance whose hard dependency is down reports itself unavailable
+// and the load balancer takes it out of rotation. A soft dependency that is down only
+// degrades some endpoints; it is reported, but the instance stays ready.
+package health
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Timeout bounds each probe, so a hung dependency can't stall the readiness check
+const Timeout = 5 * time.Second
+
+// Check is one dependency and how to probe it
+type Check struct {
+	Name  string
+	Hard  bool
+	Probe func(ctx context.Context) error
+}
+
+// Dependency states
+const (
+	Up   = "up"
+	Down = "down"
+)
+
+// Overall states
+const (
+	OK          = "ok"          // every dependency is up
+	Degraded    = "degraded"    // a soft dependency is down
+	Unavailable = "unavailable" // a hard dependency is down
+)
+
+// Result is the outcome of one probe
+type Result struct {
+	Status    string  `json:"status"`
+	Hard      bool    `json:"hard"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// Report is the outcome of Run
+type Report struct {
+	Status        string            `json:"status"`
+	ConfigVersion string            `json:"config_version"`
+	Dependencies  map[string]Result `json:"dependencies"`
+}
+
+// Ready reports whether every hard dependency is up
+func (r Report) Ready() bool {
+	return r.Status != Unavailable
+}
+
+// Run probes every check at once, each within Timeout
+func Run(ctx context.Context, checks []Check) Report {
+	results := make([]Result, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = probe(ctx, c)
+		}()
+	}
+	wg.Wait()
+
+	report := Report{Status: OK, Dependencies: make(map[string]Result, len(checks))}
+	for i, c := range checks {
+		res := results[i]
+		report.Dependencies[c.Name] = res
+		switch {
+		case res.Status == Up:
+		case c.Hard:
+			report.Status = Unavailable
+		case report.Status == OK:
+			report.Status = Degraded
+		}
+	}
+	return report
+}
+
+func probe(ctx context.Context, c Check) Result {
+	ctx, cancel := context.WithTimeout(ctx, Timeout)
+	defer cancel()
+	started := time.Now()
+	err := c.Probe(ctx)
+	res := Result{
+		Status:    Up,
+		Hard:      c.Hard,
+		LatencyMS: float64(time.Since(started).Microseconds()) / 1000,
+	}
+	if err != nil {
+		res.Status, res.Error = Down, err.Error()
+	}
+	return res
+}
@@ -0,0 +1,60 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func probeReturning(err error) func(context.Context) error {
+	return func(context.Context) error { return err }
+}
+
+func TestRun(t *testing.T) {
+	down := errors.New("connection refused")
+	tests := map[string]struct {
+		checks []Check
+		want   string
+	}{
+		"all up": {[]Check{
+			{Name: "database", Hard: true, Probe: probeReturning(nil)},
+			{Name: "fakeula", Probe: probeReturning(nil)},
+		}, OK},
+		"soft down": {[]Check{
+			{Name: "database", Hard: true, Probe: probeReturning(nil)},
+			{Name: "fakeula", Probe: probeReturning(down)},
+		}, Degraded},
+		"hard down": {[]Check{
+			{Name: "database", Hard: true, Probe: probeReturning(down)},
+			{Name: "fakeula", Probe: probeReturning(down)},
+		}, Unavailable},
+		"nothing to check": {nil, OK},
+	}
+	for name, tt := range tests {
+		report := Run(context.Background(), tt.checks)
+		if report.Status != tt.want {
+			t.Errorf("%s: status %q, want %q", name, report.Status, tt.want)
+		}
+		if report.Ready() != (tt.want != Unavailable) {
+			t.Errorf("%s: Ready() = %v", name, report.Ready())
+		}
+		if len(report.Dependencies) != len(tt.checks) {
+			t.Errorf("%s: expected every dependency reported, got %v", name, report.Dependencies)
+		}
+	}
+
+	report := Run(context.Background(), []Check{{Name: "fakeula", Probe: probeReturning(down)}})
+	if res := report.Dependencies["fakeula"]; res.Status != Down || res.Error != down.Error() || res.Hard {
+		t.Errorf("unexpected result %+v", res)
+	}
+}
+
+func TestRun_ProbeTimeout(t *testing.T) {
+	check := Check{Name: "database", Hard: true, Probe: func(ctx context.Context) error {
+		if _, ok := ctx.Deadline(); !ok {
+			t.Error("expected the probe to get a deadline")
+		}
+		return nil
+	}}
+	Run(context.Background(), []Check{check})
+}
@@ -0,0 +1,42 @@
+// Package identity carries the authenticated user through a request's context, so
+// controllers and models can record who ran a lookup without trusting client headers.
+package identity
+
+import "context"
+
+// Anonymous is the user name recorded when a request carries no identity
+const Anonymous = "unknown"
+
+// Identity is the authenticated caller
+type Identity struct {
+	Subject string   `json:"sub"`             // stable ID from the token issuer
+	Name    string   `json:"name"`            // user name recorded in the query log
+	Email   string   `json:"email,omitempty"` // when the issuer provides one
+	Roles   []string `json:"roles,omitempty"`
+	Method  string   `json:"method"` // how the caller authenticated, e.g. "jwt" or "header"
+
+	// Scopes limits an API key to some routes (see rbac.RequireScope).
+	// Nil means unrestricted; interactive users have no scopes.
+	Scopes []string `json:"scopes,omitempty"`
+}
+
+type contextKey struct{}
+
+// WithIdentity returns a copy of ctx carrying id
+func WithIdentity(ctx context.Context, id Identity) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the identity stored in ctx, if any
+func FromContext(ctx context.Context) (Identity, bool) {
+	id, ok := ctx.Value(contextKey{}).(Identity)
+	return id, ok
+}
+
+// UserName returns the name of the caller in ctx, or Anonymous
+func UserName(ctx context.Context) string {
+	if id, ok := FromContext(ctx); ok && id.Name != "" {
+		return id.Name
+	}
+	return Anonymous
+}
@@ -0,0 +1,180 @@
+// Package indicator classifies IOCs and puts them in canonical form. Which enrichment
+// sources are worth querying for each type is up to the sources (see package enrich).
+//
+// Canonical form keeps one spelling per indicator: domains and hostnames are lowercased
+// without a trailing dot, IPv6 addresses are compressed, hashes are lowercased. That way
+// "Evil.COM." and "evil.com" share upstream calls and query_log rows.
+package indicator
+
+import (
+	"net/netip"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// Type is the kind of IOC
+type Type string
+
+const (
+	IPv4     Type = "ipv4"
+	IPv6     Type = "ipv6"
+	Domain   Type = "domain"
+	URL      Type = "url"
+	Email    Type = "email"
+	MD5      Type = "md5"
+	SHA1     Type = "sha1"
+	SHA256   Type = "sha256"
+	Hostname Type = "hostname" // internal, not fully qualified host name
+	Unknown  Type = "unknown"
+)
+
+// Types lists every known type, in a stable order
+var Types = []Type{IPv4, IPv6, Domain, URL, Email, MD5, SHA1, SHA256, Hostname, Unknown}
+
+// IsHash reports whether t is a file hash
+func (t Type) IsHash() bool {
+	return t == MD5 || t == SHA1 || t == SHA256
+}
+
+// IsIP reports whether t is an IP address
+func (t Type) IsIP() bool {
+	return t == IPv4 || t == IPv6
+}
+
+var (
+	hexPattern      = regexp.MustCompile(`^[a-fA-F0-9]+$`)
+	labelPattern    = regexp.MustCompile(`^[a-z0-9](?:[a-z0-9_-]{0,61}[a-z0-9])?$`)
+	tldPattern      = regexp.MustCompile(`^[a-z][a-z0-9-]*[a-z0-9]$`)
+	emailLocalChars = regexp.MustCompile(`^[a-zA-Z0-9._%+\-]+$`)
+	schemePattern   = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9+.\-]*://`)
+)
+
+// Classify returns the type of value. It expects a refanged value.
+func Classify(value string) Type {
+	_, t := Normalize(value)
+	return t
+}
+
+// Normalize classifies value and returns it in canonical form.
+// Unknown values are returned trimmed but otherwise untouched.
+func Normalize(value string) (string, Type) {
+	v := strings.TrimSpace(value)
+	if v == "" {
+		return v, Unknown
+	}
+
+	if addr, ok := parseIP(v); ok {
+		if addr.Is4() {
+			return addr.String(), IPv4
+		}
+		return addr.String(), IPv6
+	}
+
+	if hexPattern.MatchString(v) {
+		switch len(v) {
+		case 32:
+			return strings.ToLower(v), MD5
+		case 40:
+			return strings.ToLower(v), SHA1
+		case 64:
+			return strings.ToLower(v), SHA256
+		}
+	}
+
+	if schemePattern.MatchString(v) {
+		if canonical, ok := canonicalURL(v); ok {
+			return canonical, URL
+		}
+		return v, Unknown
+	}
+
+	if at := strings.LastIndexByte(v, '@'); at > 0 {
+		local, domain := v[:at], canonicalHost(v[at+1:])
+		if emailLocalChars.MatchString(local) && isDomain(domain) {
+			return strings.ToLower(local) + "@" + domain, Email
+		}
+		return v, Unknown
+	}
+
+	host := canonicalHost(v)
+	if isDomain(host) {
+		return host, Domain
+	}
+	if !strings.Contains(host, ".") && labelPattern.MatchString(host) {
+		return host, Hostname
+	}
+	return v, Unknown
+}
+
+// Canonical returns value in canonical form, ignoring its type
+func Canonical(value string) string {
+	v, _ := Normalize(value)
+	return v
+}
+
+// parseIP accepts plain and bracketed addresses; IPv4-mapped IPv6 addresses become IPv4
+func parseIP(v string) (netip.Addr, bool) {
+	v = strings.TrimSuffix(strings.TrimPrefix(v, "["), "]")
+	addr, err := netip.ParseAddr(v)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
+
+// canonicalHost lowercases a host name and strips the trailing root dot
+func canonicalHost(host string) string {
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
+
+// isDomain reports whether host is a fully qualified name under a real public suffix
+func isDomain(host string) bool {
+	labels := strings.Split(host, ".")
+	if len(labels) < 2 || len(host) > 253 {
+		return false
+	}
+	for _, label := range labels {
+		if !labelPattern.MatchString(label) {
+			return false
+		}
+	}
+	if !tldPattern.MatchString(labels[len(labels)-1]) {
+		return false
+	}
+	suffix, icann := publicsuffix.PublicSuffix(host)
+	if suffix == host {
+		return false
+	}
+	return icann || strings.Contains(suffix, ".")
+}
+
+// canonicalURL lowercases the scheme and host and drops default ports and empty fragments
+func canonicalURL(raw string) (string, bool) {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return "", false
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+
+	host, port := u.Hostname(), u.Port()
+	host = canonicalHost(host)
+	if addr, ok := parseIP(host); ok {
+		host = addr.String()
+	}
+	if (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+		port = ""
+	}
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	if port != "" {
+		host += ":" + port
+	}
+	u.Host = host
+	u.Fragment = ""
+	u.RawFragment = ""
+	return u.String(), true
+}
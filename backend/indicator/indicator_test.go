@@ -0,0 +1,35 @@
+package indicator
+
+import (
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+		typ  Type
+	}{
+		{"8.8.8.8", "8.8.8.8", IPv4},
+		{"::ffff:10.0.0.1", "10.0.0.1", IPv4},
+		{"2001:0DB8:0000:0000:0000:0000:0000:0001", "2001:db8::1", IPv6},
+		{"[2001:db8::1]", "2001:db8::1", IPv6},
+		{"Evil.Example.COM.", "evil.example.com", Domain},
+		{"report.pdf", "report.pdf", Unknown},
+		{"DESK0042", "desk0042", Hostname},
+		{"Alice.Bob@Example.com", "alice.bob@example.com", Email},
+		{"HTTP://Evil.COM:80/Path?q=1#frag", "http://evil.com/Path?q=1", URL},
+		{"https://[2001:DB8::1]:8443/", "https://[2001:db8::1]:8443/", URL},
+		{"44D88612FEA8A8F36DE82E1278ABB02F", "44d88612fea8a8f36de82e1278abb02f", MD5},
+		{"3395856ce81f2b7382dee72602f798b642f14140", "3395856ce81f2b7382dee72602f798b642f14140", SHA1},
+		{"275A021BBFB6489E54D471899F7DB9D1663FC695EC2FE2A2C4538AABF651FD0F", "275a021bbfb6489e54d471899f7db9d1663fc695ec2fe2a2c4538aabf651fd0f", SHA256},
+		{"  ", "", Unknown},
+		{"not an ioc!", "not an ioc!", Unknown},
+	}
+	for _, tt := range tests {
+		got, typ := Normalize(tt.in)
+		if got != tt.want || typ != tt.typ {
+			t.Errorf("Normalize(%q) = %q, %s; want %q, %s", tt.in, got, typ, tt.want, tt.typ)
+		}
+	}
+}
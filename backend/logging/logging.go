@@ -0,0 +1,178 @@
+// Package logging sets up structured logging with log/slog. Lines logged with a request's
+// context (slog.InfoContext and friends) carry its request ID, the authenticated user
+// and, where the code has narrowed the context with WithIOC and WithSource, the IOC and
+// enrichment source they are about. Middleware assigns the request ID and echoes it in
+// the X-Request-ID response header, so a user can quote it in a support ticket.
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/0x-Singularity/Augury/config"
+	"github.com/0x-Singularity/Augury/identity"
+	"github.com/0x-Singularity/Augury/response"
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RequestIDHeader carries the request ID in both directions
+const RequestIDHeader = "X-Request-ID"
+
+// Field names added from the context
+const (
+	KeyRequestID = "request_id"
+	KeyUser      = "user"
+	KeyIOC       = "ioc"
+	KeySource    = "source"
+)
+
+// Setup makes a logger writing to w, in the format and at the level cfg names, the
+// slog default. The standard log package writes through it too.
+func Setup(w io.Writer, cfg config.Logging) {
+	slog.SetDefault(New(w, cfg))
+}
+
+// New returns a logger writing to w, in the format and at the level cfg names
+func New(w io.Writer, cfg config.Logging) *slog.Logger {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(cfg.Level)); err != nil {
+		level = slog.LevelInfo // Validate rejects unknown levels
+	}
+	opts := &slog.HandlerOptions{Level: level}
+	var h slog.Handler = slog.NewJSONHandler(w, opts)
+	if cfg.Format == config.LogFormatText {
+		h = slog.NewTextHandler(w, opts)
+	}
+	return slog.New(contextHandler{h})
+}
+
+//--------------------Context fields-----------------------------------------------------------------------
+
+type (
+	requestIDKey struct{}
+	iocKey       struct{}
+	sourceKey    struct{}
+)
+
+// RequestID returns the ID Middleware gave the request in ctx
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// WithIOC returns a copy of ctx whose log lines name ioc
+func WithIOC(ctx context.Context, ioc string) context.Context {
+	return context.WithValue(ctx, iocKey{}, ioc)
+}
+
+// WithSource returns a copy of ctx whose log lines name the enrichment source
+func WithSource(ctx context.Context, source string) context.Context {
+	return context.WithValue(ctx, sourceKey{}, source)
+}
+
+// contextHandler adds the context fields to every record, unless the call already set them
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if ctx == nil {
+		return h.Handler.Handle(ctx, r)
+	}
+	set := make(map[string]bool)
+	r.Attrs(func(a slog.Attr) bool {
+		set[a.Key] = true
+		return true
+	})
+	add := func(key, value string) {
+		if value != "" && !set[key] {
+			r.AddAttrs(slog.String(key, value))
+		}
+	}
+	add(KeyRequestID, RequestID(ctx))
+	if id, ok := identity.FromContext(ctx); ok {
+		add(KeyUser, id.Name)
+	}
+	ioc, _ := ctx.Value(iocKey{}).(string)
+	add(KeyIOC, ioc)
+	source, _ := ctx.Value(sourceKey{}).(string)
+	add(KeySource, source)
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+//--------------------Middleware---------------------------------------------------------------------------
+
+// Middleware gives every request an ID: the caller's X-Request-ID when it is a sane
+// token, so IDs can follow a request across services, and a random one otherwise.
+// The ID is echoed in the response and recorded on the request's trace span.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		trace.SpanFromContext(r.Context()).SetAttributes(attribute.String("augury.request_id", id))
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+// validRequestID accepts up to 64 letters, digits, '-', '_' and '.', so a caller can't
+// forge log fields through the header
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	return strings.IndexFunc(id, func(c rune) bool {
+		return !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.')
+	}) < 0
+}
+
+func newRequestID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// AccessLog logs one line per request once it has been served: method, route, status and
+// duration. It must run after authentication so the line names the user.
+func AccessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rw := response.NewRecorder(w)
+		started := time.Now()
+		next.ServeHTTP(rw, r)
+
+		route := r.URL.Path
+		if current := mux.CurrentRoute(r); current != nil {
+			if tmpl, err := current.GetPathTemplate(); err == nil {
+				route = tmpl
+			}
+		}
+		level := slog.LevelInfo
+		if rw.Status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		slog.Log(r.Context(), level, "Request served",
+			"method", r.Method,
+			"route", route,
+			"status", rw.Status,
+			"duration_ms", time.Since(started).Milliseconds(),
+		)
+	})
+}
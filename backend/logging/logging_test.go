@@ -0,0 +1,97 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/0x-Singularity/Augury/config"
+	"github.com/0x-Singularity/Augury/identity"
+)
+
+func TestMiddleware_RequestID(t *testing.T) {
+	var seen string
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = RequestID(r.Context())
+	}))
+
+	tests := map[string]struct {
+		header string
+		keep   bool
+	}{
+		"generated":     {"", false},
+		"caller's own":  {"ticket-42.a_b", true},
+		"forged fields": {"x\" user=\"admin", false},
+		"too long":      {strings.Repeat("a", 65), false},
+	}
+	for name, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/api/history", nil)
+		if tt.header != "" {
+			req.Header.Set(RequestIDHeader, tt.header)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		got := rec.Header().Get(RequestIDHeader)
+		if got == "" || got != seen {
+			t.Errorf("%s: echoed %q, handler saw %q", name, got, seen)
+		}
+		if (got == tt.header) != tt.keep {
+			t.Errorf("%s: got request ID %q", name, got)
+		}
+	}
+}
+
+func TestNew_AddsContextFields(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, config.Logging{Level: "info", Format: config.LogFormatJSON})
+
+	ctx := context.WithValue(context.Background(), requestIDKey{}, "req-1")
+	ctx = identity.WithIdentity(ctx, identity.Identity{Name: "alice"})
+	ctx = WithSource(WithIOC(ctx, "1.2.3.4"), "vpn")
+	logger.WarnContext(ctx, "Upstream query failed", KeySource, "geo")
+	logger.DebugContext(ctx, "below the level")
+
+	var line map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("expected one JSON line, got %q: %v", buf.String(), err)
+	}
+	want := map[string]string{KeyRequestID: "req-1", KeyUser: "alice", KeyIOC: "1.2.3.4", KeySource: "geo", "level": "WARN"}
+	for key, value := range want {
+		if line[key] != value {
+			t.Errorf("%s = %v, want %q", key, line[key], value)
+		}
+	}
+	if n := strings.Count(buf.String(), `"source"`); n != 1 {
+		t.Errorf("expected source once, got it %d times", n)
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	var buf bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(New(&buf, config.Logging{Level: "info", Format: config.LogFormatJSON}))
+	defer slog.SetDefault(prev)
+
+	handler := Middleware(AccessLog(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "boom", http.StatusBadGateway)
+	})))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/ioc/geo", nil))
+
+	var line map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("expected one JSON line, got %q: %v", buf.String(), err)
+	}
+	if line["status"] != float64(http.StatusBadGateway) || line["level"] != "ERROR" {
+		t.Errorf("unexpected access log line %v", line)
+	}
+	if line[KeyRequestID] != rec.Header().Get(RequestIDHeader) {
+		t.Errorf("access log names request %v, response %q", line[KeyRequestID], rec.Header().Get(RequestIDHeader))
+	}
+}
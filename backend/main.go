@@ -1,53 +1,88 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"html/template"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
-
+	"time"
+
+	"github.com/0x-Singularity/Augury/apikey"
+	"github.com/0x-Singularity/Augury/auth"
+	"github.com/0x-Singularity/Augury/cache"
+	"github.com/0x-Singularity/Augury/config"
+	"github.com/0x-Singularity/Augury/controllers"
+	"github.com/0x-Singularity/Augury/fakeula"
+	"github.com/0x-Singularity/Augury/logging"
+	"github.com/0x-Singularity/Augury/metrics"
 	"github.com/0x-Singularity/Augury/models" // Import database models
+	"github.com/0x-Singularity/Augury/parser"
 	"github.com/0x-Singularity/Augury/routes" // Import API routes
+	"github.com/0x-Singularity/Augury/tracing"
 	"github.com/gorilla/mux"
 	"github.com/joho/godotenv"
 )
 
-// CORSMiddleware adds CORS headers to the response
-func CORSMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-User-Name")
-
-		// Handle preflight OPTIONS request
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
-			return
-		}
-
-		// Call the next handler
-		next.ServeHTTP(w, r)
-	})
-}
-
 func main() {
 
 	// Load environment variables from .env
-	err := godotenv.Load()
+	envErr := godotenv.Load()
+
+	// Settings come from the file named by AUGURY_CONFIG (if any), overridden by the environment.
+	// "augury migrate ..." needs only the database settings, so only those are checked for it.
+	migrating := len(os.Args) > 1 && os.Args[1] == "migrate"
+	load := config.Load
+	if migrating {
+		load = config.LoadDatabase
+	}
+	cfg, err := load(os.Getenv(config.PathEnv))
 	if err != nil {
-		log.Println("Warning: No .env file found, using system environment variables")
+		fatal("Invalid configuration", err)
 	}
 
-	// Initialize Azure SQL database connection
-	err = models.ConnectDB()
+	// Log structured lines from here on
+	logging.Setup(os.Stderr, cfg.Logging)
+	if envErr != nil {
+		slog.Warn("No .env file found, using system environment variables")
+	}
+
+	// Initialize the PostgreSQL connection
+	if cfg.Database.Disabled {
+		slog.Warn("Database disabled; lookups are not logged, cached or audited")
+	} else if err := models.ConnectDB(cfg.Database); err != nil {
+		fatal("Failed to connect to database", err)
+	} else {
+		metrics.RegisterDB(models.DB())
+	}
+
+	// "augury migrate ..." manages the schema and exits
+	if migrating {
+		if cfg.Database.Disabled {
+			fatal("migrate needs a database, but it is disabled", nil)
+		}
+		if err := runMigrate(os.Args[2:]); err != nil {
+			fatal("Migration failed", err)
+		}
+		return
+	}
+	if !cfg.Database.Disabled {
+		if err := migrateOnStartup(cfg.Database.AutoMigrate); err != nil {
+			fatal("Database schema check failed", err)
+		}
+	}
+
+	// Trace requests from here on; the migrate subcommand above is not traced
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
 	if err != nil {
-		log.Fatal("Failed to connect to database:", err)
+		fatal("Failed to set up tracing", err)
 	}
 
-	router := mux.NewRouter()
+	parser.ConfigureCache(cache.Options{MaxEntries: cfg.Cache.ParseSize, TTL: cfg.Cache.ParseTTL})
+	metrics.RegisterCache("parse", parser.CacheStats)
 
-	// Apply CORS middleware to all routes
-	router.Use(CORSMiddleware)
+	router := mux.NewRouter()
 
 	staticFileDirectory := http.Dir("../frontend/static")
 	staticFileHandler := http.StripPrefix("/static/", http.FileServer(staticFileDirectory))
@@ -67,23 +102,71 @@ func main() {
 		}
 	}).Methods("GET")
 
-	// Register API routes
-	routes.SetupRoutes(router)
+	// One FAKEula client, and its rate limits, shared by every handler
+	clientCfg, err := cfg.Fakeula.ClientConfig()
+	if err != nil {
+		fatal("Failed to configure FAKEula client", err)
+	}
+	api, err := fakeula.New(clientCfg)
+	if err != nil {
+		fatal("Failed to configure FAKEula client", err)
+	}
+
+	// Register API routes behind authentication; API keys live in the database
+	var keys auth.APIKeyVerifier
+	if !cfg.Database.Disabled {
+		keys = apikey.NewVerifier(nil)
+	}
+	authn, err := auth.NewFromConfig(cfg.Auth, keys)
+	if err != nil {
+		fatal("Failed to configure authentication", err)
+	}
+	slog.Info("API authentication configured", "mode", authn.Mode())
+	limits, err := cfg.Server.APILimits()
+	if err != nil {
+		fatal("Failed to configure rate limits", err)
+	}
+	handlers := controllers.New(cfg, api)
+	routes.SetupRoutes(router, cfg, handlers, authn, limits)
 
-	// Start server
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	// Expired upstream responses are deleted in the background until shutdown
+	purgeCtx, stopPurge := context.WithCancel(context.Background())
+	go handlers.PurgeResponses(purgeCtx, cfg.Cache.PurgeInterval)
+
+	// Browsers may call the API only from the configured origins. The policy wraps the whole
+	// router so preflight requests are answered for every path.
+	corsPolicy, err := cfg.CORS.Policy()
+	if err != nil {
+		fatal("Failed to configure CORS", err)
 	}
-	log.Println("Server running at http://localhost:" + port)
-	log.Fatal(http.ListenAndServe(":"+port, router))
 
-	// Debugging: Print all registered routes
-	router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
-		path, err := route.GetPathTemplate()
-		if err == nil {
-			log.Println("Registered Route:", path)
-		}
-		return nil
-	})
+	logRoutes(router)
+
+	// Serve until SIGTERM/SIGINT, then let in-flight lookups finish before closing the database
+	srv := newServer(cfg.Server, tracing.Handler(corsPolicy.Middleware(router)))
+	slog.Info("Server running", "url", fmt.Sprintf("http://localhost:%d", cfg.Server.Port))
+	err = serve(srv, cfg.Server.ShutdownTimeout)
+	stopPurge()
+	if dbErr := models.CloseDB(); dbErr != nil {
+		slog.Error("Failed to close database", "err", dbErr)
+	}
+	flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	if traceErr := shutdownTracing(flushCtx); traceErr != nil {
+		slog.Error("Failed to flush traces", "err", traceErr)
+	}
+	cancel()
+	if err != nil {
+		fatal("Server stopped", err)
+	}
+	slog.Info("Server stopped")
+}
+
+// fatal logs msg and err, if any, and exits
+func fatal(msg string, err error) {
+	if err != nil {
+		slog.Error(msg, "err", err)
+	} else {
+		slog.Error(msg)
+	}
+	os.Exit(1)
 }
@@ -0,0 +1,169 @@
+// Package metrics exposes Prometheus metrics on /metrics: HTTP requests per route,
+// FAKEula calls per source, IOCs per extraction, cache effectiveness and the database
+// connection pool.
+//
+// Everything is registered on Registry rather than the global default registry, so only
+// Augury's own metrics plus the Go runtime and process collectors are served.
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/0x-Singularity/Augury/cache"
+	"github.com/0x-Singularity/Augury/response"
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "augury"
+
+// Registry holds every metric Handler serves
+var Registry = prometheus.NewRegistry()
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by route template, method and status code.",
+	}, []string{"route", "method", "code"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by route template and method.",
+		Buckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"route", "method"})
+
+	upstreamDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "upstream_request_duration_seconds",
+		Help:      "FAKEula call latency by source, including retries, for calls not served from the cache.",
+		Buckets:   []float64{.01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+	}, []string{"source"})
+
+	upstreamErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "upstream_errors_total",
+		Help:      "Failed FAKEula calls by source and reason (error, rate_limited or canceled).",
+	}, []string{"source", "reason"})
+
+	responseCache = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "response_cache_lookups_total",
+		Help:      "Upstream response cache lookups by source and result (hit or miss).",
+	}, []string{"source", "result"})
+
+	iocsPerRequest = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "extracted_iocs",
+		Help:      "IOCs extracted per extraction request.",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 10),
+	})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests, httpDuration, upstreamDuration, upstreamErrors, responseCache, iocsPerRequest,
+	)
+}
+
+// Handler serves the metrics in Registry
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// Middleware counts and times every request routed by mux, labelled with the route
+// template (/api/ioc/geo, not the raw path) so IOCs never become label values
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := "unmatched"
+		if current := mux.CurrentRoute(r); current != nil {
+			if tmpl, err := current.GetPathTemplate(); err == nil {
+				route = tmpl
+			}
+		}
+		rw := response.NewRecorder(w)
+		started := time.Now()
+		next.ServeHTTP(rw, r)
+
+		httpDuration.WithLabelValues(route, r.Method).Observe(time.Since(started).Seconds())
+		httpRequests.WithLabelValues(route, r.Method, strconv.Itoa(rw.Status)).Inc()
+	})
+}
+
+// ObserveUpstream records one FAKEula call to source that took d; reason is empty on success
+func ObserveUpstream(source string, d time.Duration, reason string) {
+	upstreamDuration.WithLabelValues(source).Observe(d.Seconds())
+	if reason != "" {
+		upstreamErrors.WithLabelValues(source, reason).Inc()
+	}
+}
+
+// ObserveResponseCache records a response cache lookup for source
+func ObserveResponseCache(source string, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	responseCache.WithLabelValues(source, result).Inc()
+}
+
+// ObserveExtraction records how many IOCs one request extracted
+func ObserveExtraction(iocs int) {
+	iocsPerRequest.Observe(float64(iocs))
+}
+
+// RegisterCache exports the statistics of an in-memory cache, labelled cache=name.
+// Each name may be registered once.
+func RegisterCache(name string, stats func() cache.Stats) {
+	Registry.MustRegister(newCacheCollector(name, stats))
+}
+
+// RegisterDB exports the connection pool statistics of db
+func RegisterDB(db *sql.DB) {
+	Registry.MustRegister(collectors.NewDBStatsCollector(db, namespace))
+}
+
+// cacheCollector reads a cache's statistics at scrape time
+type cacheCollector struct {
+	stats                                   func() cache.Stats
+	hits, misses, evictions, entries, ratio *prometheus.Desc
+}
+
+func newCacheCollector(name string, stats func() cache.Stats) *cacheCollector {
+	desc := func(metric, help string) *prometheus.Desc {
+		return prometheus.NewDesc(namespace+"_cache_"+metric, help, nil, prometheus.Labels{"cache": name})
+	}
+	return &cacheCollector{
+		stats:     stats,
+		hits:      desc("hits_total", "In-memory cache hits."),
+		misses:    desc("misses_total", "In-memory cache misses."),
+		evictions: desc("evictions_total", "In-memory cache evictions."),
+		entries:   desc("entries", "Entries held by an in-memory cache."),
+		ratio:     desc("hit_ratio", "In-memory cache hits over lookups since startup."),
+	}
+}
+
+func (c *cacheCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.hits
+	ch <- c.misses
+	ch <- c.evictions
+	ch <- c.entries
+	ch <- c.ratio
+}
+
+func (c *cacheCollector) Collect(ch chan<- prometheus.Metric) {
+	s := c.stats()
+	ch <- prometheus.MustNewConstMetric(c.hits, prometheus.CounterValue, float64(s.Hits))
+	ch <- prometheus.MustNewConstMetric(c.misses, prometheus.CounterValue, float64(s.Misses))
+	ch <- prometheus.MustNewConstMetric(c.evictions, prometheus.CounterValue, float64(s.Evictions))
+	ch <- prometheus.MustNewConstMetric(c.entries, prometheus.GaugeValue, float64(s.Entries))
+	ch <- prometheus.MustNewConstMetric(c.ratio, prometheus.GaugeValue, s.HitRatio())
+}
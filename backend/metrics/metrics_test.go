@@ -0,0 +1,54 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/0x-Singularity/Augury/cache"
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMiddleware_LabelsRouteTemplate(t *testing.T) {
+	router := mux.NewRouter()
+	router.Use(Middleware)
+	router.HandleFunc("/api/ioc/{source}", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "nope", http.StatusTeapot)
+	})
+
+	for _, ioc := range []string{"a", "b"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/ioc/"+ioc, nil))
+	}
+	if got := testutil.ToFloat64(httpRequests.WithLabelValues("/api/ioc/{source}", "GET", "418")); got != 2 {
+		t.Errorf("expected 2 requests under the route template, got %v", got)
+	}
+}
+
+func TestObserveUpstream(t *testing.T) {
+	ObserveUpstream("vpn", 10*time.Millisecond, "")
+	ObserveUpstream("vpn", time.Second, "rate_limited")
+	if got := testutil.ToFloat64(upstreamErrors.WithLabelValues("vpn", "rate_limited")); got != 1 {
+		t.Errorf("expected one rate limited error, got %v", got)
+	}
+	if got := testutil.CollectAndCount(upstreamDuration, namespace+"_upstream_request_duration_seconds"); got < 1 {
+		t.Errorf("expected a latency series for vpn, got %d", got)
+	}
+}
+
+func TestRegisterCache(t *testing.T) {
+	RegisterCache("first", func() cache.Stats { return cache.Stats{Hits: 3, Misses: 1, Entries: 2} })
+	RegisterCache("second", func() cache.Stats { return cache.Stats{} })
+
+	expected := `
+# HELP augury_cache_hit_ratio In-memory cache hits over lookups since startup.
+# TYPE augury_cache_hit_ratio gauge
+augury_cache_hit_ratio{cache="first"} 0.75
+augury_cache_hit_ratio{cache="second"} 0
+`
+	if err := testutil.GatherAndCompare(Registry, strings.NewReader(expected), "augury_cache_hit_ratio"); err != nil {
+		t.Error(err)
+	}
+}
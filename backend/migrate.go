@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+
+	"github.com/0x-Singularity/Augury/migrations"
+	"github.com/0x-Singularity/Augury/models"
+)
+
+const migrateUsage = `usage: augury migrate <command>
+
+commands:
+  up         apply every pending migration
+  down [n]   roll back the newest n migrations (default 1)
+  status     show the applied and latest schema versions`
+
+// runMigrate implements the "migrate" subcommand
+func runMigrate(args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+	m, err := migrations.New(models.DB())
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	switch args[0] {
+	case "up":
+		applied, err := m.Up(ctx)
+		for _, v := range applied {
+			slog.Info("Applied migration", "version", v)
+		}
+		if err != nil {
+			return err
+		}
+		slog.Info("Schema is up to date", "version", m.Latest())
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+				return fmt.Errorf("down: invalid step count %q", args[1])
+			}
+		}
+		reverted, err := m.Down(ctx, steps)
+		for _, v := range reverted {
+			slog.Info("Reverted migration", "version", v)
+		}
+		return err
+
+	case "status":
+		applied, err := m.Applied(ctx)
+		if err != nil {
+			return err
+		}
+		for _, a := range applied {
+			fmt.Printf("%4d  %-40s  %s\n", a.Version, a.Name, a.AppliedAt.Format("2006-01-02 15:04:05"))
+		}
+		fmt.Printf("latest known version: %d\n", m.Latest())
+		return m.Check(ctx)
+
+	default:
+		return errors.New(migrateUsage)
+	}
+	return nil
+}
+
+// migrateOnStartup brings the schema up to date before serving. Without auto (database.auto_migrate,
+// AUGURY_AUTO_MIGRATE=0) it only checks that the schema is not newer than this build.
+// Either way the server refuses to start against a newer schema.
+func migrateOnStartup(auto bool) error {
+	m, err := migrations.New(models.DB())
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	if !auto {
+		current, err := m.Version(ctx)
+		if err != nil {
+			return err
+		}
+		if current < m.Latest() {
+			slog.Warn("Schema is behind; run \"augury migrate up\"", "version", current, "latest", m.Latest())
+		}
+		return m.Check(ctx)
+	}
+
+	applied, err := m.Up(ctx)
+	for _, v := range applied {
+		slog.Info("Applied migration", "version", v)
+	}
+	return err
+}
@@ -0,0 +1,266 @@
+// Package migrations applies Augury's versioned Postgres schema.
+//
+// Migrations are embedded SQL files named NNNN_description.up.sql and
+// NNNN_description.down.sql. Applied versions are recorded in the schema_version
+// table; each migration runs in its own transaction together with its version row,
+// and a Postgres advisory lock keeps two instances from migrating at once.
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+//go:embed sql/*.sql
+var files embed.FS
+
+// Migration is one schema change
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// ErrSchemaTooNew means the database was migrated by a newer build than this one
+var ErrSchemaTooNew = errors.New("database schema is newer than this build supports")
+
+// lockKey identifies Augury's migration advisory lock
+const lockKey = 0x41554752 // "AUGR"
+
+const createVersionTable = `
+	CREATE TABLE IF NOT EXISTS schema_version (
+		version    INT          PRIMARY KEY,
+		name       VARCHAR(255) NOT NULL,
+		applied_at TIMESTAMPTZ  NOT NULL DEFAULT now()
+	);
+`
+
+var filePattern = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// All returns the embedded migrations ordered by version
+func All() ([]Migration, error) {
+	return load(files, "sql")
+}
+
+// load parses the migrations in dir of fsys. Every version needs both an up and a down file.
+func load(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("read migrations: %w", err)
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		m := filePattern.FindStringSubmatch(entry.Name())
+		if m == nil {
+			return nil, fmt.Errorf("unexpected migration file %q", entry.Name())
+		}
+		version, _ := strconv.Atoi(m[1])
+		body, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", entry.Name(), err)
+		}
+
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = mig
+		} else if mig.Name != m[2] {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, mig.Name, m[2])
+		}
+		if m[3] == "up" {
+			mig.Up = string(body)
+		} else {
+			mig.Down = string(body)
+		}
+	}
+
+	out := make([]Migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if mig.Up == "" || mig.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s needs both up and down files", mig.Version, mig.Name)
+		}
+		out = append(out, *mig)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Version < out[j].Version })
+	for i, mig := range out {
+		if mig.Version != i+1 {
+			return nil, fmt.Errorf("migration versions must be consecutive from 1, found %d at position %d", mig.Version, i+1)
+		}
+	}
+	return out, nil
+}
+
+// Migrator applies migrations to a database
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+// New returns a Migrator for the embedded migrations
+func New(db *sql.DB) (*Migrator, error) {
+	all, err := All()
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: all}, nil
+}
+
+// Latest is the newest version this build knows about
+func (m *Migrator) Latest() int {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// AppliedMigration is a row of schema_version
+type AppliedMigration struct {
+	Version   int       `json:"version"`
+	Name      string    `json:"name"`
+	AppliedAt time.Time `json:"applied_at"`
+}
+
+// Applied lists the migrations recorded in schema_version, oldest first
+func (m *Migrator) Applied(ctx context.Context) ([]AppliedMigration, error) {
+	if _, err := m.db.ExecContext(ctx, createVersionTable); err != nil {
+		return nil, fmt.Errorf("create schema_version: %w", err)
+	}
+	rows, err := m.db.QueryContext(ctx, `SELECT version, name, applied_at FROM schema_version ORDER BY version;`)
+	if err != nil {
+		return nil, fmt.Errorf("select schema_version: %w", err)
+	}
+	defer rows.Close()
+
+	var out []AppliedMigration
+	for rows.Next() {
+		var a AppliedMigration
+		if err := rows.Scan(&a.Version, &a.Name, &a.AppliedAt); err != nil {
+			return nil, fmt.Errorf("scan schema_version: %w", err)
+		}
+		out = append(out, a)
+	}
+	return out, rows.Err()
+}
+
+// Version returns the current schema version, 0 for an empty database
+func (m *Migrator) Version(ctx context.Context) (int, error) {
+	applied, err := m.Applied(ctx)
+	if err != nil || len(applied) == 0 {
+		return 0, err
+	}
+	return applied[len(applied)-1].Version, nil
+}
+
+// Check returns ErrSchemaTooNew if the database is ahead of this build
+func (m *Migrator) Check(ctx context.Context) error {
+	current, err := m.Version(ctx)
+	if err != nil {
+		return err
+	}
+	return checkVersion(current, m.Latest())
+}
+
+func checkVersion(current, latest int) error {
+	if current > latest {
+		return fmt.Errorf("%w (database at %d, build supports %d)", ErrSchemaTooNew, current, latest)
+	}
+	return nil
+}
+
+// Up applies every pending migration and returns the versions it applied.
+// It refuses to run against a schema newer than this build.
+func (m *Migrator) Up(ctx context.Context) ([]int, error) {
+	var applied []int
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		current, err := m.Version(ctx)
+		if err != nil {
+			return err
+		}
+		if err := checkVersion(current, m.Latest()); err != nil {
+			return err
+		}
+		for _, mig := range m.migrations[current:] {
+			err := m.apply(ctx, conn, mig.Up, func(tx *sql.Tx) error {
+				_, err := tx.ExecContext(ctx, `INSERT INTO schema_version (version, name) VALUES ($1, $2);`, mig.Version, mig.Name)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("migration %d_%s up: %w", mig.Version, mig.Name, err)
+			}
+			applied = append(applied, mig.Version)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down rolls back the newest steps migrations and returns the versions it reverted
+func (m *Migrator) Down(ctx context.Context, steps int) ([]int, error) {
+	var reverted []int
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		current, err := m.Version(ctx)
+		if err != nil {
+			return err
+		}
+		if err := checkVersion(current, m.Latest()); err != nil {
+			return err
+		}
+		for ; steps > 0 && current > 0; steps, current = steps-1, current-1 {
+			mig := m.migrations[current-1]
+			err := m.apply(ctx, conn, mig.Down, func(tx *sql.Tx) error {
+				_, err := tx.ExecContext(ctx, `DELETE FROM schema_version WHERE version = $1;`, mig.Version)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("migration %d_%s down: %w", mig.Version, mig.Name, err)
+			}
+			reverted = append(reverted, mig.Version)
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// apply runs a migration script and its schema_version bookkeeping in one transaction
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, script string, record func(tx *sql.Tx) error) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return err
+	}
+	if err := record(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// locked runs fn while holding the migration advisory lock on a dedicated connection
+func (m *Migrator) locked(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("migration connection: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1);`, lockKey); err != nil {
+		return fmt.Errorf("acquire migration lock: %w", err)
+	}
+	defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1);`, lockKey)
+
+	return fn(conn)
+}
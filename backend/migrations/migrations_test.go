@@ -0,0 +1,100 @@
+package migrations
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestAll_Embedded(t *testing.T) {
+	all, err := All()
+	if err != nil {
+		t.Fatalf("embedded migrations do not load: %v", err)
+	}
+	if len(all) == 0 || all[0].Version != 1 || all[0].Name != "create_ioc_query_log" {
+		t.Fatalf("unexpected migrations %+v", all)
+	}
+	for _, m := range all {
+		if !strings.Contains(m.Up, "CREATE") || !strings.Contains(m.Down, "DROP") {
+			t.Errorf("migration %d looks incomplete", m.Version)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	file := func(s string) *fstest.MapFile { return &fstest.MapFile{Data: []byte(s)} }
+
+	tests := []struct {
+		name    string
+		files   fstest.MapFS
+		wantErr string
+		want    []int
+	}{
+		{
+			name: "ordered",
+			files: fstest.MapFS{
+				"sql/0002_b.up.sql":   file("B"),
+				"sql/0002_b.down.sql": file("-B"),
+				"sql/0001_a.up.sql":   file("A"),
+				"sql/0001_a.down.sql": file("-A"),
+			},
+			want: []int{1, 2},
+		},
+		{
+			name:    "missing down",
+			files:   fstest.MapFS{"sql/0001_a.up.sql": file("A")},
+			wantErr: "needs both up and down",
+		},
+		{
+			name: "gap",
+			files: fstest.MapFS{
+				"sql/0001_a.up.sql":   file("A"),
+				"sql/0001_a.down.sql": file("-A"),
+				"sql/0003_c.up.sql":   file("C"),
+				"sql/0003_c.down.sql": file("-C"),
+			},
+			wantErr: "consecutive",
+		},
+		{
+			name:    "bad name",
+			files:   fstest.MapFS{"sql/create.sql": file("A")},
+			wantErr: "unexpected migration file",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := load(tt.files, "sql")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("expected %d migrations, got %+v", len(tt.want), got)
+			}
+			for i, v := range tt.want {
+				if got[i].Version != v {
+					t.Errorf("position %d: expected version %d, got %d", i, v, got[i].Version)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckVersion(t *testing.T) {
+	if err := checkVersion(2, 2); err != nil {
+		t.Errorf("same version: %v", err)
+	}
+	if err := checkVersion(1, 2); err != nil {
+		t.Errorf("older schema: %v", err)
+	}
+	if err := checkVersion(3, 2); !errors.Is(err, ErrSchemaTooNew) {
+		t.Errorf("expected ErrSchemaTooNew, got %v", err)
+	}
+}
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS ioc_query_log;
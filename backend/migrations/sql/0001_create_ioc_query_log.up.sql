@@ -0,0 +1,10 @@
+-- IF NOT EXISTS so databases created by the old db/init scripts adopt this migration
+CREATE TABLE IF NOT EXISTS ioc_query_log (
+    id           SERIAL PRIMARY KEY,
+    ioc          VARCHAR(255) NOT NULL,
+    last_lookup  TIMESTAMPTZ  DEFAULT now(),
+    result_count INT          NOT NULL,
+    user_name    VARCHAR(255)
+);
+
+CREATE INDEX IF NOT EXISTS ioc_query_log_ioc_last_lookup_idx ON ioc_query_log (ioc, last_lookup DESC);
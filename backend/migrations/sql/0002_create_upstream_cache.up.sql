@@ -0,0 +1,11 @@
+-- Last FAKEula response per source and normalized IOC, so repeat lookups
+-- during an incident don't hit every upstream endpoint again
+CREATE TABLE IF NOT EXISTS upstream_cache (
+    source     VARCHAR(64)  NOT NULL,
+    ioc        VARCHAR(255) NOT NULL,
+    response   JSONB        NOT NULL,
+    fetched_at TIMESTAMPTZ  NOT NULL DEFAULT now(),
+    PRIMARY KEY (source, ioc)
+);
+
+CREATE INDEX IF NOT EXISTS upstream_cache_fetched_at_idx ON upstream_cache (fetched_at);
@@ -0,0 +1,13 @@
+-- Full per-source results of each lookup, so an analyst can reopen exactly
+-- what was seen at the time and compare it with later lookups
+CREATE TABLE lookup_snapshots (
+    id         SERIAL       PRIMARY KEY,
+    log_id     INT          NOT NULL UNIQUE REFERENCES ioc_query_log (id) ON DELETE CASCADE,
+    ioc        VARCHAR(255) NOT NULL,
+    ioc_type   VARCHAR(32)  NOT NULL,
+    raw        JSONB        NOT NULL,
+    parsed     JSONB        NOT NULL,
+    created_at TIMESTAMPTZ  NOT NULL DEFAULT now()
+);
+
+CREATE INDEX lookup_snapshots_ioc_created_at_idx ON lookup_snapshots (ioc, created_at DESC);
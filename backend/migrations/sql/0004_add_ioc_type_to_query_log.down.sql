@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS ioc_query_log_user_name_idx;
+DROP INDEX IF EXISTS ioc_query_log_last_lookup_idx;
+ALTER TABLE ioc_query_log DROP COLUMN IF EXISTS ioc_type;
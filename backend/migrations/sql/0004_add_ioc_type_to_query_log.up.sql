@@ -0,0 +1,11 @@
+-- Lets /api/history filter by indicator type without joining snapshots.
+-- Rows logged before snapshots existed keep a NULL type.
+ALTER TABLE ioc_query_log ADD COLUMN ioc_type VARCHAR(32);
+
+UPDATE ioc_query_log l
+SET    ioc_type = s.ioc_type
+FROM   lookup_snapshots s
+WHERE  s.log_id = l.id;
+
+CREATE INDEX ioc_query_log_last_lookup_idx ON ioc_query_log (last_lookup DESC, id DESC);
+CREATE INDEX ioc_query_log_user_name_idx ON ioc_query_log (user_name);
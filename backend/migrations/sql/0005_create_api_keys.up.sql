@@ -0,0 +1,18 @@
+-- Non-interactive credentials for scripts and SOAR playbooks. Only a SHA-256 hash of
+-- each key is stored; the prefix identifies a key in listings and logs.
+CREATE TABLE api_keys (
+    id           SERIAL       PRIMARY KEY,
+    prefix       VARCHAR(32)  NOT NULL UNIQUE,
+    key_hash     CHAR(64)     NOT NULL UNIQUE,
+    owner        VARCHAR(255) NOT NULL,
+    description  TEXT         NOT NULL DEFAULT '',
+    role         VARCHAR(32)  NOT NULL,
+    scopes       TEXT[]       NOT NULL DEFAULT '{}',
+    created_by   VARCHAR(255) NOT NULL,
+    created_at   TIMESTAMPTZ  NOT NULL DEFAULT now(),
+    expires_at   TIMESTAMPTZ,
+    last_used_at TIMESTAMPTZ,
+    revoked_at   TIMESTAMPTZ
+);
+
+CREATE INDEX api_keys_owner_idx ON api_keys (owner);
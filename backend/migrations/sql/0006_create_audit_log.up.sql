@@ -0,0 +1,33 @@
+-- Append-only audit trail of API actions. Each record stores the hash of the one
+-- before it, so any edit, deletion or reordering breaks the chain (see package audit).
+CREATE TABLE audit_log (
+    id              BIGSERIAL    PRIMARY KEY,
+    created_at      TIMESTAMPTZ  NOT NULL,
+    actor           VARCHAR(255) NOT NULL,
+    auth_method     VARCHAR(32)  NOT NULL,
+    method          VARCHAR(16)  NOT NULL,
+    route           TEXT         NOT NULL,
+    status          INT          NOT NULL,
+    iocs            TEXT[]       NOT NULL DEFAULT '{}',
+    sources         TEXT[]       NOT NULL DEFAULT '{}',
+    client_ip       VARCHAR(64)  NOT NULL,
+    response_sha256 CHAR(64)     NOT NULL,
+    prev_hash       VARCHAR(64)  NOT NULL, -- empty for the first record
+    hash            CHAR(64)     NOT NULL UNIQUE
+);
+
+CREATE INDEX audit_log_actor_created_at_idx ON audit_log (actor, created_at DESC);
+
+CREATE FUNCTION audit_log_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_log_no_update_or_delete
+    BEFORE UPDATE OR DELETE ON audit_log
+    FOR EACH ROW EXECUTE FUNCTION audit_log_append_only();
+
+CREATE TRIGGER audit_log_no_truncate
+    BEFORE TRUNCATE ON audit_log
+    FOR EACH STATEMENT EXECUTE FUNCTION audit_log_append_only();
@@ -0,0 +1,3 @@
+-- Every record links to a different predecessor, so two appends that read the same
+-- chain head can't both be stored; the loser retries on the new head (see models.AppendAudit)
+CREATE UNIQUE INDEX audit_log_prev_hash_idx ON audit_log (prev_hash);
@@ -0,0 +1,110 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// APIKey is a stored API key. The key itself is never stored, only its hash.
+type APIKey struct {
+	ID          int        `json:"id"`
+	Prefix      string     `json:"prefix"`
+	Owner       string     `json:"owner"`
+	Description string     `json:"description"`
+	Role        string     `json:"role"`
+	Scopes      []string   `json:"scopes"`
+	CreatedBy   string     `json:"created_by"`
+	CreatedAt   time.Time  `json:"created_at"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+	LastUsedAt  *time.Time `json:"last_used_at"`
+	RevokedAt   *time.Time `json:"revoked_at"`
+}
+
+const apiKeyColumns = `id, prefix, owner, description, role, scopes, created_by, created_at, expires_at, last_used_at, revoked_at`
+
+func scanAPIKey(row interface{ Scan(...interface{}) error }) (*APIKey, error) {
+	var k APIKey
+	err := row.Scan(&k.ID, &k.Prefix, &k.Owner, &k.Description, &k.Role, pq.Array(&k.Scopes),
+		&k.CreatedBy, &k.CreatedAt, &k.ExpiresAt, &k.LastUsedAt, &k.RevokedAt)
+	if err != nil {
+		return nil, err
+	}
+	if k.Scopes == nil {
+		k.Scopes = []string{}
+	}
+	return &k, nil
+}
+
+// CreateAPIKey stores k under hash and fills in its ID and creation time
+func CreateAPIKey(ctx context.Context, k *APIKey, hash string) error {
+	const stmt = `
+		INSERT INTO api_keys (prefix, key_hash, owner, description, role, scopes, created_by, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id, created_at;
+	`
+	err := db.QueryRowContext(ctx, stmt, k.Prefix, hash, k.Owner, k.Description, k.Role,
+		pq.Array(k.Scopes), k.CreatedBy, k.ExpiresAt).Scan(&k.ID, &k.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("insert api key: %w", err)
+	}
+	return nil
+}
+
+// UseAPIKey returns the active (unrevoked, unexpired) key with hash and records that it
+// was used. It returns nil if there is no such key.
+func UseAPIKey(ctx context.Context, hash string) (*APIKey, error) {
+	const stmt = `
+		UPDATE api_keys
+		SET    last_used_at = now()
+		WHERE  key_hash = $1
+		  AND  revoked_at IS NULL
+		  AND  (expires_at IS NULL OR expires_at > now())
+		RETURNING ` + apiKeyColumns + `;
+	`
+	k, err := scanAPIKey(db.QueryRowContext(ctx, stmt, hash))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("use api key: %w", err)
+	}
+	return k, nil
+}
+
+// ListAPIKeys returns every key, newest first
+func ListAPIKeys(ctx context.Context) ([]APIKey, error) {
+	rows, err := db.QueryContext(ctx, `SELECT `+apiKeyColumns+` FROM api_keys ORDER BY id DESC;`)
+	if err != nil {
+		return nil, fmt.Errorf("select api keys: %w", err)
+	}
+	defer rows.Close()
+
+	keys := []APIKey{}
+	for rows.Next() {
+		k, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan api key: %w", err)
+		}
+		keys = append(keys, *k)
+	}
+	return keys, rows.Err()
+}
+
+// RevokeAPIKey revokes the key with id. It reports false if there is no such unrevoked key.
+func RevokeAPIKey(ctx context.Context, id int) (bool, error) {
+	const stmt = `UPDATE api_keys SET revoked_at = now() WHERE id = $1 AND revoked_at IS NULL;`
+	res, err := db.ExecContext(ctx, stmt, id)
+	if err != nil {
+		return false, fmt.Errorf("revoke api key: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("revoke api key: %w", err)
+	}
+	return n > 0, nil
+}
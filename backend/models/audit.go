@@ -0,0 +1,113 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// AuditRecord is one API action in the audit_log hash chain
+type AuditRecord struct {
+	ID             int64     `json:"id"`
+	CreatedAt      time.Time `json:"created_at"`
+	Actor          string    `json:"actor"`
+	AuthMethod     string    `json:"auth_method"`
+	Method         string    `json:"method"`
+	Route          string    `json:"route"`
+	Status         int       `json:"status"`
+	IOCs           []string  `json:"iocs"`
+	Sources        []string  `json:"sources"`
+	ClientIP       string    `json:"client_ip"`
+	ResponseSHA256 string    `json:"response_sha256"`
+	PrevHash       string    `json:"prev_hash"`
+	Hash           string    `json:"hash"`
+}
+
+// auditAppendAttempts bounds how often an append is retried after losing a race for the chain head
+const auditAppendAttempts = 5
+
+// AppendAudit links rec to the latest record and inserts it. Within one transaction it
+// sets rec.PrevHash to the latest hash and calls seal, which must set rec.Hash.
+//
+// Only the chain head, the latest record, is locked, and only for the length of the
+// insert. An append that waited for the head still reads the old head once the other
+// append commits, and the first append has no head to lock; in both cases the unique
+// prev_hash index refuses the forked record and the append is retried on the new head.
+func AppendAudit(ctx context.Context, rec *AuditRecord, seal func(rec *AuditRecord)) error {
+	var err error
+	for attempt := 0; attempt < auditAppendAttempts; attempt++ {
+		if err = appendAudit(ctx, rec, seal); !isForkedChain(err) {
+			return err
+		}
+	}
+	return err
+}
+
+func appendAudit(ctx context.Context, rec *AuditRecord, seal func(rec *AuditRecord)) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin audit append: %w", err)
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, `SELECT hash FROM audit_log ORDER BY id DESC LIMIT 1 FOR UPDATE;`).Scan(&rec.PrevHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		rec.PrevHash = ""
+	} else if err != nil {
+		return fmt.Errorf("select latest audit hash: %w", err)
+	}
+	seal(rec)
+
+	const stmt = `
+		INSERT INTO audit_log (created_at, actor, auth_method, method, route, status, iocs, sources,
+		                       client_ip, response_sha256, prev_hash, hash)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		RETURNING id;
+	`
+	err = tx.QueryRowContext(ctx, stmt, rec.CreatedAt, rec.Actor, rec.AuthMethod, rec.Method, rec.Route,
+		rec.Status, pq.Array(rec.IOCs), pq.Array(rec.Sources), rec.ClientIP, rec.ResponseSHA256,
+		rec.PrevHash, rec.Hash).Scan(&rec.ID)
+	if err != nil {
+		return fmt.Errorf("insert audit record: %w", err)
+	}
+	return tx.Commit()
+}
+
+// isForkedChain reports whether err is another append having taken the same chain head
+func isForkedChain(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == "audit_log_prev_hash_idx"
+}
+
+// AuditRecords returns up to limit records with an id above afterID, oldest first
+func AuditRecords(ctx context.Context, afterID int64, limit int) ([]AuditRecord, error) {
+	const stmt = `
+		SELECT id, created_at, actor, auth_method, method, route, status, iocs, sources,
+		       client_ip, response_sha256, prev_hash, hash
+		FROM   audit_log
+		WHERE  id > $1
+		ORDER  BY id
+		LIMIT  $2;
+	`
+	rows, err := db.QueryContext(ctx, stmt, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("select audit records: %w", err)
+	}
+	defer rows.Close()
+
+	var records []AuditRecord
+	for rows.Next() {
+		var r AuditRecord
+		err := rows.Scan(&r.ID, &r.CreatedAt, &r.Actor, &r.AuthMethod, &r.Method, &r.Route, &r.Status,
+			pq.Array(&r.IOCs), pq.Array(&r.Sources), &r.ClientIP, &r.ResponseSHA256, &r.PrevHash, &r.Hash)
+		if err != nil {
+			return nil, fmt.Errorf("scan audit record: %w", err)
+		}
+		records = append(records, r)
+	}
+	return records, rows.Err()
+}
@@ -0,0 +1,203 @@
+package models
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Columns the history can be sorted by. Every sort breaks ties on id, which also makes
+// the cursor unambiguous.
+var historySortColumns = map[string]struct {
+	expr string // SQL expression sorted on
+	cast string // type the cursor value is cast to
+}{
+	"last_lookup":  {"last_lookup", "timestamptz"},
+	"result_count": {"result_count", "int"},
+	"ioc":          {"ioc", "text"},
+	"user_name":    {"COALESCE(user_name, '')", "text"},
+}
+
+// Page size limits for QueryHistory
+const (
+	DefaultHistoryLimit = 50
+	MaxHistoryLimit     = 500
+)
+
+// ErrInvalidCursor is returned when a cursor is malformed or belongs to a different sort
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// HistoryFilter selects and orders ioc_query_log rows. Zero values mean "no filter".
+type HistoryFilter struct {
+	User        string     // exact user name
+	IOCContains string     // case-insensitive substring of the IOC
+	IOCType     string     // indicator type, e.g. "ipv4"
+	From        *time.Time // last_lookup >= From
+	To          *time.Time // last_lookup < To
+	MinResults  *int       // result_count >= MinResults
+
+	Sort      string // one of the history sort columns, default last_lookup
+	Ascending bool   // default is newest / largest first
+	Limit     int    // page size, default DefaultHistoryLimit
+	Cursor    string // NextCursor from the previous page
+}
+
+// HistoryPage is one page of history. NextCursor is empty on the last page.
+type HistoryPage struct {
+	Data       []QueryLog `json:"data"`
+	NextCursor string     `json:"next_cursor"`
+}
+
+// historyCursor is the position after the last row of a page
+type historyCursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	ID    int    `json:"id"`
+}
+
+// ValidHistorySort reports whether sort can be used in HistoryFilter.Sort
+func ValidHistorySort(sort string) bool {
+	_, ok := historySortColumns[sort]
+	return ok
+}
+
+// QueryHistory returns one page of query history matching f
+func QueryHistory(ctx context.Context, f HistoryFilter) (*HistoryPage, error) {
+	stmt, args, err := buildHistoryQuery(f)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.QueryContext(ctx, stmt, args...)
+	if err != nil {
+		return nil, fmt.Errorf("select history: %w", err)
+	}
+	defer rows.Close()
+
+	page := &HistoryPage{Data: []QueryLog{}}
+	for rows.Next() {
+		var q QueryLog
+		if err := rows.Scan(&q.LogID, &q.IOC, &q.LastLookup, &q.ResultCount, &q.UserName, &q.IOCType); err != nil {
+			return nil, fmt.Errorf("scan history row: %w", err)
+		}
+		page.Data = append(page.Data, q)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("read history: %w", err)
+	}
+
+	// One extra row was requested to find out whether another page exists
+	if limit := historyLimit(f.Limit); len(page.Data) > limit {
+		page.Data = page.Data[:limit]
+		page.NextCursor = encodeCursor(historySort(f.Sort), page.Data[limit-1])
+	}
+	return page, nil
+}
+
+// buildHistoryQuery turns a filter into SQL and its arguments
+func buildHistoryQuery(f HistoryFilter) (string, []interface{}, error) {
+	sort := historySort(f.Sort)
+	col, ok := historySortColumns[sort]
+	if !ok {
+		return "", nil, fmt.Errorf("unknown sort column %q", f.Sort)
+	}
+
+	var where []string
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	if f.User != "" {
+		where = append(where, "user_name = "+arg(f.User))
+	}
+	if f.IOCContains != "" {
+		where = append(where, "ioc ILIKE "+arg("%"+escapeLike(f.IOCContains)+"%"))
+	}
+	if f.IOCType != "" {
+		where = append(where, "ioc_type = "+arg(f.IOCType))
+	}
+	if f.From != nil {
+		where = append(where, "last_lookup >= "+arg(*f.From))
+	}
+	if f.To != nil {
+		where = append(where, "last_lookup < "+arg(*f.To))
+	}
+	if f.MinResults != nil {
+		where = append(where, "result_count >= "+arg(*f.MinResults))
+	}
+
+	dir, cmp := "DESC", "<"
+	if f.Ascending {
+		dir, cmp = "ASC", ">"
+	}
+	if f.Cursor != "" {
+		c, err := decodeCursor(f.Cursor)
+		if err != nil || c.Sort != sort {
+			return "", nil, ErrInvalidCursor
+		}
+		where = append(where, fmt.Sprintf("(%s, id) %s (%s::%s, %s)", col.expr, cmp, arg(c.Value), col.cast, arg(c.ID)))
+	}
+
+	var b strings.Builder
+	b.WriteString("SELECT id, ioc, last_lookup, result_count, COALESCE(user_name, ''), COALESCE(ioc_type, '') FROM ioc_query_log")
+	if len(where) > 0 {
+		b.WriteString(" WHERE " + strings.Join(where, " AND "))
+	}
+	fmt.Fprintf(&b, " ORDER BY %s %s, id %s LIMIT %s", col.expr, dir, dir, arg(historyLimit(f.Limit)+1))
+	return b.String(), args, nil
+}
+
+func historySort(sort string) string {
+	if sort == "" {
+		return "last_lookup"
+	}
+	return sort
+}
+
+func historyLimit(limit int) int {
+	if limit <= 0 {
+		return DefaultHistoryLimit
+	}
+	if limit > MaxHistoryLimit {
+		return MaxHistoryLimit
+	}
+	return limit
+}
+
+// escapeLike stops user input from being read as LIKE wildcards
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+func encodeCursor(sort string, last QueryLog) string {
+	c := historyCursor{Sort: sort, ID: last.LogID}
+	switch sort {
+	case "last_lookup":
+		c.Value = last.LastLookup.Format(time.RFC3339Nano)
+	case "result_count":
+		c.Value = strconv.Itoa(last.ResultCount)
+	case "ioc":
+		c.Value = last.IOC
+	case "user_name":
+		c.Value = last.UserName
+	}
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(s string) (historyCursor, error) {
+	var c historyCursor
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, err
+	}
+	err = json.Unmarshal(b, &c)
+	return c, err
+}
@@ -0,0 +1,76 @@
+package models
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuildHistoryQuery(t *testing.T) {
+	from := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	minResults := 3
+	stmt, args, err := buildHistoryQuery(HistoryFilter{
+		User:        "alice",
+		IOCContains: "100%_evil",
+		IOCType:     "domain",
+		From:        &from,
+		MinResults:  &minResults,
+		Sort:        "result_count",
+		Ascending:   true,
+		Limit:       10,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{
+		"user_name = $1",
+		"ioc ILIKE $2",
+		"ioc_type = $3",
+		"last_lookup >= $4",
+		"result_count >= $5",
+		"ORDER BY result_count ASC, id ASC LIMIT $6",
+	} {
+		if !strings.Contains(stmt, want) {
+			t.Errorf("expected %q in %s", want, stmt)
+		}
+	}
+	if args[1] != `%100\%\_evil%` {
+		t.Errorf("expected LIKE wildcards to be escaped, got %v", args[1])
+	}
+	if args[5] != 11 {
+		t.Errorf("expected one extra row to be requested, got limit %v", args[5])
+	}
+}
+
+func TestBuildHistoryQuery_Cursor(t *testing.T) {
+	last := QueryLog{LogID: 42, LastLookup: time.Date(2026, 3, 1, 12, 0, 0, 123000, time.UTC)}
+	cursor := encodeCursor("last_lookup", last)
+
+	stmt, args, err := buildHistoryQuery(HistoryFilter{Cursor: cursor})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(stmt, "(last_lookup, id) < ($1::timestamptz, $2)") {
+		t.Errorf("unexpected keyset condition in %s", stmt)
+	}
+	if args[0] != "2026-03-01T12:00:00.000123Z" || args[1] != 42 {
+		t.Errorf("unexpected cursor args %v", args)
+	}
+
+	// A cursor from one sort order can't be reused for another
+	if _, _, err := buildHistoryQuery(HistoryFilter{Cursor: cursor, Sort: "ioc"}); err != ErrInvalidCursor {
+		t.Errorf("expected ErrInvalidCursor, got %v", err)
+	}
+	if _, _, err := buildHistoryQuery(HistoryFilter{Cursor: "not-a-cursor"}); err != ErrInvalidCursor {
+		t.Errorf("expected ErrInvalidCursor, got %v", err)
+	}
+}
+
+func TestHistoryLimit(t *testing.T) {
+	for in, want := range map[int]int{0: DefaultHistoryLimit, -5: DefaultHistoryLimit, 20: 20, 10000: MaxHistoryLimit} {
+		if got := historyLimit(in); got != want {
+			t.Errorf("historyLimit(%d) = %d, want %d", in, got, want)
+		}
+	}
+}
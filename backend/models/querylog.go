@@ -1,13 +1,18 @@
 package models
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
-	"log"
-	"os"
+	"log/slog"
 	"time"
 
+	"github.com/0x-Singularity/Augury/config"
+	"github.com/0x-Singularity/Augury/identity"
 	_ "github.com/lib/pq"
+	"github.com/uptrace/opentelemetry-go-extra/otelsql"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
 )
 
 // QueryLog represents a lookup log entry
@@ -17,48 +22,63 @@ type QueryLog struct {
 	LastLookup  time.Time `json:"last_lookup"`
 	ResultCount int       `json:"result_count"`
 	UserName    string    `json:"user_name"`
+	IOCType     string    `json:"ioc_type,omitempty"`
 }
 
 var db *sql.DB
 
-// ConnectDB initializes the PostgreSQL connection
-func ConnectDB() error {
-	host := os.Getenv("DB_HOST")
-	port := os.Getenv("DB_PORT")
-	user := os.Getenv("DB_USER")
-	password := os.Getenv("DB_PASS")
-	dbname := os.Getenv("DB_NAME")
-
-	dsn := fmt.Sprintf(
-		"host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
-		host, port, user, password, dbname,
-	)
-
+// ConnectDB opens the PostgreSQL connection pool described by cfg. Every statement run
+// through it is traced as a span of the request in its context.
+func ConnectDB(cfg config.Database) error {
 	var err error
-	db, err = sql.Open("postgres", dsn)
+	db, err = otelsql.Open("postgres", cfg.DSN(),
+		otelsql.WithAttributes(semconv.DBSystemPostgreSQL),
+		otelsql.WithDBName(cfg.Name),
+	)
 	if err != nil {
 		return fmt.Errorf("open db: %w", err)
 	}
 	//pool tuning
-	db.SetMaxOpenConns(20)                  // total connections allowed (0 = unlimited)
-	db.SetMaxIdleConns(10)                  // idle (kept‑alive) connections
-	db.SetConnMaxIdleTime(30 * time.Minute) // recycle idle conns after 30 min
-	db.SetConnMaxLifetime(2 * time.Hour)
+	db.SetMaxOpenConns(cfg.MaxOpenConns)       // total connections allowed
+	db.SetMaxIdleConns(cfg.MaxIdleConns)       // idle (kept‑alive) connections
+	db.SetConnMaxIdleTime(cfg.ConnMaxIdleTime) // recycle idle conns
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
 	if err = db.Ping(); err != nil {
 		return fmt.Errorf("ping db: %w", err)
 	}
 
-	log.Println("Connected to PostgreSQL successfully!")
+	slog.Info("Connected to PostgreSQL")
 	return nil
 }
 
-// InsertQueryLog adds a new IOC lookup record
-func InsertQueryLog(ioc string, resultCount int, userName string) error {
+// CloseDB closes the connection pool once every query using it has finished
+func CloseDB() error {
+	if db == nil {
+		return nil
+	}
+	return db.Close()
+}
+
+// DB returns the connection pool opened by ConnectDB
+func DB() *sql.DB {
+	return db
+}
+
+// PingDB checks that the pool can reach the database
+func PingDB(ctx context.Context) error {
+	if db == nil {
+		return errors.New("database not connected")
+	}
+	return db.PingContext(ctx)
+}
+
+// InsertQueryLog adds a new IOC lookup record for the user in ctx
+func InsertQueryLog(ctx context.Context, ioc string, resultCount int, iocType string) error {
 	const stmt = `
-		INSERT INTO ioc_query_log (ioc, last_lookup, result_count, user_name)
-		VALUES ($1, now(), $2, $3);
+		INSERT INTO ioc_query_log (ioc, last_lookup, result_count, user_name, ioc_type)
+		VALUES ($1, now(), $2, $3, NULLIF($4, ''));
 	`
-	_, err := db.Exec(stmt, ioc, resultCount, userName)
+	_, err := db.ExecContext(ctx, stmt, ioc, resultCount, identity.UserName(ctx), iocType)
 	if err != nil {
 		return fmt.Errorf("insert query log: %w", err)
 	}
@@ -66,9 +86,9 @@ func InsertQueryLog(ioc string, resultCount int, userName string) error {
 }
 
 // GetQueryLog returns the most‑recent previous log for an IOC
-func GetQueryLog(ioc string) ([]QueryLog, error) {
+func GetQueryLog(ctx context.Context, ioc string) ([]QueryLog, error) {
 	const stmt = `
-		SELECT id, ioc, last_lookup, result_count, user_name
+		SELECT id, ioc, last_lookup, result_count, COALESCE(user_name, ''), COALESCE(ioc_type, '')
 		FROM   ioc_query_log
 		WHERE  ioc = $1
 		ORDER  BY last_lookup DESC
@@ -76,7 +96,7 @@ func GetQueryLog(ioc string) ([]QueryLog, error) {
 		LIMIT  1;          -- return the previous
 	`
 
-	rows, err := db.Query(stmt, ioc)
+	rows, err := db.QueryContext(ctx, stmt, ioc)
 	if err != nil {
 		return nil, fmt.Errorf("select logs: %w", err)
 	}
@@ -85,7 +105,7 @@ func GetQueryLog(ioc string) ([]QueryLog, error) {
 	var logs []QueryLog
 	for rows.Next() {
 		var q QueryLog
-		if err := rows.Scan(&q.LogID, &q.IOC, &q.LastLookup, &q.ResultCount, &q.UserName); err != nil {
+		if err := rows.Scan(&q.LogID, &q.IOC, &q.LastLookup, &q.ResultCount, &q.UserName, &q.IOCType); err != nil {
 			return nil, fmt.Errorf("scan row: %w", err)
 		}
 		logs = append(logs, q)
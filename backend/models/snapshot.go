@@ -0,0 +1,98 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/0x-Singularity/Augury/identity"
+	"github.com/lib/pq"
+)
+
+// Snapshot is the full result of one lookup: raw and parsed FAKEula data per source
+type Snapshot struct {
+	ID        int             `json:"id"`
+	LogID     int             `json:"log_id"`
+	IOC       string          `json:"ioc"`
+	IOCType   string          `json:"ioc_type"`
+	Raw       json.RawMessage `json:"raw"`
+	Parsed    json.RawMessage `json:"parsed"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// RecordLookup logs a lookup by the user in ctx and stores its snapshot in one transaction,
+// returning the log ID
+func RecordLookup(ctx context.Context, ioc string, resultCount int, iocType string, raw, parsed json.RawMessage) (int, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("begin lookup: %w", err)
+	}
+	defer tx.Rollback()
+
+	const logStmt = `
+		INSERT INTO ioc_query_log (ioc, last_lookup, result_count, user_name, ioc_type)
+		VALUES ($1, now(), $2, $3, $4)
+		RETURNING id;
+	`
+	var logID int
+	if err := tx.QueryRowContext(ctx, logStmt, ioc, resultCount, identity.UserName(ctx), iocType).Scan(&logID); err != nil {
+		return 0, fmt.Errorf("insert query log: %w", err)
+	}
+
+	const snapshotStmt = `
+		INSERT INTO lookup_snapshots (log_id, ioc, ioc_type, raw, parsed)
+		VALUES ($1, $2, $3, $4, $5);
+	`
+	if _, err := tx.ExecContext(ctx, snapshotStmt, logID, ioc, iocType, []byte(raw), []byte(parsed)); err != nil {
+		return 0, fmt.Errorf("insert snapshot: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("commit lookup: %w", err)
+	}
+	return logID, nil
+}
+
+// GetSnapshot returns the snapshot stored for a query log entry, or nil if there is none
+func GetSnapshot(ctx context.Context, logID int) (*Snapshot, error) {
+	const stmt = `
+		SELECT id, log_id, ioc, ioc_type, raw, parsed, created_at
+		FROM   lookup_snapshots
+		WHERE  log_id = $1;
+	`
+	var s Snapshot
+	err := db.QueryRowContext(ctx, stmt, logID).Scan(&s.ID, &s.LogID, &s.IOC, &s.IOCType, &s.Raw, &s.Parsed, &s.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("select snapshot: %w", err)
+	}
+	return &s, nil
+}
+
+// PreviousSnapshot returns the newest snapshot of ioc taken before the lookup logID, or the
+// newest snapshot overall when logID is 0, that holds results from any of sources. Without
+// sources any snapshot will do. It returns nil if there is none.
+func PreviousSnapshot(ctx context.Context, ioc string, logID int, sources []string) (*Snapshot, error) {
+	const stmt = `
+		SELECT id, log_id, ioc, ioc_type, raw, parsed, created_at
+		FROM   lookup_snapshots
+		WHERE  ioc = $1 AND ($2 = 0 OR log_id < $2)
+		  AND  (coalesce(cardinality($3::text[]), 0) = 0 OR parsed ?| $3::text[])
+		ORDER  BY log_id DESC
+		LIMIT  1;
+	`
+	var s Snapshot
+	err := db.QueryRowContext(ctx, stmt, ioc, logID, pq.Array(sources)).Scan(&s.ID, &s.LogID, &s.IOC, &s.IOCType, &s.Raw, &s.Parsed, &s.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("select previous snapshot: %w", err)
+	}
+	return &s, nil
+}
@@ -0,0 +1,84 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// CachedResponse is a stored FAKEula response for one source and IOC
+type CachedResponse struct {
+	Source    string          `json:"source"`
+	IOC       string          `json:"ioc"`
+	Response  json.RawMessage `json:"response"`
+	FetchedAt time.Time       `json:"fetched_at"`
+}
+
+// GetCachedResponse returns the stored response for source and ioc, or nil if there is none
+func GetCachedResponse(ctx context.Context, source, ioc string) (*CachedResponse, error) {
+	const stmt = `
+		SELECT source, ioc, response, fetched_at
+		FROM   upstream_cache
+		WHERE  source = $1 AND ioc = $2;
+	`
+	var c CachedResponse
+	err := db.QueryRowContext(ctx, stmt, source, ioc).Scan(&c.Source, &c.IOC, &c.Response, &c.FetchedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("select cached response: %w", err)
+	}
+	return &c, nil
+}
+
+// PutCachedResponse stores (or replaces) the response for source and ioc. fetchedAt comes
+// from the app's clock, which is the one its age is checked against.
+func PutCachedResponse(ctx context.Context, source, ioc string, response json.RawMessage, fetchedAt time.Time) error {
+	const stmt = `
+		INSERT INTO upstream_cache (source, ioc, response, fetched_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (source, ioc)
+		DO UPDATE SET response = EXCLUDED.response, fetched_at = EXCLUDED.fetched_at;
+	`
+	if _, err := db.ExecContext(ctx, stmt, source, ioc, []byte(response), fetchedAt); err != nil {
+		return fmt.Errorf("upsert cached response: %w", err)
+	}
+	return nil
+}
+
+// PurgeCachedResponses deletes every response of each cached source fetched before
+// expiredBefore(source) and returns how many it deleted
+func PurgeCachedResponses(ctx context.Context, expiredBefore func(source string) time.Time) (int64, error) {
+	rows, err := db.QueryContext(ctx, `SELECT DISTINCT source FROM upstream_cache;`)
+	if err != nil {
+		return 0, fmt.Errorf("select cached sources: %w", err)
+	}
+	var sources []string
+	for rows.Next() {
+		var source string
+		if err := rows.Scan(&source); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("scan cached source: %w", err)
+		}
+		sources = append(sources, source)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("select cached sources: %w", err)
+	}
+
+	var purged int64
+	for _, source := range sources {
+		res, err := db.ExecContext(ctx, `DELETE FROM upstream_cache WHERE source = $1 AND fetched_at < $2;`, source, expiredBefore(source))
+		if err != nil {
+			return purged, fmt.Errorf("purge cached responses: %w", err)
+		}
+		n, _ := res.RowsAffected()
+		purged += n
+	}
+	return purged, nil
+}
@@ -3,7 +3,10 @@ package parser
 import (
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
+	"sync"
+
+	"github.com/0x-Singularity/Augury/cache"
 )
 
 // MultiLevelMap is the data structure to store parsed FAKEula data.
@@ -13,10 +16,6 @@ import (
 // - Value: Slice of FakeulaEntry structs containing the actual data
 type MultiLevelMap map[string]map[string][]FakeulaEntry
 
-// ResultsCache defines a map type that stores parsed FAKEula responses for reuse
-// Key is the stringified JSON data, Value is the parsed MultiLevelMap
-type ResultsCache map[string]MultiLevelMap
-
 //---------------------------Structs to represent different endpoint results from a FAKEula query-------------------------------------------------------------
 
 // FakeulaEntry represents a parsed Fakeula response entry.
@@ -202,12 +201,48 @@ type ParsedFakeulaResult struct {
 
 //--------------------Functions to parse and format the FAKEula response---------------------------------------------------------------------
 
-// Global cache variable to store parsed results to avoid re-parsing
-var resultsCache = make(ResultsCache)
+// resultsCache stores parsed results to avoid re-parsing identical FAKEula payloads.
+// Keys are SHA-256 hashes of the marshalled "data" array. It uses the cache package's
+// defaults until ConfigureCache sizes it.
+var (
+	resultsCacheMu sync.Mutex
+	resultsCache   *cache.Cache[MultiLevelMap]
+)
 
-// FormatFakeulaResponse parses and organizes the FAKEula response
+func parsedCache() *cache.Cache[MultiLevelMap] {
+	resultsCacheMu.Lock()
+	defer resultsCacheMu.Unlock()
+	if resultsCache == nil {
+		resultsCache = cache.New[MultiLevelMap](cache.Options{})
+	}
+	return resultsCache
+}
+
+// ConfigureCache replaces the parsed results cache with an empty one sized by opts.
+// Call it at startup, before serving.
+func ConfigureCache(opts cache.Options) {
+	resultsCacheMu.Lock()
+	resultsCache = cache.New[MultiLevelMap](opts)
+	resultsCacheMu.Unlock()
+}
 
+// CacheStats reports hit/miss statistics for the parsed results cache
+func CacheStats() cache.Stats {
+	return parsedCache().Stats()
+}
+
+// FormatFakeulaResponse parses and organizes the FAKEula response.
+// Results are cached by payload, so the returned map may be shared and must not be modified.
 func FormatFakeulaResponse(response map[string]interface{}) ParsedFakeulaResult {
+	// Reuse an earlier parse of the same payload when there is one
+	cacheKey := ""
+	if raw, err := json.Marshal(response["data"]); err == nil {
+		cacheKey = cache.Key(raw)
+		if parsedData, ok := parsedCache().Get(cacheKey); ok {
+			return ParsedFakeulaResult{Data: parsedData}
+		}
+	}
+
 	var parsedData = make(MultiLevelMap)
 
 	// Check if "data" field exists in response
@@ -256,14 +291,10 @@ func FormatFakeulaResponse(response map[string]interface{}) ParsedFakeulaResult
 		}
 	}
 
-	// Store the parsed data in the cache using the original data as the key
-	cacheKey, err := json.Marshal(response["data"])
-	if err == nil {
-		resultsCache[string(cacheKey)] = parsedData
+	// Store the parsed data in the cache under the hash of the original data
+	if cacheKey != "" {
+		parsedCache().Set(cacheKey, parsedData)
 	}
-	// Print cache for debugging
-	//fmt.Println("=== Cached response added ===")
-	//PrintResultsCache()
 
 	return ParsedFakeulaResult{
 		Data: parsedData,
@@ -500,8 +531,7 @@ func parseClient(entryMap map[string]interface{}) *ClientInfo {
 
 // Process (base CBR response)
 func parseProcess(entryMap map[string]interface{}) *ProcessInfo {
-	log.Println("Parsing process info")
-	log.Println(entryMap)
+	slog.Debug("Parsing process info", "entry", entryMap)
 	if processMap, ok := entryMap["process"].(map[string]interface{}); ok {
 		process := &ProcessInfo{
 			CommandLine: getString(processMap, "command_line"),
@@ -925,11 +955,8 @@ func getInt(data map[string]interface{}, key string) int {
 	return 0
 }
 
-// Print results cache for debugging
+// Log the results cache keys and stats at debug level
 func PrintResultsCache() {
-	fmt.Println("=== Printing resultsCache ===")
-	for key, value := range resultsCache {
-		fmt.Printf("Key: %s\nValue: %+v\n\n", key, value)
-	}
-	fmt.Println("=== End of resultsCache ===")
+	c := parsedCache()
+	slog.Debug("Parsed results cache", "keys", c.Keys(), "stats", c.Stats())
 }
@@ -3,6 +3,7 @@ package parser
 import (
 	"encoding/json"
 	"fmt"
+	"sync"
 	"testing"
 )
 
@@ -464,3 +465,40 @@ func prettyPrint(label string, v interface{}) {
 	}
 	fmt.Printf("%s:\n%s\n", label, string(bytes))
 }
+
+func TestFormatFakeulaResponse_Cached(t *testing.T) {
+	response := map[string]interface{}{
+		"data": []interface{}{
+			map[string]interface{}{
+				"geo":  map[string]interface{}{"country_iso_code": "NZ"},
+				"host": map[string]interface{}{"ip": []interface{}{"203.0.113.9"}},
+			},
+		},
+	}
+
+	before := CacheStats()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result := FormatFakeulaResponse(response)
+			if geo := result.Data["geo"]["geo"]; len(geo) != 1 || geo[0].Geo.IP != "203.0.113.9" {
+				t.Errorf("unexpected parse result %+v", result.Data)
+			}
+		}()
+	}
+	wg.Wait()
+
+	after := CacheStats()
+	if lookups := (after.Hits + after.Misses) - (before.Hits + before.Misses); lookups != 8 {
+		t.Errorf("expected 8 cache lookups, got %d", lookups)
+	}
+	if after.Hits == before.Hits {
+		// every goroutine may have raced past the first Set, so check reuse sequentially too
+		FormatFakeulaResponse(response)
+		if CacheStats().Hits == after.Hits {
+			t.Error("expected a repeated payload to be served from the cache")
+		}
+	}
+}
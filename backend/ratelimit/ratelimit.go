@@ -0,0 +1,302 @@
+// Package ratelimit provides keyed token buckets: one bucket per client IP and one per user
+// or API key for incoming API requests, and one per FAKEula source for outgoing calls (see
+// package fakeula).
+//
+// Limits are written as RATE/UNIT[:BURST], e.g. "5/s:20" (5 per second, bursts of 20)
+// or "300/m". "off" disables a limit.
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/0x-Singularity/Augury/identity"
+	"golang.org/x/time/rate"
+)
+
+// Limit is a token bucket's refill rate and size
+type Limit struct {
+	Rate  rate.Limit // tokens per second
+	Burst int
+}
+
+// Unlimited never limits
+var Unlimited = Limit{Rate: rate.Inf}
+
+// ParseLimit reads a limit written as RATE/UNIT[:BURST]. UNIT is s, m or h and defaults
+// to s; BURST defaults to one second's worth of tokens (at least 1).
+func ParseLimit(s string) (Limit, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "off" || s == "none" {
+		return Unlimited, nil
+	}
+
+	spec, burstSpec, hasBurst := strings.Cut(s, ":")
+	count, unit, _ := strings.Cut(spec, "/")
+	n, err := strconv.ParseFloat(count, 64)
+	if err != nil || n <= 0 {
+		return Limit{}, fmt.Errorf("invalid rate limit %q: want RATE/UNIT[:BURST] such as 5/s:20", s)
+	}
+	per := time.Second
+	switch unit {
+	case "", "s":
+	case "m":
+		per = time.Minute
+	case "h":
+		per = time.Hour
+	default:
+		return Limit{}, fmt.Errorf("invalid rate limit %q: unit must be s, m or h", s)
+	}
+
+	l := Limit{Rate: rate.Limit(n / per.Seconds())}
+	l.Burst = int(math.Max(1, math.Ceil(float64(l.Rate))))
+	if hasBurst {
+		if l.Burst, err = strconv.Atoi(burstSpec); err != nil || l.Burst <= 0 {
+			return Limit{}, fmt.Errorf("invalid rate limit %q: burst must be a positive number", s)
+		}
+	}
+	return l, nil
+}
+
+// String formats l the way ParseLimit reads it
+func (l Limit) String() string {
+	if l.Rate == rate.Inf {
+		return "off"
+	}
+	return strconv.FormatFloat(float64(l.Rate), 'f', -1, 64) + "/s:" + strconv.Itoa(l.Burst)
+}
+
+// Error is returned when a call would exceed its limit
+type Error struct {
+	Key        string
+	RetryAfter time.Duration
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("rate limit exceeded for %s, retry after %s", e.Key, e.RetryAfter.Round(time.Second))
+}
+
+// TooLargeError is returned when a request costs more tokens than its bucket holds, so no
+// amount of waiting would let it through
+type TooLargeError struct {
+	Key   string
+	Cost  int
+	Burst int
+}
+
+func (e *TooLargeError) Error() string {
+	return fmt.Sprintf("request for %s costs %d tokens, more than the %d its bucket holds", e.Key, e.Cost, e.Burst)
+}
+
+// idleAfter is how long an unused bucket is kept. A bucket idle that long is full
+// again for any sensible limit, so forgetting it changes nothing.
+const idleAfter = 10 * time.Minute
+
+// Keyed holds one token bucket per key, created on first use with the limit limitFor returns
+type Keyed struct {
+	limitFor func(key string) Limit
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	limiter  *rate.Limiter
+	lastUsed time.Time
+}
+
+// NewKeyed returns buckets limited by limitFor(key)
+func NewKeyed(limitFor func(key string) Limit) *Keyed {
+	return &Keyed{limitFor: limitFor, buckets: make(map[string]*bucket), lastSweep: time.Now()}
+}
+
+// Same returns buckets that all use limit l
+func Same(l Limit) *Keyed {
+	return NewKeyed(func(string) Limit { return l })
+}
+
+func (k *Keyed) bucket(key string, now time.Time) *rate.Limiter {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if now.Sub(k.lastSweep) > idleAfter {
+		for name, b := range k.buckets {
+			if now.Sub(b.lastUsed) > idleAfter {
+				delete(k.buckets, name)
+			}
+		}
+		k.lastSweep = now
+	}
+
+	b, ok := k.buckets[key]
+	if !ok {
+		l := k.limitFor(key)
+		b = &bucket{limiter: rate.NewLimiter(l.Rate, l.Burst)}
+		k.buckets[key] = b
+	}
+	b.lastUsed = now
+	return b.limiter
+}
+
+// Take removes n tokens from key's bucket if they are available now. Otherwise it takes
+// nothing and returns an *Error with how long until they will be, or a *TooLargeError
+// when n is more than the bucket holds.
+func (k *Keyed) Take(key string, n int) error {
+	now := time.Now()
+	lim := k.bucket(key, now)
+	if lim.Limit() == rate.Inf {
+		return nil
+	}
+	if n > lim.Burst() {
+		return &TooLargeError{Key: key, Cost: n, Burst: lim.Burst()}
+	}
+	r := lim.ReserveN(now, n)
+	if !r.OK() {
+		return &Error{Key: key, RetryAfter: idleAfter}
+	}
+	if d := r.DelayFrom(now); d > 0 {
+		r.CancelAt(now)
+		return &Error{Key: key, RetryAfter: d}
+	}
+	return nil
+}
+
+// Wait blocks until key's bucket has a token, for at most maxWait. If the token would
+// take longer it returns an *Error right away without waiting.
+func (k *Keyed) Wait(ctx context.Context, key string, maxWait time.Duration) error {
+	now := time.Now()
+	lim := k.bucket(key, now)
+	if lim.Limit() == rate.Inf {
+		return nil
+	}
+	r := lim.ReserveN(now, 1)
+	d := r.DelayFrom(now)
+	if d == 0 {
+		return nil
+	}
+	if d > maxWait {
+		r.CancelAt(now)
+		return &Error{Key: key, RetryAfter: d}
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		r.Cancel()
+		return ctx.Err()
+	}
+}
+
+type contextKey struct{}
+
+// caller is the bucket of the request's caller, stored in its context by Middleware
+type caller struct {
+	keyed *Keyed
+	key   string
+}
+
+// ByIP limits each client address to one token per request, naming the address with
+// clientIP (e.g. audit.ClientIP, which honours the server's trust_proxy setting). It runs
+// before authentication, so requests that fail it are limited too, and it is the only limit
+// anonymous callers get: Middleware charges them nothing more.
+func (k *Keyed) ByIP(clientIP func(*http.Request) string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			k.serve(w, r, next, "ip:"+clientIP(r))
+		})
+	}
+}
+
+// Middleware limits each caller (API key or user) to one token per request, answering 429
+// with Retry-After when the bucket is empty. It must run after authentication. Anonymous
+// callers are left to ByIP, or keyed by their connection's address without it. Handlers
+// can charge more for expensive requests with Charge.
+func (k *Keyed) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key, ok := callerKey(r)
+		if !ok {
+			if _, limited := r.Context().Value(contextKey{}).(caller); limited {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+		k.serve(w, r, next, key)
+	})
+}
+
+// serve takes a token from key's bucket and serves r with the bucket in its context for Charge
+func (k *Keyed) serve(w http.ResponseWriter, r *http.Request, next http.Handler, key string) {
+	if r.Method == http.MethodOptions {
+		next.ServeHTTP(w, r)
+		return
+	}
+	if err := k.Take(key, 1); err != nil {
+		wait, _ := RetryAfter(err)
+		WriteTooManyRequests(w, wait)
+		return
+	}
+	next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), contextKey{}, caller{k, key})))
+}
+
+// Charge takes n more tokens from the bucket of the caller in ctx, returning nil when they
+// were taken or the request is not limited. Otherwise it returns an *Error with the time to
+// wait, or a *TooLargeError when the request, with the token the middleware already took,
+// costs more than the bucket holds and would never be let through.
+func Charge(ctx context.Context, n int) error {
+	c, ok := ctx.Value(contextKey{}).(caller)
+	if !ok || n <= 0 {
+		return nil
+	}
+	if lim := c.keyed.bucket(c.key, time.Now()); lim.Limit() != rate.Inf && n+1 > lim.Burst() {
+		return &TooLargeError{Key: c.key, Cost: n + 1, Burst: lim.Burst()}
+	}
+	return c.keyed.Take(c.key, n)
+}
+
+// callerKey names the bucket of r's caller; ok is false for anonymous callers, whose key
+// is their connection's address
+func callerKey(r *http.Request) (key string, ok bool) {
+	if id, ok := identity.FromContext(r.Context()); ok && id.Name != "" && id.Name != identity.Anonymous {
+		if id.Subject != "" {
+			return id.Method + ":" + id.Subject, true
+		}
+		return id.Method + ":" + id.Name, true
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host, false
+}
+
+// WriteTooManyRequests answers 429 with a Retry-After of wait, rounded up to whole seconds
+func WriteTooManyRequests(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	http.Error(w, "Too many requests", http.StatusTooManyRequests)
+}
+
+// RetryAfter reports whether err is a rate limit *Error and how long to wait
+func RetryAfter(err error) (time.Duration, bool) {
+	var limitErr *Error
+	if errors.As(err, &limitErr) {
+		return limitErr.RetryAfter, true
+	}
+	return 0, false
+}
+
+// DefaultAPILimit applies to each API caller unless configured otherwise. Each IOC an
+// extraction enriches costs a token, so the burst leaves room for an incident write-up
+// of 100 IOCs.
+const DefaultAPILimit = "5/s:100"
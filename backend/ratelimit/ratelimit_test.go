@@ -0,0 +1,155 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/0x-Singularity/Augury/identity"
+	"golang.org/x/time/rate"
+)
+
+func TestParseLimit(t *testing.T) {
+	tests := map[string]Limit{
+		"5/s:20": {Rate: 5, Burst: 20},
+		"5":      {Rate: 5, Burst: 5},
+		"120/m":  {Rate: 2, Burst: 2},
+		"1/h:3":  {Rate: rate.Limit(1.0 / 3600), Burst: 3},
+		" OFF ":  Unlimited,
+	}
+	for spec, want := range tests {
+		got, err := ParseLimit(spec)
+		if err != nil || got != want {
+			t.Errorf("ParseLimit(%q) = %v, %v; want %v", spec, got, err, want)
+		}
+	}
+	for _, bad := range []string{"", "fast", "0/s", "-1/s", "5/d", "5/s:0", "5/s:x"} {
+		if _, err := ParseLimit(bad); err == nil {
+			t.Errorf("ParseLimit(%q): expected an error", bad)
+		}
+	}
+}
+
+func TestKeyed_Take(t *testing.T) {
+	k := Same(Limit{Rate: 1, Burst: 3})
+	if err := k.Take("alice", 3); err != nil {
+		t.Fatal("expected a full bucket")
+	}
+	wait, limited := RetryAfter(k.Take("alice", 1))
+	if !limited || wait <= 0 || wait > time.Second {
+		t.Errorf("expected to wait up to a second, got %s %v", wait, limited)
+	}
+	if err := k.Take("bob", 1); err != nil {
+		t.Error("expected bob to have a separate bucket")
+	}
+
+	// A request larger than the bucket is refused, not capped to drain it
+	var tooLarge *TooLargeError
+	if err := k.Take("carol", 100); !errors.As(err, &tooLarge) || tooLarge.Cost != 100 || tooLarge.Burst != 3 {
+		t.Errorf("expected a *TooLargeError, got %v", err)
+	}
+	if err := k.Take("carol", 3); err != nil {
+		t.Errorf("a refused request should take nothing, got %v", err)
+	}
+}
+
+func TestKeyed_Wait(t *testing.T) {
+	k := Same(Limit{Rate: 1, Burst: 1})
+	ctx := context.Background()
+	if err := k.Wait(ctx, "cbr", 0); err != nil {
+		t.Fatal(err)
+	}
+	err := k.Wait(ctx, "cbr", 10*time.Millisecond)
+	var limitErr *Error
+	if !errors.As(err, &limitErr) || limitErr.Key != "cbr" {
+		t.Fatalf("expected *Error, got %v", err)
+	}
+
+	fast := Same(Limit{Rate: 1000, Burst: 1})
+	fast.Wait(ctx, "geo", 0)
+	if err := fast.Wait(ctx, "geo", time.Second); err != nil {
+		t.Errorf("expected to wait for the next token, got %v", err)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	k := Same(Limit{Rate: 0.5, Burst: 2})
+	var charged error
+	h := k.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		charged = Charge(r.Context(), 5)
+	}))
+	serve := func(name string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/ioc/pdns", nil)
+		req = req.WithContext(identity.WithIdentity(req.Context(), identity.Identity{Subject: name, Name: name, Method: "jwt"}))
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	var tooLarge *TooLargeError
+	if rr := serve("alice"); rr.Code != http.StatusOK || !errors.As(charged, &tooLarge) || tooLarge.Cost != 6 {
+		t.Fatalf("expected the request through but the extra charge refused as too large, got %d %v", rr.Code, charged)
+	}
+	serve("alice")
+	rr := serve("alice")
+	if rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") != "2" {
+		t.Errorf("expected 429 with Retry-After 2, got %d %q", rr.Code, rr.Header().Get("Retry-After"))
+	}
+	if rr := serve("bob"); rr.Code != http.StatusOK {
+		t.Errorf("expected another user to be unaffected, got %d", rr.Code)
+	}
+}
+
+func TestByIP(t *testing.T) {
+	k := Same(Limit{Rate: 0.5, Burst: 2})
+	// Stand-in for authentication: requests with a user carry an identity, others fail
+	authn := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if user := r.Header.Get("X-User"); user != "" {
+				next.ServeHTTP(w, r.WithContext(identity.WithIdentity(r.Context(), identity.Identity{Name: user, Method: "header"})))
+				return
+			}
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+		})
+	}
+	clientIP := func(r *http.Request) string { return r.Header.Get("X-Forwarded-For") }
+	h := k.ByIP(clientIP)(authn(k.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))))
+	serve := func(ip, user string) int {
+		req := httptest.NewRequest(http.MethodGet, "/api/ioc/pdns", nil)
+		req.Header.Set("X-Forwarded-For", ip)
+		req.Header.Set("X-User", user)
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	serve("203.0.113.1", "")
+	serve("203.0.113.1", "")
+	if code := serve("203.0.113.1", ""); code != http.StatusTooManyRequests {
+		t.Errorf("expected failed authentication to be limited per IP, got %d", code)
+	}
+	if code := serve("203.0.113.2", ""); code != http.StatusUnauthorized {
+		t.Errorf("expected another client IP behind the proxy to have its own bucket, got %d", code)
+	}
+
+	// An authenticated caller spends a token from its IP's bucket and from its own
+	if code := serve("203.0.113.3", "alice"); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	if code := serve("203.0.113.3", "alice"); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	if code := serve("203.0.113.4", "alice"); code != http.StatusTooManyRequests {
+		t.Errorf("expected alice's own bucket to be empty, got %d", code)
+	}
+
+	// Anonymous callers are charged once, by their IP
+	for i := 0; i < 2; i++ {
+		if code := serve("203.0.113.5", identity.Anonymous); code != http.StatusOK {
+			t.Fatalf("request %d: expected 200, got %d", i+1, code)
+		}
+	}
+}
@@ -0,0 +1,208 @@
+// Package rbac decides what an authenticated caller may see.
+//
+// There are three roles, each including the one before it:
+//
+//	viewer   query history and low-sensitivity lookups (PDNS, GeoIP)
+//	analyst  every IOC lookup and extraction, snapshots and diffs
+//	admin    everything, including personal contact details and administration
+//
+// Routes declare the minimum role they need (see routes.SetupRoutes). Inside a response,
+// sensitive fields such as an LDAP phone number are redacted for roles below the one a
+// FieldPolicy requires, rather than failing the whole request.
+package rbac
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/0x-Singularity/Augury/identity"
+)
+
+// Role is an access level
+type Role string
+
+const (
+	Viewer  Role = "viewer"
+	Analyst Role = "analyst"
+	Admin   Role = "admin"
+)
+
+var rank = map[Role]int{Viewer: 1, Analyst: 2, Admin: 3}
+
+// Parse returns the role named s, ignoring case
+func Parse(s string) (Role, bool) {
+	r := Role(strings.ToLower(strings.TrimSpace(s)))
+	_, ok := rank[r]
+	return r, ok
+}
+
+// Allows reports whether r includes min
+func (r Role) Allows(min Role) bool {
+	return rank[r] >= rank[min]
+}
+
+// Highest returns the highest recognised role among names; ok is false when there is none
+func Highest(names []string) (best Role, ok bool) {
+	for _, name := range names {
+		if r, known := Parse(name); known && rank[r] > rank[best] {
+			best = r
+		}
+	}
+	return best, best != ""
+}
+
+// RoleOf returns the highest role held by the caller in ctx. Callers without a
+// recognised role are viewers; authentication grants the configured default role
+// to identities that carry none (see auth.Config.DefaultRole).
+func RoleOf(ctx context.Context) Role {
+	id, _ := identity.FromContext(ctx)
+	if best, ok := Highest(id.Roles); ok {
+		return best
+	}
+	return Viewer
+}
+
+// Require wraps h so only callers with at least role min reach it; others get 403
+func Require(min Role, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodOptions && !RoleOf(r.Context()).Allows(min) {
+			slog.InfoContext(r.Context(), "Denied request below the required role", "method", r.Method, "path", r.URL.Path, "requires", string(min))
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// RequireScope wraps the handler of route (an API path such as /ioc/extract) so callers
+// whose identity is limited to scopes, i.e. API keys, only reach it when a scope covers it
+func RequireScope(route string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if id, ok := identity.FromContext(r.Context()); ok && r.Method != http.MethodOptions && !InScope(id.Scopes, route) {
+			slog.InfoContext(r.Context(), "Denied request outside the key's scopes", "method", r.Method, "path", r.URL.Path)
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// InScope reports whether scopes cover route. Nil scopes cover everything; a scope is
+// "*", an exact route, or a prefix ending in "/*".
+func InScope(scopes []string, route string) bool {
+	if scopes == nil {
+		return true
+	}
+	for _, s := range scopes {
+		if s == "*" || s == route {
+			return true
+		}
+		if strings.HasSuffix(s, "/*") && strings.HasPrefix(route, strings.TrimSuffix(s, "*")) {
+			return true
+		}
+	}
+	return false
+}
+
+// Redacted replaces the value of a field the caller may not see
+const Redacted = "[redacted]"
+
+// FieldPolicy maps a JSON object key to the fields of that object that need a minimum role.
+// For example {"ldap": {"phone": Admin}} hides the phone number of every "ldap" object
+// from callers below admin, wherever it appears in a response.
+type FieldPolicy map[string]map[string]Role
+
+// DefaultFieldPolicy covers parsed LDAP and asset entries and the raw FAKEula objects
+// they come from ("user" for LDAP, "owner" and "executive" for assets)
+var DefaultFieldPolicy = FieldPolicy{
+	"ldap":      {"phone": Admin, "mobile": Admin, "age": Admin, "manager": Analyst, "title": Analyst},
+	"user":      {"phone": Admin, "mobile": Admin, "age": Admin, "manager": Analyst, "title": Analyst},
+	"asset":     {"platformOwner": Analyst, "executive": Analyst, "stackOwner": Analyst},
+	"owner":     {"full_name": Analyst},
+	"executive": {"full_name": Analyst},
+}
+
+// Apply returns v with every field role may not see redacted. When nothing needs
+// redacting for role, v is returned as is; otherwise the result is a JSON-shaped copy,
+// so cached values are never modified.
+func (p FieldPolicy) Apply(v interface{}, role Role) (interface{}, error) {
+	if !p.restricts(role) {
+		return v, nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var generic interface{}
+	if err := json.Unmarshal(b, &generic); err != nil {
+		return nil, err
+	}
+	p.redact(generic, role)
+	return generic, nil
+}
+
+// restricts reports whether any field is hidden from role
+func (p FieldPolicy) restricts(role Role) bool {
+	for _, fields := range p {
+		for _, min := range fields {
+			if !role.Allows(min) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// changeLists names the diff.Report lists whose entries describe a field of a policy
+// object, so a changed phone number is hidden the same way as the number itself
+var changeLists = map[string]string{"ldap_changes": "ldap", "asset_changes": "asset"}
+
+// hidden reports whether role may not see field of objects stored under key
+func (p FieldPolicy) hidden(key, field string, role Role) bool {
+	min, ok := p[key][field]
+	return ok && !role.Allows(min)
+}
+
+func (p FieldPolicy) redact(v interface{}, role Role) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			switch child := child.(type) {
+			case map[string]interface{}:
+				for field, val := range child {
+					if p.hidden(key, field, role) && !isEmpty(val) {
+						child[field] = Redacted
+					}
+				}
+			case []interface{}:
+				if object, ok := changeLists[key]; ok {
+					for _, item := range child {
+						change, ok := item.(map[string]interface{})
+						if field, _ := change["field"].(string); ok && p.hidden(object, field, role) {
+							change["previous"], change["current"] = Redacted, Redacted
+						}
+					}
+				}
+			}
+			p.redact(child, role)
+		}
+	case []interface{}:
+		for _, child := range v {
+			p.redact(child, role)
+		}
+	}
+}
+
+// isEmpty reports whether a JSON value carries no information worth hiding
+func isEmpty(v interface{}) bool {
+	switch v := v.(type) {
+	case nil:
+		return true
+	case string:
+		return v == "" || v == "<nil>"
+	}
+	return false
+}
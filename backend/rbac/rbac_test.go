@@ -0,0 +1,124 @@
+package rbac
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/0x-Singularity/Augury/identity"
+)
+
+func withRoles(roles ...string) context.Context {
+	return identity.WithIdentity(context.Background(), identity.Identity{Name: "alice", Roles: roles})
+}
+
+func TestRoleOf(t *testing.T) {
+	tests := []struct {
+		ctx  context.Context
+		want Role
+	}{
+		{context.Background(), Viewer},
+		{withRoles(), Viewer},
+		{withRoles("unrelated"), Viewer},
+		{withRoles("Analyst"), Analyst},
+		{withRoles("viewer", "admin", "analyst"), Admin},
+	}
+	for i, tt := range tests {
+		if got := RoleOf(tt.ctx); got != tt.want {
+			t.Errorf("case %d: got %s, want %s", i, got, tt.want)
+		}
+	}
+}
+
+func TestRequire(t *testing.T) {
+	h := Require(Analyst, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	tests := []struct {
+		method string
+		ctx    context.Context
+		want   int
+	}{
+		{http.MethodGet, withRoles("viewer"), http.StatusForbidden},
+		{http.MethodGet, withRoles("analyst"), http.StatusOK},
+		{http.MethodGet, withRoles("admin"), http.StatusOK},
+		{http.MethodOptions, withRoles("viewer"), http.StatusOK},
+	}
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(tt.method, "/api/ioc/ldap", nil).WithContext(tt.ctx))
+		if rr.Code != tt.want {
+			t.Errorf("%s as %v: got %d, want %d", tt.method, RoleOf(tt.ctx), rr.Code, tt.want)
+		}
+	}
+}
+
+func TestInScope(t *testing.T) {
+	tests := []struct {
+		scopes []string
+		route  string
+		want   bool
+	}{
+		{nil, "/admin/keys", true},
+		{[]string{}, "/ioc/pdns", false},
+		{[]string{"*"}, "/admin/keys", true},
+		{[]string{"/ioc/extract"}, "/ioc/extract", true},
+		{[]string{"/ioc/extract"}, "/ioc/extract/stream", false},
+		{[]string{"/ioc/*"}, "/ioc/extract/stream", true},
+		{[]string{"/ioc/*"}, "/history", false},
+	}
+	for _, tt := range tests {
+		if got := InScope(tt.scopes, tt.route); got != tt.want {
+			t.Errorf("InScope(%v, %s) = %v, want %v", tt.scopes, tt.route, got, tt.want)
+		}
+	}
+
+	h := RequireScope("/ioc/ldap", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	ctx := identity.WithIdentity(context.Background(), identity.Identity{Name: "bot", Scopes: []string{"/ioc/pdns"}})
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/ioc/ldap", nil).WithContext(ctx))
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("expected 403 outside the key's scopes, got %d", rr.Code)
+	}
+}
+
+func TestFieldPolicy_Apply(t *testing.T) {
+	type ldap struct {
+		Email string `json:"email"`
+		Phone string `json:"phone"`
+		Title string `json:"title"`
+	}
+	original := map[string]interface{}{
+		"entries": []interface{}{map[string]interface{}{"ldap": &ldap{Email: "a@example.com", Phone: "555-0100"}}},
+		"changes": map[string]interface{}{"ldap_changes": []interface{}{
+			map[string]interface{}{"field": "phone", "previous": "555-0100", "current": "555-0199"},
+			map[string]interface{}{"field": "email", "previous": "a@example.com", "current": "b@example.com"},
+		}},
+	}
+
+	out, err := DefaultFieldPolicy.Apply(original, Viewer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := out.(map[string]interface{})["entries"].([]interface{})[0].(map[string]interface{})["ldap"].(map[string]interface{})
+	if entry["phone"] != Redacted || entry["email"] != "a@example.com" {
+		t.Errorf("unexpected redaction %v", entry)
+	}
+	if entry["title"] != "" {
+		t.Errorf("empty fields should be left alone, got %v", entry["title"])
+	}
+	changes := out.(map[string]interface{})["changes"].(map[string]interface{})["ldap_changes"].([]interface{})
+	if c := changes[0].(map[string]interface{}); c["previous"] != Redacted || c["current"] != Redacted {
+		t.Errorf("expected the phone change to be redacted, got %v", c)
+	}
+	if c := changes[1].(map[string]interface{}); c["current"] != "b@example.com" {
+		t.Errorf("expected the email change to be visible, got %v", c)
+	}
+
+	// The input is never modified and admins see it unchanged
+	if original["entries"].([]interface{})[0].(map[string]interface{})["ldap"].(*ldap).Phone != "555-0100" {
+		t.Error("Apply modified its input")
+	}
+	if out, _ := DefaultFieldPolicy.Apply(original, Admin); out.(map[string]interface{})["entries"] == nil {
+		t.Error("expected admins to get the original value")
+	}
+}
@@ -0,0 +1,224 @@
+// Package refang turns defanged indicators such as hxxp://evil[.]com or
+// user[@]domain(.)com back into their real form.
+//
+// Refanging free text keeps track of where every character came from, so anything
+// found in the refanged text can be traced back to the exact span of the original report.
+package refang
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Rule rewrites one defang style. Pattern is a regular expression without capturing
+// groups; Replace receives the matched text and returns the refanged form.
+type Rule struct {
+	Name    string
+	Pattern string
+	Replace func(match string) string
+}
+
+// literal returns a Replace func that always yields s
+func literal(s string) func(string) string {
+	return func(string) string { return s }
+}
+
+// DefaultRules covers the defang styles we see in threat reports
+var DefaultRules = []Rule{
+	{
+		// hxxp://, hXXps://, h**p://, h[tt]p://
+		Name:    "scheme",
+		Pattern: `(?i)\bh(?:xx|\*\*|\[tt\]|\(tt\))p(?:s)?\b`,
+		Replace: func(m string) string {
+			if strings.HasSuffix(strings.ToLower(m), "s") {
+				return "https"
+			}
+			return "http"
+		},
+	},
+	{
+		// fxp://
+		Name:    "ftp-scheme",
+		Pattern: `(?i)\bfxp\b`,
+		Replace: literal("ftp"),
+	},
+	{
+		// http[:]//, http[://], http(:)//
+		Name:    "scheme-separator",
+		Pattern: `\[://\]|\[:\]//|\(:\)//|\[:/\]/`,
+		Replace: literal("://"),
+	},
+	{
+		// evil[.]com, evil(.)com, evil{.}com, evil[dot]com, 1.2.3[,]4, evil [.] com
+		Name:    "dot",
+		Pattern: `(?i) ?(?:\[\.\]|\(\.\)|\{\.\}|\[dot\]|\(dot\)|\{dot\}|\[,\]) ?`,
+		Replace: literal("."),
+	},
+	{
+		// evil\.com
+		Name:    "escaped-dot",
+		Pattern: `\\\.`,
+		Replace: literal("."),
+	},
+	{
+		// user[@]domain, user(at)domain, user [at] domain
+		Name:    "at",
+		Pattern: `(?i) ?(?:\[@\]|\(@\)|\{@\}|\[at\]|\(at\)|\{at\}) ?`,
+		Replace: literal("@"),
+	},
+	{
+		// 2001[:]db8[:][:]1, host[:]8080
+		Name:    "colon",
+		Pattern: `\[:\]`,
+		Replace: literal(":"),
+	},
+	{
+		// evil.com[/]path
+		Name:    "slash",
+		Pattern: `\[/\]`,
+		Replace: literal("/"),
+	},
+}
+
+// Refanger applies a rule set to text
+type Refanger struct {
+	rules []Rule
+	re    *regexp.Regexp
+}
+
+// New compiles rules into a Refanger. Rules earlier in the list win when two match at the same position.
+func New(rules []Rule) (*Refanger, error) {
+	parts := make([]string, len(rules))
+	for i, rule := range rules {
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("refang: rule %s: %w", rule.Name, err)
+		}
+		if re.NumSubexp() != 0 {
+			return nil, fmt.Errorf("refang: rule %s must not use capturing groups", rule.Name)
+		}
+		if rule.Replace == nil {
+			return nil, fmt.Errorf("refang: rule %s has no Replace func", rule.Name)
+		}
+		parts[i] = "(" + rule.Pattern + ")"
+	}
+	re, err := regexp.Compile(strings.Join(parts, "|"))
+	if err != nil {
+		return nil, fmt.Errorf("refang: %w", err)
+	}
+	return &Refanger{rules: rules, re: re}, nil
+}
+
+// MustNew is like New but panics on an invalid rule set
+func MustNew(rules []Rule) *Refanger {
+	r, err := New(rules)
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+// Default refangs with DefaultRules
+var Default = MustNew(DefaultRules)
+
+// Text refangs free text with the default rules
+func Text(s string) *Result {
+	return Default.Text(s)
+}
+
+// IOC refangs a single indicator with the default rules, trimming surrounding whitespace
+func IOC(s string) string {
+	return Default.IOC(s)
+}
+
+// IOC refangs a single indicator, trimming surrounding whitespace
+func (r *Refanger) IOC(s string) string {
+	return strings.TrimSpace(r.Text(strings.TrimSpace(s)).Text)
+}
+
+// Text refangs free text and records how to map the result back to the original
+func (r *Refanger) Text(s string) *Result {
+	res := &Result{Original: s}
+	matches := r.re.FindAllStringSubmatchIndex(s, -1)
+	if len(matches) == 0 {
+		res.Text = s
+		return res
+	}
+
+	var b strings.Builder
+	b.Grow(len(s))
+	res.starts = make([]int, 0, len(s)+1)
+	res.ends = make([]int, 0, len(s)+1)
+
+	// copy emits original bytes unchanged, each mapping to itself
+	copyRange := func(from, to int) {
+		b.WriteString(s[from:to])
+		for i := from; i < to; i++ {
+			res.starts = append(res.starts, i)
+			res.ends = append(res.ends, i+1)
+		}
+	}
+
+	prev := 0
+	for _, m := range matches {
+		start, end := m[0], m[1]
+		copyRange(prev, start)
+
+		replacement := s[start:end]
+		for i := range r.rules {
+			if m[2+2*i] >= 0 {
+				replacement = r.rules[i].Replace(s[start:end])
+				break
+			}
+		}
+		// Every byte of a replacement maps back to the whole defanged token
+		b.WriteString(replacement)
+		for range replacement {
+			res.starts = append(res.starts, start)
+			res.ends = append(res.ends, end)
+		}
+		prev = end
+	}
+	copyRange(prev, len(s))
+
+	res.Text = b.String()
+	res.changed = true
+	return res
+}
+
+// Result is refanged text plus the mapping back to the original
+type Result struct {
+	Original string
+	Text     string
+
+	changed bool
+	// starts[i] and ends[i] are the original byte span that produced byte i of Text
+	starts []int
+	ends   []int
+}
+
+// Changed reports whether any rule fired
+func (r *Result) Changed() bool {
+	return r.changed
+}
+
+// OriginalSpan maps the byte span [start, end) of Text to a byte span of Original
+func (r *Result) OriginalSpan(start, end int) (int, int) {
+	if !r.changed {
+		return start, end
+	}
+	if start >= end {
+		if start >= len(r.starts) {
+			return len(r.Original), len(r.Original)
+		}
+		return r.starts[start], r.starts[start]
+	}
+	return r.starts[start], r.ends[end-1]
+}
+
+// OriginalText returns the part of Original that produced Text[start:end]
+func (r *Result) OriginalText(start, end int) string {
+	from, to := r.OriginalSpan(start, end)
+	return r.Original[from:to]
+}
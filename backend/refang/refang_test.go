@@ -0,0 +1,68 @@
+package refang
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestIOC(t *testing.T) {
+	tests := map[string]string{
+		"hxxp://evil[.]com/path":     "http://evil.com/path",
+		"hXXps[://]evil(.)com":       "https://evil.com",
+		"1.2.3[.]4":                  "1.2.3.4",
+		"1[.]2[.]3[,]4":              "1.2.3.4",
+		"user[@]domain(.)com":        "user@domain.com",
+		"user (at) domain [dot] com": "user@domain.com",
+		"evil{.}co{dot}uk":           "evil.co.uk",
+		"evil\\.com":                 "evil.com",
+		"2001[:]db8[:][:]1":          "2001:db8::1",
+		"fxp://files[.]evil[.]com":   "ftp://files.evil.com",
+		"  example.com  ":            "example.com",
+		"plain.example.com":          "plain.example.com",
+	}
+	for in, want := range tests {
+		if got := IOC(in); got != want {
+			t.Errorf("IOC(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestText_OriginalSpan(t *testing.T) {
+	text := "C2: hxxp://evil[.]com and 10[.]0[.]0[.]1 (see report)"
+	res := Text(text)
+
+	if !res.Changed() {
+		t.Fatal("expected text to be refanged")
+	}
+	if want := "C2: http://evil.com and 10.0.0.1 (see report)"; res.Text != want {
+		t.Fatalf("Text = %q, want %q", res.Text, want)
+	}
+
+	for refanged, original := range map[string]string{
+		"http://evil.com": "hxxp://evil[.]com",
+		"10.0.0.1":        "10[.]0[.]0[.]1",
+		"(see report)":    "(see report)",
+	} {
+		i := strings.Index(res.Text, refanged)
+		if got := res.OriginalText(i, i+len(refanged)); got != original {
+			t.Errorf("OriginalText(%q) = %q, want %q", refanged, got, original)
+		}
+	}
+}
+
+func TestText_Unchanged(t *testing.T) {
+	res := Text("nothing to see")
+	if res.Changed() || res.Text != "nothing to see" {
+		t.Fatalf("unexpected result %+v", res)
+	}
+	if from, to := res.OriginalSpan(8, 11); from != 8 || to != 11 {
+		t.Errorf("OriginalSpan = %d,%d", from, to)
+	}
+}
+
+func TestNew_RejectsCapturingGroups(t *testing.T) {
+	_, err := New([]Rule{{Name: "bad", Pattern: `(x)`, Replace: literal("y")}})
+	if err == nil {
+		t.Fatal("expected an error for a rule with a capturing group")
+	}
+}
@@ -0,0 +1,50 @@
+// Package response provides the ResponseWriter wrapper middleware use to see what a
+// handler answered: the audit log, the access log and the HTTP metrics.
+package response
+
+import (
+	"io"
+	"net/http"
+)
+
+// Recorder captures the response status, and copies the body to Body when it is set
+// (the audit log hashes it). Handlers that never call WriteHeader answered 200.
+type Recorder struct {
+	http.ResponseWriter
+	Status int
+	Body   io.Writer
+
+	wroteHeader bool
+}
+
+// NewRecorder wraps w
+func NewRecorder(w http.ResponseWriter) *Recorder {
+	return &Recorder{ResponseWriter: w, Status: http.StatusOK}
+}
+
+func (rw *Recorder) WriteHeader(status int) {
+	if !rw.wroteHeader {
+		rw.Status, rw.wroteHeader = status, true
+	}
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *Recorder) Write(b []byte) (int, error) {
+	rw.wroteHeader = true
+	if rw.Body != nil {
+		rw.Body.Write(b)
+	}
+	return rw.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (rw *Recorder) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// Flush keeps Server-Sent Events streaming through the recorder
+func (rw *Recorder) Flush() {
+	if f, ok := rw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -0,0 +1,45 @@
+package response
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRecorder(t *testing.T) {
+	rr := httptest.NewRecorder()
+	rw := NewRecorder(rr)
+	if rw.Status != http.StatusOK {
+		t.Errorf("expected 200 before anything is written, got %d", rw.Status)
+	}
+
+	var body bytes.Buffer
+	rw.Body = &body
+	rw.WriteHeader(http.StatusTeapot)
+	rw.WriteHeader(http.StatusInternalServerError) // ignored, like net/http does
+	rw.Write([]byte("short and stout"))
+	rw.Flush()
+
+	if rw.Status != http.StatusTeapot {
+		t.Errorf("expected the first status, got %d", rw.Status)
+	}
+	if body.String() != "short and stout" || rr.Body.String() != "short and stout" {
+		t.Errorf("expected the body both copied and sent, got %q and %q", body.String(), rr.Body.String())
+	}
+	if !rr.Flushed {
+		t.Error("expected Flush to reach the underlying writer")
+	}
+	if http.NewResponseController(rw).Flush() != nil {
+		t.Error("expected a ResponseController to see through the recorder")
+	}
+}
+
+func TestRecorder_WriteWithoutHeader(t *testing.T) {
+	rw := NewRecorder(httptest.NewRecorder())
+	rw.Write([]byte("ok"))
+	rw.WriteHeader(http.StatusNotFound) // too late, 200 was sent with the body
+	if rw.Status != http.StatusOK {
+		t.Errorf("expected 200, got %d", rw.Status)
+	}
+}
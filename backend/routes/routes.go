@@ -1,25 +1,92 @@
 package routes
 
 import (
+	"net/http"
+
+	"github.com/0x-Singularity/Augury/audit"
+	"github.com/0x-Singularity/Augury/auth"
+	"github.com/0x-Singularity/Augury/config"
 	"github.com/0x-Singularity/Augury/controllers"
+	"github.com/0x-Singularity/Augury/logging"
+	"github.com/0x-Singularity/Augury/metrics"
+	"github.com/0x-Singularity/Augury/ratelimit"
+	"github.com/0x-Singularity/Augury/rbac"
+	"github.com/0x-Singularity/Augury/tracing"
 	"github.com/gorilla/mux"
 )
 
-// SetupRoutes registers API endpoints on the provided router
-func SetupRoutes(router *mux.Router) {
+// route is one API endpoint and the minimum role allowed to call it
+type route struct {
+	path    string
+	handler http.HandlerFunc
+	methods []string
+	role    rbac.Role
+}
+
+// apiRoutes is the access policy: viewers get history, analysts extraction, admins
+// everything. Single-source lookups take the role their source declares (see sourceRoute).
+// Fields inside responses are additionally redacted by role (see rbac.DefaultFieldPolicy).
+func apiRoutes(h *controllers.Handlers) []route {
+	return []route{
+		{"/ioc/lookup", h.NeedsDB(controllers.LookupIOC), []string{"GET"}, rbac.Viewer},
+		{"/ioc/snapshot", h.NeedsDB(controllers.GetSnapshot), []string{"GET"}, rbac.Analyst},
+		{"/ioc/diff", h.NeedsDB(controllers.DiffIOC), []string{"GET"}, rbac.Analyst},
+		{"/history", h.NeedsDB(controllers.History), []string{"GET"}, rbac.Viewer},
+
+		{"/ioc/extract", h.ExtractFromText, []string{"POST", "OPTIONS"}, rbac.Analyst},
+		{"/ioc/extract/stream", h.ExtractFromTextStream, []string{"POST", "OPTIONS"}, rbac.Analyst},
+
+		{"/admin/keys", h.NeedsDB(controllers.ListAPIKeys), []string{"GET"}, rbac.Admin},
+		{"/admin/keys", h.NeedsDB(controllers.CreateAPIKey), []string{"POST", "OPTIONS"}, rbac.Admin},
+		{"/admin/keys/{id}", h.NeedsDB(controllers.RevokeAPIKey), []string{"DELETE", "OPTIONS"}, rbac.Admin},
+		{"/audit/verify", h.VerifyAudit, []string{"GET"}, rbac.Admin},
+	}
+}
+
+// SetupRoutes registers API endpoints on the provided router, served by h.
+// Every API route requires authentication through authn and the role listed in apiRoutes;
+// API keys must also have a scope covering the route. Each client IP, and then each
+// authenticated caller, is rate limited by limits, and every request, allowed or not, is
+// recorded in the audit log.
+// The /healthz and /readyz probes and /metrics sit outside /api, open to the load balancer
+// and Prometheus. Every routed request gets a request ID (see logging.Middleware), is
+// counted and timed (see metrics.Middleware), and its trace span is named after the route
+// (see tracing.Middleware). API requests are also logged once served (see logging.AccessLog).
+func SetupRoutes(router *mux.Router, cfg *config.Config, h *controllers.Handlers, authn *auth.Authenticator, limits *ratelimit.Keyed) {
+	router.Use(logging.Middleware, tracing.Middleware, metrics.Middleware)
+	router.HandleFunc("/healthz", controllers.Healthz).Methods("GET", "HEAD")
+	router.HandleFunc("/readyz", h.Readyz).Methods("GET", "HEAD")
+	router.Handle("/metrics", metrics.Handler()).Methods("GET")
+
 	apiRouter := router.PathPrefix("/api").Subrouter()
+	// Audit and the per-IP limit run before authentication so failed attempts are recorded
+	// and limited too
+	clientIP := func(r *http.Request) string { return audit.ClientIP(r, cfg.Server.TrustProxy) }
+	apiRouter.Use(audit.Middleware(h.Audit, cfg.Server.TrustProxy), limits.ByIP(clientIP), authn.Middleware, audit.Identify,
+		logging.AccessLog, limits.Middleware)
 
 	// Map API paths to controller functions
-	apiRouter.HandleFunc("/ioc/lookup", controllers.LookupIOC).Methods("GET")
-
-	apiRouter.HandleFunc("/ioc/extract", controllers.ExtractFromText).Methods("POST", "OPTIONS")
-
-	apiRouter.HandleFunc("/ioc/oil", controllers.QueryAllOIL).Methods("GET")
-	apiRouter.HandleFunc("/ioc/pdns", controllers.QueryPDNS).Methods("GET", "OPTIONS")
-	apiRouter.HandleFunc("/ioc/ldap", controllers.QueryLDAP).Methods("GET", "OPTIONS")
-	apiRouter.HandleFunc("/ioc/geo", controllers.QueryGeoIP).Methods("GET", "OPTIONS")
-	apiRouter.HandleFunc("/ioc/binary", controllers.QueryBinary).Methods("GET", "OPTIONS")
-	apiRouter.HandleFunc("/ioc/vpn", controllers.QueryVPN).Methods("GET", "OPTIONS")
-	apiRouter.HandleFunc("/ioc/cbr", controllers.QueryCBR).Methods("GET", "OPTIONS")
-	apiRouter.HandleFunc("/ioc/host", controllers.QueryHost).Methods("GET", "OPTIONS")
+	for _, rt := range apiRoutes(h) {
+		apiRouter.Handle(rt.path, rbac.Require(rt.role, rbac.RequireScope(rt.path, rt.handler))).Methods(rt.methods...)
+	}
+	// Registered after the fixed /ioc/... paths, which take precedence
+	apiRouter.Handle("/ioc/{source}", sourceRoute(h)).Methods("GET", "OPTIONS")
+}
+
+// sourceRoute serves /ioc/{source} for every enrichment source in h.Sources, each behind
+// the role the source declares and, for API keys, a scope covering /ioc/<source>
+func sourceRoute(h *controllers.Handlers) http.Handler {
+	bySource := make(map[string]http.Handler)
+	for _, src := range h.Sources.All() {
+		path := "/ioc/" + src.Name
+		bySource[src.Name] = rbac.Require(src.Role, rbac.RequireScope(path, h.QuerySource(src.Name)))
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next, ok := bySource[mux.Vars(r)["source"]]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
 }
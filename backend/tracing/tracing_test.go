@@ -0,0 +1,59 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/0x-Singularity/Augury/config"
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestHandler_NamesSpanAfterRoute(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	router := mux.NewRouter()
+	router.Use(Middleware)
+	router.HandleFunc("/api/ioc/{source}", func(w http.ResponseWriter, r *http.Request) {
+		_, span := Start(r.Context(), "child")
+		span.End()
+	})
+	Handler(router).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/ioc/1.2.3.4", nil))
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("expected a server and a child span, got %d", len(spans))
+	}
+	child, server := spans[0], spans[1]
+	if server.Name() != "GET /api/ioc/{source}" {
+		t.Errorf("server span named %q", server.Name())
+	}
+	if child.Parent().SpanID() != server.SpanContext().SpanID() {
+		t.Error("expected the handler's span to be a child of the server span")
+	}
+}
+
+func TestNewExporter(t *testing.T) {
+	tests := map[string]struct {
+		cfg  config.Tracing
+		want bool
+	}{
+		"stdout by default":  {config.Tracing{}, true},
+		"otlp with endpoint": {config.Tracing{Endpoint: "http://collector:4318"}, true},
+		"none":               {config.Tracing{Exporter: config.ExporterNone, Endpoint: "http://collector:4318"}, false},
+	}
+	for name, tt := range tests {
+		exporter, err := newExporter(context.Background(), tt.cfg)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if (exporter != nil) != tt.want {
+			t.Errorf("%s: got exporter %T", name, exporter)
+		}
+	}
+}
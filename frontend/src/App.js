@@ -22,13 +22,19 @@ function App() {
   /**
    * Handlers
    */
-  const handleUsernameChange = (newUsername) => {
+  const handleUsernameChange = (newUsername, token) => {
     setUsername(newUsername);
     if (newUsername) {
       localStorage.setItem("username", newUsername);
     } else {
       localStorage.removeItem("username");
     }
+    // Changing user drops the previous user's token
+    if (newUsername && token) {
+      localStorage.setItem("token", token);
+    } else {
+      localStorage.removeItem("token");
+    }
   };
 
   const toggleChangeButton = () => setShowChangeButton((prev) => !prev);
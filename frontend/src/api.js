@@ -0,0 +1,11 @@
+// Headers that identify the user to the Augury API. The token (an access token from the
+// identity provider, or an API key) is what the backend checks by default; the username
+// is only honoured when the backend runs with AUGURY_AUTH_MODE=header for local development.
+export function authHeaders() {
+  const headers = { "X-User-Name": localStorage.getItem("username") ?? "" };
+  const token = localStorage.getItem("token");
+  if (token) {
+    headers.Authorization = `Bearer ${token}`;
+  }
+  return headers;
+}
@@ -1,5 +1,6 @@
-import React, { useState, useEffect } from "react";
+import React, { useState } from "react";
 import Results from "./Results";
+import { authHeaders } from "../api";
 import "./Home.css";
 
 function Home() {
@@ -7,15 +8,7 @@ function Home() {
   const [activeTabId, setActiveTabId] = useState(null);
   const [query, setQuery] = useState("");
   const [loading, setLoading] = useState(false);
-  const [username, setUsername] = useState("");
 
-  // Load the username from localStorage when the component mounts
-  useEffect(() => {
-    const storedUsername = localStorage.getItem("username");
-    if (storedUsername) {
-      setUsername(storedUsername);
-    }
-  }, []);
   const extractFirstIOC = (data) => {
     const iocs = Object.keys(data?.data || {});
     return iocs.length > 0 ? iocs[0] : "Results";
@@ -32,7 +25,7 @@ function Home() {
         method: "POST",
         headers: {
           "Content-Type": "text/plain",
-          "X-User-Name": username, //getting username from localStorage
+          ...authHeaders(),
         },
         body: query,
       });
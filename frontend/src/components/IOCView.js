@@ -1,5 +1,6 @@
 import { useEffect, useState } from "react";
 import IOCTable from "./IOCTable";
+import { authHeaders } from "../api";
 
 function UniversalView() {
   const [results, setResults] = useState(null);
@@ -18,7 +19,9 @@ function UniversalView() {
           return;
         }
 
-        const res = await fetch(`http://localhost:8080/api/ioc/${source}?ioc=${encodeURIComponent(ioc)}`);
+        const res = await fetch(`http://localhost:8080/api/ioc/${source}?ioc=${encodeURIComponent(ioc)}`, {
+          headers: authHeaders(),
+        });
         if (!res.ok) throw new Error(`Request failed: ${res.status}`);
         const data = await res.json();
         console.log(`${source.toUpperCase()} response:`, data); // Debugging
@@ -2,14 +2,19 @@ import React, { useState, useEffect } from 'react';
     
 function Login({ onLogin }) {
   const [username, setUsername] = useState('');
+  const [token, setToken] = useState('');
 
   const handleUsernameChange = (event) => {
     setUsername(event.target.value);
   };
 
+  const handleTokenChange = (event) => {
+    setToken(event.target.value);
+  };
+
   const saveUsername = () => {
     if (onLogin) {
-      onLogin(username); // Pass the new username to the parent component
+      onLogin(username, token.trim()); // Pass the new username and token to the parent component
     }
   };
 
@@ -26,6 +31,18 @@ function Login({ onLogin }) {
         style={{width: "50%",}}
         onChange={handleUsernameChange}
       />
+      <br />
+      {/* The API checks this token unless the backend runs with AUGURY_AUTH_MODE=header */}
+      <label htmlFor="token">Access token or API key: </label>
+      <input
+        type="password"
+        id="token"
+        value={token}
+        className="search-box"
+        placeholder="Paste a token from your identity provider"
+        style={{width: "50%", marginTop: "10px"}}
+        onChange={handleTokenChange}
+      />
       <button 
       onClick={saveUsername}
       className="user-button"